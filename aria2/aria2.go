@@ -0,0 +1,120 @@
+// Package aria2 hands downloads to a running aria2c with its JSON-RPC
+// interface
+package aria2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/ncw/kindledl/kindledl"
+)
+
+// DefaultURL is where aria2c --enable-rpc listens by default
+const DefaultURL = "http://localhost:6800/jsonrpc"
+
+// Client is a kindledl.Downloader which adds each download to aria2c
+type Client struct {
+	URL    string // URL of the JSON-RPC endpoint
+	Secret string // RPC secret set with --rpc-secret, if any
+	Dir    string // directory for aria2c to download to, "" for its default
+	id     atomic.Int64
+}
+
+// rpcRequest is a JSON-RPC 2.0 request
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      string `json:"id"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+}
+
+// rpcResponse is a JSON-RPC 2.0 response
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Call method with params returning the result in result
+func (c *Client) call(ctx context.Context, method string, result any, params ...any) error {
+	if c.Secret != "" {
+		params = append([]any{"token:" + c.Secret}, params...)
+	}
+	body, err := json.Marshal(rpcRequest{
+		JSONRPC: "2.0",
+		ID:      fmt.Sprintf("%s-%d", kindledl.Program, c.id.Add(1)),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("aria2 %s failed: %w", method, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	var rpcResp rpcResponse
+	err = json.NewDecoder(resp.Body).Decode(&rpcResp)
+	if err != nil {
+		return fmt.Errorf("aria2 %s failed: %s: %w", method, resp.Status, err)
+	}
+	if rpcResp.Error != nil {
+		return fmt.Errorf("aria2 %s failed: %s (code %d)", method, rpcResp.Error.Message, rpcResp.Error.Code)
+	}
+	if result != nil {
+		err = json.Unmarshal(rpcResp.Result, result)
+		if err != nil {
+			return fmt.Errorf("aria2 %s failed to decode result: %w", method, err)
+		}
+	}
+	return nil
+}
+
+// Check aria2c is running and we can talk to it, returning its version
+func (c *Client) Check(ctx context.Context) (version string, err error) {
+	var result struct {
+		Version string `json:"version"`
+	}
+	err = c.call(ctx, "aria2.getVersion", &result)
+	return result.Version, err
+}
+
+// Download adds the job to aria2c's queue
+func (c *Client) Download(ctx context.Context, job kindledl.DownloadJob) error {
+	options := map[string]any{}
+	if c.Dir != "" {
+		options["dir"] = c.Dir
+	}
+	if job.Filename != "" {
+		options["out"] = job.Filename
+	}
+	var headers []string
+	for k, v := range job.Headers {
+		headers = append(headers, k+": "+v)
+	}
+	if len(headers) > 0 {
+		options["header"] = headers
+	}
+	var gid string
+	err := c.call(ctx, "aria2.addUri", &gid, []string{job.URL}, options)
+	if err != nil {
+		return err
+	}
+	slog.Debug("Added download to aria2", "gid", gid, "url", job.URL)
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ncw/kindledl/kindledl"
+)
+
+// Exit codes for the check command and runs
+const (
+	exitNotLoggedIn = 3 // the browser needs to log in again
+	exitOffline     = 4 // Amazon couldn't be reached
+)
+
+func init() {
+	commands["check"] = command{
+		help: "check the browser is still logged in without downloading anything",
+		run:  runCheck,
+	}
+}
+
+// Check the browser is logged in to each marketplace
+func runCheck() error {
+	results, err := kindledl.Check(opt)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		account := r.Account
+		if account == "" {
+			account = "unknown account"
+		}
+		fmt.Printf("Logged in to %s as %s\n", r.Marketplace, account)
+	}
+	return nil
+}
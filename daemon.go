@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/ncw/kindledl/kindledl"
+	"github.com/ncw/kindledl/server"
+)
+
+// Flags for the daemon command
+var (
+	daemonSocket = flag.String("daemon-socket", "", "Unix socket for the daemon command to listen on and the sync command to use (default daemon.sock in the config directory)")
+)
+
+func init() {
+	commands["daemon"] = command{
+		help: "keep the logged in browser open and download books when told to by the sync command",
+		run:  runDaemon,
+	}
+	commands["sync"] = command{
+		help: "tell the daemon to download any new books and wait until it has",
+		run:  runSync,
+	}
+	commands["daemon-stop"] = command{
+		help: "tell the daemon to close the browser and exit",
+		run:  stopDaemon,
+	}
+}
+
+// Connect to the daemon
+func dialDaemon() (net.Conn, error) {
+	path, err := daemonSocketPath()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't connect to daemon - is kindledl daemon running?: %w", err)
+	}
+	return conn, nil
+}
+
+// Returns the path of the daemon socket
+func daemonSocketPath() (string, error) {
+	if *daemonSocket != "" {
+		return *daemonSocket, nil
+	}
+	dir, err := kindledl.ConfigRoot(opt)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "daemon.sock"), nil
+}
+
+// Run the daemon until it is told to quit
+func runDaemon() error {
+	if opt.KindleName == "" {
+		return fmt.Errorf(`need name of kindle, add something like -kindle "My Kindle"`)
+	}
+	path, err := daemonSocketPath()
+	if err != nil {
+		return err
+	}
+	// Remove the socket left by a daemon which didn't exit cleanly
+	if conn, err := net.Dial("unix", path); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("daemon already running on %q", path)
+	}
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove old daemon socket: %w", err)
+	}
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	defer func() {
+		_ = lis.Close()
+		_ = os.Remove(path)
+	}()
+	return server.NewDaemon(opt).Serve(lis)
+}
+
+// Ask the daemon to sync, logging its progress
+func runSync() error {
+	conn, err := dialDaemon()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	result, err := server.SendDaemon(conn, server.DaemonRequest{Command: server.DaemonSync}, func(ev server.Event) {
+		switch {
+		case ev.Type == string(kindledl.EventPostBook):
+			slog.Info("Book done", "book", ev.Book, "asin", ev.ASIN, "title", ev.Title, "status", ev.Status)
+		case ev.Error != "":
+			slog.Warn("Daemon", "event", ev.Type, "book", ev.Book, "err", ev.Error)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if result.Error != "" {
+		return fmt.Errorf("daemon sync failed: %s", result.Error)
+	}
+	slog.Info("Sync finished", "downloaded", result.Counts[kindledl.StatusDownloaded], "skipped", result.Counts[kindledl.StatusSkipped], "failed", result.Counts[kindledl.StatusFailed])
+	return nil
+}
+
+// Tell the daemon to exit
+func stopDaemon() error {
+	conn, err := dialDaemon()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	result, err := server.SendDaemon(conn, server.DaemonRequest{Command: server.DaemonQuit}, nil)
+	if err != nil {
+		return err
+	}
+	if result.Error != "" {
+		return fmt.Errorf("daemon didn't stop: %s", result.Error)
+	}
+	slog.Info("Daemon stopped")
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/ncw/kindledl/kindledl"
+)
+
+func init() {
+	commands["devices"] = command{
+		help: "list the kindles Amazon offers to download books for, to find the name for -kindle",
+		run:  runDevices,
+	}
+}
+
+// List the kindles for each marketplace
+func runDevices() error {
+	devices, err := kindledl.Devices(opt)
+	if err != nil {
+		return err
+	}
+	for _, d := range devices {
+		// -kindle is a regexp so quote anything special in the name
+		fmt.Printf("%s: -kindle %q\n", d.Marketplace, regexp.QuoteMeta(d.Name))
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+
+	"github.com/ncw/kindledl/kindledl"
+)
+
+// Commands to run at each event, set by the -hook-* flags
+var hookCommands = map[kindledl.EventType]*string{}
+
+func init() {
+	for _, t := range []kindledl.EventType{
+		kindledl.EventPreRun,
+		kindledl.EventPostRun,
+		kindledl.EventPostPage,
+		kindledl.EventPreBook,
+		kindledl.EventPostBook,
+		kindledl.EventFailure,
+		kindledl.EventAttention,
+	} {
+		hookCommands[t] = flag.String("hook-"+string(t), "", fmt.Sprintf("Command to run at the %s event", t))
+	}
+}
+
+// Add the -hook-* commands to the options
+func addCommandHooks() {
+	for t, command := range hookCommands {
+		if *command != "" {
+			opt.Hooks = append(opt.Hooks, commandHook(t, *command))
+		}
+	}
+}
+
+// Make a command which runs command with the shell, with its output
+// going to stderr so it doesn't mix with ours
+func shellCommand(command string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// Make a hook which runs command with the shell for events of type t
+//
+// The details of the event are passed in KINDLEDL_* environment
+// variables. If a pre-book command fails the book is skipped,
+// otherwise failures are logged and ignored.
+func commandHook(t kindledl.EventType, command string) kindledl.Hook {
+	return func(e kindledl.Event) error {
+		if e.Type != t {
+			return nil
+		}
+		cmd := shellCommand(command)
+		cmd.Env = append(os.Environ(),
+			"KINDLEDL_EVENT="+string(e.Type),
+			"KINDLEDL_PAGE="+strconv.Itoa(e.Page),
+			"KINDLEDL_BOOK="+strconv.Itoa(e.Number),
+			"KINDLEDL_STATUS="+e.Status,
+		)
+		if e.Book != nil {
+			cmd.Env = append(cmd.Env,
+				"KINDLEDL_ASIN="+e.Book.ASIN,
+				"KINDLEDL_TITLE="+e.Book.Title,
+				"KINDLEDL_AUTHORS="+e.Book.Authors,
+			)
+		}
+		if e.Err != nil {
+			cmd.Env = append(cmd.Env, "KINDLEDL_ERROR="+e.Err.Error())
+		}
+		slog.Debug("Running hook", "event", e.Type, "command", command)
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		if e.Type == kindledl.EventPreBook && errors.As(err, &exitErr) {
+			return kindledl.ErrSkipBook
+		} else if err != nil {
+			slog.Error("Hook command failed", "event", e.Type, "command", command, "err", err)
+		}
+		return nil
+	}
+}
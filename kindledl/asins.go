@@ -0,0 +1,80 @@
+package kindledl
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ReadASINs reads a file of ASINs, one per line, for Options.ASINs
+//
+// Blank lines and lines starting with "#" are ignored, as is anything
+// after the ASIN on a line so the title can be noted there, eg
+//
+//	# Books to download again
+//	B00ABC1234 The Hobbit
+func ReadASINs(path string) (map[string]bool, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ASIN file: %w", err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	asins := map[string]bool{}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		asins[strings.ToUpper(fields[0])] = true
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ASIN file: %w", err)
+	}
+	if len(asins) == 0 {
+		return nil, fmt.Errorf("no ASINs found in %q", path)
+	}
+	return asins, nil
+}
+
+// Returns whether every book in Options.ASINs has been done in this
+// run so there is no need to look through the rest of the library
+func (c *Client) asinsDone() bool {
+	if len(c.opt.ASINs) == 0 {
+		return false
+	}
+	return len(c.asinsMissing()) == 0
+}
+
+// Returns the ASINs in Options.ASINs which haven't been seen in this
+// run, sorted
+func (c *Client) asinsMissing() (missing []string) {
+	seen := make(map[string]bool, len(c.seen))
+	for asin := range c.seen {
+		seen[strings.ToUpper(asin)] = true
+	}
+	for asin := range c.opt.ASINs {
+		if !seen[asin] {
+			missing = append(missing, asin)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Log the ASINs in Options.ASINs which weren't found in this run
+func (c *Client) logASINsMissing() {
+	if len(c.opt.ASINs) == 0 {
+		return
+	}
+	missing := c.asinsMissing()
+	if len(missing) > 0 {
+		slog.Warn("Books in ASIN file not found in the library this run", "count", len(missing), "asins", strings.Join(missing, " "))
+	}
+}
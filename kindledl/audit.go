@@ -0,0 +1,179 @@
+package kindledl
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AuditBook is a book the audit found a problem with
+type AuditBook struct {
+	Book
+	Number int `json:"number"` // position of the book in the library, 1 based
+}
+
+// AuditReport is the result of checking the library against the
+// manifest and the files in the download directory
+type AuditReport struct {
+	Total        int         `json:"total"`         // number of books in the library which should have been done
+	Recorded     int         `json:"recorded"`      // how many of those are in the manifest
+	NotAttempted []AuditBook `json:"not_attempted"` // in the library but not in the manifest
+	NoFile       []AuditBook `json:"no_file"`       // recorded as downloaded but the file wasn't found
+}
+
+// OK returns whether the audit found no problems
+func (r *AuditReport) OK() bool {
+	return len(r.NotAttempted) == 0 && len(r.NoFile) == 0
+}
+
+// Log logs the discrepancies found and a summary
+func (r *AuditReport) Log() {
+	for _, b := range r.NotAttempted {
+		slog.Warn("Audit: book never attempted", "book", b.Number, "asin", b.ASIN, "title", b.Title, "marketplace", b.Marketplace)
+	}
+	for _, b := range r.NoFile {
+		slog.Warn("Audit: downloaded book has no file", "book", b.Number, "asin", b.ASIN, "title", b.Title, "marketplace", b.Marketplace)
+	}
+	level := slog.LevelInfo
+	if !r.OK() {
+		level = slog.LevelWarn
+	}
+	slog.Log(context.Background(), level, "Audit",
+		"total", r.Total,
+		"recorded", r.Recorded,
+		"not_attempted", len(r.NotAttempted),
+		"no_file", len(r.NoFile),
+	)
+}
+
+// Audit re-reads the library and checks every book which should have
+// been downloaded is in the manifest and every book recorded as
+// downloaded has a file in the download directory.
+//
+// The books are filtered by the -book-range, -search, -collection and
+// -skip-rentals options as they are in the run. This catches books which were
+// silently missed, eg in runs spread over several days.
+func (c *Client) Audit(ctx context.Context) (*AuditReport, error) {
+	files, partial, err := c.waitCompletedFiles(true)
+	if err != nil {
+		return nil, err
+	}
+	if partial {
+		slog.Warn("Audit: some files are still downloading")
+	}
+	r := &AuditReport{}
+	index := newEntryIndex(c.manifest.Snapshot())
+	defer func(content, i int) {
+		c.useContentType(content)
+		_ = c.useMarketplace(i)
+	}(c.contentIndex, c.marketplaceIndex)
+	for source := 0; source < c.numContentTypes()*c.numMarketplaces(); source++ {
+		c.useContentType(source / c.numMarketplaces())
+		err = c.useMarketplace(source % c.numMarketplaces())
+		if err != nil {
+			return nil, err
+		}
+		it := c.ListBooks(ctx)
+		it.filter = c.contentFilter()
+		for it.Next() {
+			b := it.Book()
+			b.Content = c.content
+			n := it.Number()
+			if c.opt.FirstBook > 0 && (n < c.opt.FirstBook || n > c.opt.LastBook) {
+				continue
+			}
+			if len(c.opt.Collections) > 0 && !inCollections(&b, c.opt.Collections) {
+				continue
+			}
+			if len(c.opt.ASINs) > 0 && !c.opt.ASINs[strings.ToUpper(b.ASIN)] {
+				continue
+			}
+			if c.reAuthor != nil && !c.reAuthor.MatchString(b.Authors) {
+				continue
+			}
+			if c.reTitle != nil && !c.reTitle.MatchString(b.Title) {
+				continue
+			}
+			if inRange, err := c.acquiredRange(&b); err == nil && inRange != 0 {
+				continue
+			}
+			if c.opt.SkipRentals && b.Rental() {
+				continue
+			}
+			r.Total++
+			e := index.find(&b, n)
+			if e == nil {
+				r.NotAttempted = append(r.NotAttempted, AuditBook{Book: b, Number: n})
+				continue
+			}
+			r.Recorded++
+			if e.Status == StatusDownloaded && !c.haveFile(files, e) {
+				r.NoFile = append(r.NoFile, AuditBook{Book: e.Book, Number: n})
+			}
+		}
+		if err := it.Err(); err != nil {
+			return nil, fmt.Errorf("audit failed to list library: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// entryIndex finds manifest entries quickly
+type entryIndex struct {
+	byASIN   map[string]*ManifestEntry
+	byNumber map[string]*ManifestEntry // by marketplace, content type and number for books without an ASIN
+}
+
+// Index the manifest entries
+func newEntryIndex(entries []ManifestEntry) *entryIndex {
+	index := &entryIndex{
+		byASIN:   map[string]*ManifestEntry{},
+		byNumber: map[string]*ManifestEntry{},
+	}
+	for i := range entries {
+		e := &entries[i]
+		if e.ASIN != "" {
+			index.byASIN[e.ASIN] = e
+		} else {
+			index.byNumber[numberKey(e.Marketplace, e.Content, e.Number)] = e
+		}
+	}
+	return index
+}
+
+// Key for entryIndex.byNumber
+func numberKey(marketplace, content string, number int) string {
+	return fmt.Sprintf("%s/%s/%d", marketplace, content, number)
+}
+
+// Find the entry for the book as Manifest.find does, returning nil if
+// not found
+func (index *entryIndex) find(b *Book, number int) *ManifestEntry {
+	if b.ASIN != "" {
+		return index.byASIN[b.ASIN]
+	}
+	return index.byNumber[numberKey(b.Marketplace, b.Content, number)]
+}
+
+// Returns whether the file for the manifest entry is in the download
+// directory
+func (c *Client) haveFile(files []completedFile, e *ManifestEntry) bool {
+	if e.File != "" {
+		_, err := os.Stat(filepath.Join(c.downloadDir, filepath.FromSlash(e.File)))
+		return err == nil
+	}
+	return findBookFile(files, &e.Book) >= 0
+}
+
+// Audit the run, logging what was found
+func (c *Client) audit() {
+	r, err := c.Audit(context.Background())
+	if err != nil {
+		slog.Error("Audit failed", "err", err)
+		return
+	}
+	r.Log()
+}
@@ -0,0 +1,61 @@
+package kindledl
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Roles of the controls which can be found by their accessible name
+//
+// Only controls are looked for as the elements found are clicked or
+// read, so they need to be real elements not text nodes.
+var axRoles = map[string]bool{
+	"button":           true,
+	"link":             true,
+	"menuitem":         true,
+	"menuitemradio":    true,
+	"menuitemcheckbox": true,
+	"radio":            true,
+	"option":           true,
+	"tab":              true,
+}
+
+// Find the controls in the page's accessibility tree whose accessible
+// name matches, only looking inside root if it is set
+//
+// This is used when matching the text of the elements fails as the
+// roles and names of the controls tend to stay the same when Amazon
+// changes the structure and classes of the page.
+func (c *Client) findByAXTree(root *rod.Element, match *regexp.Regexp) (found rod.Elements, err error) {
+	var nodes []*proto.AccessibilityAXNode
+	if root == nil {
+		tree, err := proto.AccessibilityGetFullAXTree{}.Call(c.page)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read accessibility tree: %w", err)
+		}
+		nodes = tree.Nodes
+	} else {
+		tree, err := proto.AccessibilityQueryAXTree{ObjectID: root.Object.ObjectID}.Call(c.page)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read accessibility tree: %w", err)
+		}
+		nodes = tree.Nodes
+	}
+	for _, node := range nodes {
+		if node.Ignored || node.BackendDOMNodeID == 0 || node.Role == nil || node.Name == nil {
+			continue
+		}
+		if !axRoles[node.Role.Value.Str()] || !match.MatchString(node.Name.Value.Str()) {
+			continue
+		}
+		el, err := c.page.ElementFromNode(&proto.DOMNode{BackendNodeID: node.BackendDOMNodeID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to find element for %q in accessibility tree: %w", node.Name.Value.Str(), err)
+		}
+		found = append(found, el)
+	}
+	return found, nil
+}
@@ -0,0 +1,95 @@
+package kindledl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// ErrBenchmarkDone is returned by Run when Options.Benchmark is set
+// and the sample of books has been processed
+var ErrBenchmarkDone = errors.New("benchmark finished")
+
+// BenchmarkReport writes a breakdown of how long each step of
+// downloading a book took to w with suggestions for the timing
+// options.
+func (c *Client) BenchmarkReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "Step\tCount\tAvg\tMin\tMax\tShare")
+	var perBook time.Duration
+	var total time.Duration
+	for _, name := range c.timings.names {
+		s := c.timings.steps[name]
+		perBook += s.total / time.Duration(s.count)
+		total += s.total
+	}
+	var slowest string
+	var slowestAvg time.Duration
+	for _, name := range c.timings.names {
+		s := c.timings.steps[name]
+		avg := s.total / time.Duration(s.count)
+		if avg > slowestAvg {
+			slowest, slowestAvg = name, avg
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%v\t%v\t%v\t%.0f%%\n", name, s.count,
+			avg.Round(time.Millisecond), s.min.Round(time.Millisecond), s.max.Round(time.Millisecond),
+			100*float64(s.total)/float64(max(total, 1)))
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+	books := c.counts[StatusDownloaded] + c.counts[StatusQueued]
+	fmt.Fprintf(w, "\nBooks: %d downloaded, %d failed, %d skipped, %d retries finding elements\n",
+		books, c.counts[StatusFailed], c.counts[StatusSkipped], c.pacer.retries)
+	if perBook > 0 {
+		fmt.Fprintf(w, "Time per book: %v (%.0f books per hour) - slowest step %s at %v\n",
+			perBook.Round(time.Millisecond), float64(time.Hour)/float64(perBook), slowest, slowestAvg.Round(time.Millisecond))
+		if c.totalBooks > 0 {
+			fmt.Fprintf(w, "The %d books in the library would take about %v at this rate\n",
+				c.totalBooks, (perBook * time.Duration(c.totalBooks)).Round(time.Minute))
+		}
+	}
+	fmt.Fprintln(w, "\nSuggestions:")
+	for _, s := range c.benchmarkSuggestions(books) {
+		fmt.Fprintf(w, "  - %s\n", s)
+	}
+	return nil
+}
+
+// Work out how to tune the timing options from the benchmark
+func (c *Client) benchmarkSuggestions(books int) (suggestions []string) {
+	opt := c.opt
+	retries, failed := c.pacer.retries, c.counts[StatusFailed]
+	if books == 0 && failed == 0 {
+		return []string{"No books were downloaded so there is nothing to go on - try -book with a position in the library with books you own"}
+	}
+	if failed > 0 {
+		suggestions = append(suggestions, fmt.Sprintf("%d books failed - try -speed cautious and check the -msg-* flags match your Amazon site", failed))
+	}
+	if retries > max(books, 1) {
+		suggestions = append(suggestions, fmt.Sprintf("Elements often weren't found first time so the pages are slow to update - try -time-action-interval %v and -time-retry-sleep %v",
+			2*opt.TimeActionInterval, 2*opt.TimeRetrySleep))
+	}
+	if retries == 0 && failed == 0 {
+		if opt.TimeActionInterval > 250*time.Millisecond {
+			suggestions = append(suggestions, fmt.Sprintf("Everything worked first time - try -time-action-interval %v (or -speed fast)",
+				max(opt.TimeActionInterval/2, 250*time.Millisecond)))
+		}
+		if opt.TimeScrollPause > 200*time.Millisecond {
+			suggestions = append(suggestions, fmt.Sprintf("Try -time-scroll-pause %v", max(opt.TimeScrollPause/2, 200*time.Millisecond)))
+		}
+		if !opt.Adaptive {
+			suggestions = append(suggestions, "Use -adaptive to let kindledl find the fastest action interval which works as it goes")
+		}
+	}
+	if opt.TimeJitter > 0 {
+		suggestions = append(suggestions, fmt.Sprintf("-time-jitter adds about %v to each book on average - reduce it if Amazon isn't challenging the browser", opt.TimeJitter/2))
+	}
+	if len(suggestions) == 0 {
+		suggestions = append(suggestions, "The timings look about right for your connection")
+	}
+	return suggestions
+}
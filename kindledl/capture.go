@@ -0,0 +1,202 @@
+package kindledl
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// How long to wait for the browser to start a download after the
+// download button is clicked
+const downloadStartTimeout = 30 * time.Second
+
+// DownloadJob is everything needed to download a book without the
+// browser, while the session is still valid
+type DownloadJob struct {
+	Number   int               `json:"number"` // position of the book in the library, 1 based
+	ASIN     string            `json:"asin,omitempty"`
+	Title    string            `json:"title,omitempty"`
+	Authors  string            `json:"authors,omitempty"`
+	URL      string            `json:"url"`      // URL the browser would download
+	Filename string            `json:"filename"` // file name the browser would use
+	Headers  map[string]string `json:"headers"`  // headers to send, including the cookies
+}
+
+// Downloader takes over downloading the books from the browser
+//
+// Set Options.Downloader to use one. The browser still goes through
+// the download steps for each book but the download is cancelled as
+// soon as it starts and passed to the Downloader instead.
+type Downloader interface {
+	Download(ctx context.Context, job DownloadJob) error
+}
+
+// Curl returns a shell command which downloads the job with curl
+func (job *DownloadJob) Curl() string {
+	args := []string{"curl", "-L", "-o", shellQuote(job.Filename)}
+	keys := make([]string, 0, len(job.Headers))
+	for k := range job.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "-H", shellQuote(k+": "+job.Headers[k]))
+	}
+	args = append(args, shellQuote(job.URL))
+	return strings.Join(args, " ")
+}
+
+// Quote s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Returns whether we need to see the downloads the browser starts
+func (c *Client) captureDownloads() bool {
+	return c.opt.Downloader != nil || c.opt.RecordCurl || c.opt.VerifyDownloads || c.opt.JSONSidecar
+}
+
+// Set the browser up to tell us about the downloads it starts
+//
+// If there is a Downloader the downloads go to a temporary directory
+// and are cancelled as soon as they start.
+func (c *Client) watchDownloads() error {
+	c.downloadStarts = make(chan *proto.BrowserDownloadWillBegin, 10)
+	dir := c.browserDownloadDir()
+	if c.opt.Downloader != nil {
+		var err error
+		c.captureDir, err = os.MkdirTemp("", Program+"-capture-*")
+		if err != nil {
+			return fmt.Errorf("failed to make directory for cancelled downloads: %w", err)
+		}
+		dir = c.captureDir
+	}
+	err := c.setDownloadBehavior(dir)
+	if err != nil {
+		return err
+	}
+	browser := c.browser
+	starts := c.downloadStarts
+	cancel := c.opt.Downloader != nil
+	go browser.EachEvent(func(e *proto.BrowserDownloadWillBegin) {
+		slog.Debug("Download started", "url", e.URL, "filename", e.SuggestedFilename)
+		if cancel {
+			err := proto.BrowserCancelDownload{GUID: e.GUID}.Call(browser)
+			if err != nil {
+				slog.Debug("Failed to cancel download", "err", err)
+			}
+		}
+		select {
+		case starts <- e:
+		default:
+		}
+	})()
+	if c.opt.VerifyDownloads {
+		c.downloadProgress = make(chan *proto.BrowserDownloadProgress, 100)
+		progress := c.downloadProgress
+		go browser.EachEvent(func(e *proto.BrowserDownloadProgress) {
+			select {
+			case progress <- e:
+			default:
+			}
+		})()
+	}
+	return nil
+}
+
+// Forget about any downloads started so far
+func (c *Client) drainDownloads() {
+	for {
+		select {
+		case <-c.downloadStarts:
+		case <-c.downloadProgress:
+		default:
+			return
+		}
+	}
+}
+
+// Wait for the browser to say the download it has just started has
+// completed
+//
+// It fails if the download is cancelled, is empty or makes no progress
+// for Options.TimeDownloadStall.
+func (c *Client) verifyDownload(subLog *slog.Logger) error {
+	stall := time.NewTimer(c.opt.TimeDownloadStall)
+	defer stall.Stop()
+	for {
+		select {
+		case p := <-c.downloadProgress:
+			switch p.State {
+			case proto.BrowserDownloadProgressStateCompleted:
+				if p.ReceivedBytes <= 0 {
+					return fmt.Errorf("browser downloaded an empty file")
+				}
+				subLog.Debug("Download completed", "bytes", int64(p.ReceivedBytes))
+				return nil
+			case proto.BrowserDownloadProgressStateCanceled:
+				return fmt.Errorf("browser cancelled the download after %d bytes", int64(p.ReceivedBytes))
+			}
+			if !stall.Stop() {
+				<-stall.C
+			}
+			stall.Reset(c.opt.TimeDownloadStall)
+		case <-stall.C:
+			return fmt.Errorf("download made no progress for %v", c.opt.TimeDownloadStall)
+		}
+	}
+}
+
+// Wait for the browser to start a download and make a DownloadJob from it
+func (c *Client) waitDownload(b *Book) (job DownloadJob, err error) {
+	var start *proto.BrowserDownloadWillBegin
+	select {
+	case start = <-c.downloadStarts:
+	case <-time.After(downloadStartTimeout):
+		return job, fmt.Errorf("browser didn't start the download within %v", downloadStartTimeout)
+	}
+	job = DownloadJob{
+		Number:   c.book,
+		ASIN:     b.ASIN,
+		Title:    b.Title,
+		Authors:  b.Authors,
+		URL:      start.URL,
+		Filename: start.SuggestedFilename,
+		Headers:  map[string]string{},
+	}
+	cookies, err := proto.NetworkGetCookies{Urls: []string{start.URL}}.Call(c.page)
+	if err != nil {
+		return job, fmt.Errorf("failed to read cookies for download: %w", err)
+	}
+	var cookie []string
+	for _, ck := range cookies.Cookies {
+		cookie = append(cookie, ck.Name+"="+ck.Value)
+	}
+	if len(cookie) > 0 {
+		job.Headers["Cookie"] = strings.Join(cookie, "; ")
+	}
+	userAgent, err := c.page.Eval(`() => navigator.userAgent`)
+	if err == nil {
+		job.Headers["User-Agent"] = userAgent.Value.Str()
+	}
+	info, err := c.page.Info()
+	if err == nil {
+		job.Headers["Referer"] = info.URL
+	}
+	return job, nil
+}
+
+// Pass the download the browser has just started to the Downloader
+func (c *Client) handOff(job DownloadJob) error {
+	err := c.opt.Downloader.Download(context.Background(), job)
+	if err != nil {
+		return fmt.Errorf("failed to hand off download: %w", err)
+	}
+	return nil
+}
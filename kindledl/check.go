@@ -0,0 +1,84 @@
+package kindledl
+
+import (
+	"errors"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrNotLoggedIn is returned if Amazon wants the browser to log in
+var ErrNotLoggedIn = errors.New("browser is not logged in - rerun with the -login flag")
+
+// How long to look for the account name on the page
+const accountNameTimeout = 5 * time.Second
+
+// Where Amazon shows the name of the account, eg "Hello, Nick"
+const accountNameSelector = "#nav-link-accountList-nav-line-1"
+
+// CheckResult is what Check found out about a marketplace
+type CheckResult struct {
+	Marketplace string // host of the marketplace
+	Account     string // name of the account as Amazon shows it, "" if not found
+}
+
+// Check starts the browser and checks it is logged in to each
+// marketplace without downloading anything.
+//
+// It returns ErrNotLoggedIn straight away rather than waiting for the
+// user to log in.
+func Check(opt *Options) (results []CheckResult, err error) {
+	c, err := newClient(opt)
+	if err != nil {
+		return nil, err
+	}
+	c.noLoginWait = true
+	err = c.startBrowser()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	for i := 0; i < c.numMarketplaces(); i++ {
+		err = c.useMarketplace(i)
+		if err != nil {
+			return results, err
+		}
+		// ErrFinished means we are on a books page, so logged in
+		err = c.openURL(c.page, c.booksURL)
+		if err != nil && !errors.Is(err, ErrFinished) {
+			return results, err
+		}
+		result := CheckResult{
+			Marketplace: c.marketplace,
+			Account:     c.accountName(),
+		}
+		if result.Marketplace == "" {
+			u, err := url.Parse(c.booksURL)
+			if err == nil {
+				result.Marketplace = u.Host
+			}
+		}
+		slog.Debug("Checked marketplace", "marketplace", result.Marketplace, "account", result.Account)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Returns the name of the account from the page, or "" if not found
+func (c *Client) accountName() string {
+	el, err := c.page.Timeout(accountNameTimeout).Element(accountNameSelector)
+	if err != nil {
+		return ""
+	}
+	text, err := el.Text()
+	if err != nil {
+		return ""
+	}
+	text = strings.TrimSpace(text)
+	// Remove the greeting, eg "Hello, Nick"
+	if _, name, found := strings.Cut(text, ","); found {
+		text = strings.TrimSpace(name)
+	}
+	return text
+}
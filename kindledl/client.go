@@ -0,0 +1,739 @@
+// Package kindledl downloads purchased Kindle books from Amazon by
+// driving a browser through the Content & Devices pages.
+package kindledl
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Program is the name of the program
+const Program = "kindledl"
+
+// ErrFinished is returned when there are no more books to download
+var ErrFinished = errors.New("downloads finished")
+
+// ErrMaxBooks is returned when Options.MaxBooks books have been
+// downloaded in this run
+var ErrMaxBooks = errors.New("downloaded the maximum number of books for this run")
+
+// logger makes an io.Writer from slog.Debug
+type logger struct{}
+
+// Write writes len(p) bytes from p to the underlying data stream.
+func (logger) Write(p []byte) (n int, err error) {
+	s := string(p)
+	s = strings.TrimSpace(s)
+	slog.Debug(s)
+	return len(p), nil
+}
+
+// Println is called to log text
+func (logger) Println(vs ...any) {
+	s := fmt.Sprint(vs...)
+	s = strings.TrimSpace(s)
+	slog.Debug(s)
+}
+
+// Client is a single page browser for Amazon Books
+type Client struct {
+	opt              *Options
+	configRoot       string // top level config dir, typically "~/.config/"+Program
+	browserConfig    string // work directory for browser instance
+	browserPath      string // path to the browser binary
+	downloadDir      string // directory for downloads
+	stagingDir       string // directory the browser downloads into if not downloadDir
+	copyStaged       bool   // set to copy files from stagingDir rather than rename them
+	browserPrefs     string // JSON config for the browser
+	reMoreActions    *regexp.Regexp
+	reDownloadViaUSB *regexp.Regexp
+	reClearFurthest  *regexp.Regexp
+	reDownloadButton *regexp.Regexp
+	reSuccess        *regexp.Regexp
+	reShowing        *regexp.Regexp
+	reKindleName     *regexp.Regexp
+	reOrderTotal     *regexp.Regexp
+	reOrderDate      *regexp.Regexp
+	reProfileMenu    *regexp.Regexp
+	reProfile        *regexp.Regexp
+	reAuthor         *regexp.Regexp
+	reTitle          *regexp.Regexp
+	reKindles        []*regexp.Regexp // reKindleName then the regexps for the other Options.Kindles
+	kindleIndex      int              // index of the kindle being downloaded for in reKindles
+	browser          *rod.Browser
+	page             *rod.Page
+	book             int                                  // current book we are downloading
+	pageNumber       int                                  // page number we are looking at
+	offset           int                                  // current offset
+	totalBooks       int                                  // total number of books to download
+	pageBooks        []Book                               // metadata for the books on the current page
+	manifest         *Manifest                            // record of the books processed
+	orders           map[string]orderDetails              // order details read so far by order ID
+	progress         progress                             // how fast we are downloading
+	timings          stepTimings                          // how long each step of the download takes
+	counts           map[string]int                       // number of books with each status this run
+	pacer            pacer                                // controls the time between actions
+	hooks            []Hook                               // called at each event
+	selectors        map[*regexp.Regexp]string            // selector script functions to use instead of the regexps
+	overrides        map[*regexp.Regexp]string            // CSS selectors or XPaths to use instead of the regexps
+	pauser           pauser                               // for pausing the run
+	uploaded         map[string]completedFile             // files uploaded by name
+	status           runStatus                            // for the status file
+	recycledAt       int                                  // books done when the browser was last restarted
+	downloadStarts   chan *proto.BrowserDownloadWillBegin // downloads started by the browser
+	downloadProgress chan *proto.BrowserDownloadProgress  // progress of downloads with VerifyDownloads
+	captureDir       string                               // directory for cancelled downloads, if any
+	curl             string                               // curl command for the current book, if any
+	downloadURL      string                               // URL the current book was downloaded from, if known
+	collectionIDs    []string                             // IDs of Options.Collections if the content list filters by them
+	collections      map[string]string                    // IDs of the collections seen in the content list by collectionKey
+	lastASIN         string                               // ASIN of the last book done, if known
+	seen             map[string]bool                      // ASINs of the books done this run
+	marketplaceIndex int                                  // index of the marketplace in Options.Marketplaces
+	marketplace      string                               // host of the current marketplace, empty if only one
+	booksURL         string                               // Options.BooksURL for the current marketplace
+	orderURL         string                               // Options.OrderURL for the current marketplace
+	checkpoint       string                               // Options.Checkpoint for the current marketplace
+	checkpointStore  Store                                // where the checkpoint is kept
+	contentIndex     int                                  // index of the content type in Options.ContentTypes
+	content          string                               // name of the current content type, empty if not set
+	sidecar          *template.Template                   // Options.SidecarTemplate parsed, nil if not set
+	noLoginWait      bool                                 // set to fail straight away if not logged in
+	hashes           map[string]string                    // SHA-256 of the files moved from staging by name
+	runStart         time.Time                            // when the client was made or last reset
+	tar              *tar.Writer                          // writing Options.Tar, nil if not set
+	tarred           map[string]bool                      // files written to the tar by name
+	builtinHooks     int                                  // number of hooks at the start of hooks which are built in
+	post             *postPool                            // runs the post-book hooks if Options.PostWorkers is set
+	stateDB          StateDB                              // Options.StateDB opened, nil if not set
+	states           map[string]*BookState                // the books in stateDB by key
+	existing         []string                             // files in the output directory for Options.SkipOnDisk, nil if not read yet
+	stallRetries     map[string]int                       // times each book has been asked for again after stalling by ASIN
+}
+
+// Make a new Client from the options without starting the browser
+func newClient(opt *Options) (c *Client, err error) {
+	c = &Client{
+		opt:        opt,
+		book:       1,
+		totalBooks: -1,
+		orders:     map[string]orderDetails{},
+		counts:     map[string]int{},
+		pacer:      newPacer(opt.TimeActionInterval, opt.Adaptive),
+		uploaded:   map[string]completedFile{},
+		seen:       map[string]bool{},
+		hashes:     map[string]string{},
+		runStart:   time.Now(),
+	}
+	// These go first as they may move or remove files
+	if opt.Staging != "" {
+		c.AddHook(c.stagingHook)
+	}
+	c.AddHook(c.formatHook)
+	c.AddHook(c.duplicatesHook)
+	if opt.Archived {
+		c.AddHook(c.inactiveHook)
+	}
+	if opt.Periodicals {
+		c.AddHook(c.subscriptionsHook)
+	}
+	if opt.Gallery != "" {
+		c.AddHook(c.galleryHook)
+	}
+	if opt.Views != "" {
+		c.AddHook(c.viewsHook)
+	}
+	if opt.Feed != "" {
+		c.AddHook(c.feedHook)
+	}
+	if opt.Samples != "" {
+		c.AddHook(c.samplesHook)
+	}
+	if opt.StatusFile != "" {
+		c.AddHook(c.statusHook)
+	}
+	if len(opt.Uploaders) > 0 {
+		c.AddHook(c.uploadHook)
+	}
+	if opt.Tar != nil {
+		c.tar = tar.NewWriter(opt.Tar)
+		c.tarred = map[string]bool{}
+		c.AddHook(c.tarHook)
+	}
+	c.builtinHooks = len(c.hooks)
+	c.hooks = append(c.hooks, opt.Hooks...)
+
+	err = opt.checkContentTypes()
+	if err != nil {
+		return nil, err
+	}
+	err = opt.checkKindles()
+	if err != nil {
+		return nil, err
+	}
+	err = opt.checkOrder()
+	if err != nil {
+		return nil, err
+	}
+	err = opt.checkOrganizePreset()
+	if err != nil {
+		return nil, err
+	}
+	if opt.VerifyDownloads && opt.Downloader != nil {
+		return nil, errors.New("can't verify downloads which are handed off to a Downloader")
+	}
+	err = opt.checkFilenameTemplate()
+	if err != nil {
+		return nil, err
+	}
+	c.useContentType(0)
+
+	c.configRoot, err = ConfigRoot(opt)
+	if err != nil {
+		return nil, err
+	}
+	c.browserConfig = filepath.Join(c.configRoot, "browser")
+	err = os.MkdirAll(c.browserConfig, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("config directory creation: %w", err)
+	}
+	slog.Debug("Configured config", "config_root", c.configRoot, "browser_config", c.browserConfig)
+
+	c.downloadDir, err = filepath.Abs(opt.Output)
+	if err != nil {
+		return nil, fmt.Errorf("download directory absolute path: %w", err)
+	}
+	err = os.MkdirAll(c.downloadDir, 0777)
+	if err != nil {
+		return nil, fmt.Errorf("download directory creation: %w", err)
+	}
+	slog.Info("Created download directory", "download_directory", c.downloadDir)
+
+	if opt.VerifyCopy && opt.Staging == "" {
+		return nil, errors.New("need a staging directory to verify copies")
+	}
+	if opt.Staging != "" {
+		c.stagingDir, err = filepath.Abs(opt.Staging)
+		if err != nil {
+			return nil, fmt.Errorf("staging directory absolute path: %w", err)
+		}
+		err = os.MkdirAll(c.stagingDir, 0777)
+		if err != nil {
+			return nil, fmt.Errorf("staging directory creation: %w", err)
+		}
+		// Files in the output directory are taken to be books, so
+		// staging can only be inside it if it is hidden
+		rel, err := filepath.Rel(c.downloadDir, c.stagingDir)
+		first := strings.Split(filepath.ToSlash(rel), "/")[0]
+		if err == nil && (rel == "." || (first != ".." && !strings.HasPrefix(first, "."))) {
+			return nil, fmt.Errorf("staging directory %q can't be inside the output directory unless it is hidden, eg %s", opt.Staging, filepath.Join(opt.Output, ".staging"))
+		}
+		slog.Debug("Created staging directory", "staging_directory", c.stagingDir)
+		err = c.setupStagingMove()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Find the browser
+	var ok bool
+	c.browserPath, ok = launcher.LookPath()
+	if !ok && opt.Container {
+		return nil, errors.New("browser not found - install chromium in the container image")
+	} else if !ok {
+		return nil, errors.New("browser not found")
+	}
+	slog.Debug("Found browser", "browser_path", c.browserPath)
+	if opt.Container {
+		err = checkBrowser(c.browserPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Browser preferences
+	pref := map[string]any{
+		"download": map[string]any{
+			"default_directory": c.browserDownloadDir(),
+		},
+	}
+	prefJSON, err := json.Marshal(pref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make preferences: %w", err)
+	}
+	c.browserPrefs = string(prefJSON)
+	slog.Debug("made browser preferences", "prefs", c.browserPrefs)
+
+	// Compile regexps from messages
+	for _, msg := range []struct {
+		re  **regexp.Regexp
+		txt string
+	}{
+		{&c.reMoreActions, opt.MsgMoreActions},
+		{&c.reDownloadViaUSB, opt.MsgDownloadViaUSB},
+		{&c.reClearFurthest, opt.MsgClearFurthest},
+		{&c.reDownloadButton, opt.MsgDownloadButton},
+		{&c.reSuccess, opt.MsgSuccess},
+		{&c.reShowing, opt.MsgShowing},
+		{&c.reKindleName, opt.kindles()[0]},
+		{&c.reOrderTotal, opt.MsgOrderTotal},
+		{&c.reOrderDate, opt.MsgOrderDate},
+		{&c.reProfileMenu, opt.MsgProfileMenu},
+		{&c.reProfile, opt.Profile},
+	} {
+		*msg.re, err = regexp.Compile(`(?i)^\s*` + msg.txt + `\s*$`)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile match string %q as regexp: %w", msg.txt, err)
+		}
+	}
+	if opt.Author != "" {
+		c.reAuthor, err = regexp.Compile(`(?i)` + opt.Author)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile author %q as regexp: %w", opt.Author, err)
+		}
+	}
+	if opt.Title != "" {
+		c.reTitle, err = regexp.Compile(`(?i)` + opt.Title)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile title %q as regexp: %w", opt.Title, err)
+		}
+	}
+
+	err = c.loadSelectors()
+	if err != nil {
+		return nil, err
+	}
+	err = c.compileKindles()
+	if err != nil {
+		return nil, err
+	}
+
+	if opt.SidecarTemplate != "" {
+		c.sidecar, err = parseSidecar(opt.SidecarTemplate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// New creates a new browser on the books main page to check we are logged in
+func New(opt *Options) (*Client, error) {
+	c, err := newClient(opt)
+	if err != nil {
+		return nil, err
+	}
+	c.manifest, err = opt.ReadManifest()
+	if err != nil {
+		return nil, err
+	}
+	err = c.openStateDB()
+	if err != nil {
+		return nil, err
+	}
+	if c.stagingDir != "" {
+		// Finish off any downloads left by the last run
+		c.unstage(false)
+	}
+	err = c.reconcileJournal()
+	if err != nil {
+		c.closeStateDB()
+		return nil, err
+	}
+	err = c.startBrowser()
+	if err != nil {
+		c.closeStateDB()
+		return nil, err
+	}
+	// Work out where we are starting from
+	err = c.startContentType(0)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	slog.Info("Starting downloads", "book", c.book)
+	c.progress.start(opt.StatusInterval)
+	return c, nil
+}
+
+// Reset gets the client ready for another Run with the same browser,
+// eg in a daemon. It checks the browser still works and is logged in,
+// clears the counts of the last run and works out where to start from
+// again.
+func (c *Client) Reset() error {
+	c.counts = map[string]int{}
+	c.seen = map[string]bool{}
+	c.existing = nil
+	c.stallRetries = nil
+	c.timings = stepTimings{}
+	c.runStart = time.Now()
+	c.useContentType(0)
+	err := c.useMarketplace(0)
+	if err != nil {
+		return err
+	}
+	err = c.openURL(c.page, c.booksURL)
+	if err != nil {
+		return err
+	}
+	err = c.startContentType(0)
+	if err != nil {
+		return err
+	}
+	slog.Info("Starting downloads", "book", c.book)
+	c.progress.start(c.opt.StatusInterval)
+	return nil
+}
+
+// Manifest returns the record of the books processed
+func (c *Client) Manifest() *Manifest {
+	return c.manifest
+}
+
+// loadCheckpoint loads the current book position from the checkpoint file
+//
+// The checkpoint has the number of the next book to do, optionally
+// followed by the ASIN of the last book done.
+func (c *Client) loadCheckpoint() error {
+	c.lastASIN = ""
+	err := loadState(c.checkpointStore, "checkpoint", func(data []byte) error {
+		fields := strings.Fields(string(data))
+		if len(fields) == 0 {
+			return fmt.Errorf("checkpoint %q is empty", c.checkpoint)
+		}
+		book, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return fmt.Errorf("failed to convert checkpoint %q content to integer: %w", c.checkpoint, err)
+		}
+		c.book = book
+		c.lastASIN = ""
+		if len(fields) > 1 {
+			c.lastASIN = fields[1]
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		c.book = max(c.opt.FirstBook, 1)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read checkpoint %q: %w", c.checkpoint, err)
+	}
+	// Keep the checkpoint within the -book-range
+	if c.opt.FirstBook > 0 && (c.book < c.opt.FirstBook || c.book > c.opt.LastBook+1) {
+		slog.Info("Checkpoint outside -book-range - starting from beginning of range", "checkpoint", c.book, "book", c.opt.FirstBook)
+		c.book = c.opt.FirstBook
+		c.lastASIN = ""
+	}
+	return nil
+}
+
+// saveCheckpoint saves the current book position to the checkpoint file
+//
+// Nothing is saved if the state database is in use as it replaces the
+// checkpoint.
+func (c *Client) saveCheckpoint() error {
+	if c.stateDB != nil {
+		return nil
+	}
+	data := []byte(strconv.Itoa(c.book))
+	if c.lastASIN != "" {
+		data = fmt.Appendf(data, " %s", c.lastASIN)
+	}
+	err := c.checkpointStore.Save(data)
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint %q: %w", c.checkpoint, err)
+	}
+	return nil
+}
+
+// Returns the number of books left to do after this one, or -1 if not known
+func (c *Client) remaining() int {
+	last := c.totalBooks
+	if c.opt.LastBook > 0 && (last < 0 || c.opt.LastBook < last) {
+		last = c.opt.LastBook
+	}
+	if last < 0 {
+		return -1
+	}
+	return max(last-c.book, 0)
+}
+
+// Set the position to book, working out the page and offset
+func (c *Client) seekBook(book int) {
+	c.book = book
+	// c.page and c.pageNumber are 1 based
+	// c.offset is 0 based
+	c.pageNumber = (c.book-1)/c.opt.BooksPerPage + 1
+	c.offset = (c.book - 1) % c.opt.BooksPerPage
+}
+
+// Move on to the next book and save the checkpoint
+//
+// b is the book just done, which is remembered by ASIN so the
+// position can be checked if the library changes.
+func (c *Client) nextBook(b *Book) error {
+	c.book++
+	if b.ASIN != "" {
+		c.lastASIN = b.ASIN
+		c.seen[b.ASIN] = true
+	}
+	return c.saveCheckpoint()
+}
+
+// Returns the URL for the current page number
+func (c *Client) pageURL() string {
+	u := fmt.Sprintf("%s?pageNumber=%d", c.booksURL, c.pageNumber)
+	if c.opt.Search != "" {
+		u += "&searchText=" + url.QueryEscape(c.opt.Search)
+	}
+	if len(c.collectionIDs) > 0 {
+		u += "&collectionIds=" + url.QueryEscape(strings.Join(c.collectionIDs, ","))
+	}
+	return u
+}
+
+// start the browser off and check it is authenticated
+//
+// If this fails after the browser has started the browser is stopped
+// again so it isn't left running.
+func (c *Client) startBrowser() (err error) {
+	// We use the default profile in our new data directory
+	l := launcher.New().
+		Bin(c.browserPath).
+		Headless(!c.opt.Show).
+		UserDataDir(c.browserConfig).
+		Preferences(c.browserPrefs).
+		Set("disable-gpu").
+		Set("disable-audio-output").
+		Logger(logger{})
+	if c.opt.Container {
+		l = containerFlags(l)
+	}
+	if c.opt.LowMemory {
+		l = lowMemoryFlags(l)
+	}
+	if c.opt.Stealth {
+		l = l.Set("disable-blink-features", "AutomationControlled")
+	}
+	if c.opt.WindowWidth > 0 && c.opt.WindowHeight > 0 {
+		l = l.Set("window-size", fmt.Sprintf("%d,%d", c.opt.WindowWidth, c.opt.WindowHeight))
+	}
+	if c.opt.DeviceScale > 0 {
+		l = l.Set("force-device-scale-factor", strconv.FormatFloat(c.opt.DeviceScale, 'f', -1, 64))
+	}
+
+	url, err := l.Launch()
+	if err != nil {
+		return fmt.Errorf("browser launch: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			l.Kill()
+			slog.Debug("Stopped browser after failing to start it", "err", err)
+		}
+	}()
+
+	c.browser = rod.New().
+		ControlURL(url).
+		NoDefaultDevice().
+		Trace(c.opt.Debug).
+		Logger(logger{})
+
+	err = c.browser.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to browser: %w", err)
+	}
+
+	c.page, err = c.browser.Page(proto.TargetCreateTarget{})
+	if err != nil {
+		return fmt.Errorf("failed to open new browser page: %w", err)
+	}
+
+	err = c.setupPage(c.page)
+	if err != nil {
+		return err
+	}
+
+	if c.captureDownloads() {
+		err = c.watchDownloads()
+		if err != nil {
+			return err
+		}
+	} else if c.content != "" || c.kindleDir() != "" {
+		err = c.setDownloadBehavior(c.browserDownloadDir())
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.loadSelectorScript()
+	if err != nil {
+		return err
+	}
+
+	// Log the page lifecycle events, but only when debugging as
+	// it isn't free.
+	if c.opt.Debug {
+		eventCallback := func(e *proto.PageLifecycleEvent) {
+			slog.Debug("Event", "Name", e.Name, "Dump", e)
+		}
+		go c.page.EachEvent(eventCallback)()
+	}
+	return nil
+}
+
+// Set the viewport of the page to the window size, if set
+//
+// Headless browsers don't always size the viewport from the window.
+func (c *Client) setViewport(page *rod.Page) error {
+	if c.opt.WindowWidth <= 0 || c.opt.WindowHeight <= 0 {
+		return nil
+	}
+	err := page.SetViewport(&proto.EmulationSetDeviceMetricsOverride{
+		Width:             c.opt.WindowWidth,
+		Height:            c.opt.WindowHeight,
+		DeviceScaleFactor: c.opt.DeviceScale,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set window size: %w", err)
+	}
+	return nil
+}
+
+// Opens the current page with 25 books on
+func (c *Client) openPage() (err error) {
+	return c.openURL(c.page, c.pageURL())
+}
+
+// Open the first page of the library if a library page isn't open already
+//
+// This is needed to make the AJAX calls.
+func (c *Client) openLibrary(ctx context.Context) error {
+	info, err := c.page.Info()
+	if err == nil && strings.HasPrefix(info.URL, c.booksURL) {
+		return nil
+	}
+	err = c.openURL(c.page.Context(ctx), c.booksURL)
+	if err != nil {
+		return fmt.Errorf("failed to open library: %w", err)
+	}
+	return nil
+}
+
+// Open url on page checking we are authenticated
+func (c *Client) openURL(page *rod.Page, url string) (err error) {
+	c.pacer.pause()
+	err = page.Navigate(url)
+	if err != nil {
+		return fmt.Errorf("couldn't open books URL %q: %w", url, classifyNetworkError(err))
+	}
+
+	err = page.WaitLoad()
+	if err != nil {
+		return fmt.Errorf("books page load: %w", err)
+	}
+
+	authenticated := false
+	for try := 0; try < 60; try++ {
+		time.Sleep(c.opt.TimeRetrySleep)
+		info := page.MustInfo()
+		slog.Debug("URL", "url", info.URL)
+		// When not authenticated Amazon redirects away from the Books URL
+		if info.URL == url {
+			authenticated = true
+			slog.Debug("Authenticated")
+			break
+		}
+		// Chrome shows its own error page if Amazon can't be reached
+		if strings.HasPrefix(info.URL, chromeErrorURL) {
+			return fmt.Errorf("couldn't open books URL %q: %w", url, ErrOffline)
+		}
+		// However if we select beyond the end, then we get redirected back to a previous page
+		if strings.HasPrefix(info.URL, c.booksURL) {
+			return ErrFinished
+		}
+		if c.noLoginWait {
+			return ErrNotLoggedIn
+		}
+		if try == 0 {
+			reason := errors.New("login required")
+			if strings.Contains(strings.ToLower(info.URL), "captcha") {
+				reason = errors.New("CAPTCHA needs solving")
+			}
+			err = c.fireEvent(EventAttention, nil, "", reason)
+			if err != nil {
+				return err
+			}
+		}
+		slog.Info("Amazon wants the browser to log in - please log in, or re-run with -login flag", "url", info.URL)
+	}
+	if !authenticated {
+		return ErrNotLoggedIn
+	}
+	return nil
+}
+
+// Close the browser
+func (c *Client) Close() {
+	err := c.browser.Close()
+	if err == nil {
+		slog.Debug("Closed browser")
+	} else {
+		slog.Error("Failed to close browser", "err", err)
+	}
+	if c.captureDir != "" {
+		_ = os.RemoveAll(c.captureDir)
+		c.captureDir = ""
+	}
+	c.stopPostPool()
+	c.closeTar()
+	c.closeStateDB()
+}
+
+// Login runs the browser standalone so the user can log in to Amazon
+func Login(opt *Options) error {
+	c, err := newClient(opt)
+	if err != nil {
+		return err
+	}
+	urls, err := c.marketplaceURLs()
+	if err != nil {
+		return err
+	}
+	if len(urls) > 1 {
+		slog.Info("Log in to each amazon marketplace in the tabs of the browser that pops up, close it, then re-run this without the -login flag")
+	} else {
+		slog.Info("Log in to amazon with the browser that pops up, close it, then re-run this without the -login flag")
+	}
+	cmd := exec.Command(c.browserPath, append([]string{"--user-data-dir=" + c.browserConfig}, urls...)...)
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start browser: %w", err)
+	}
+	slog.Info("Waiting for browser to be closed")
+	err = cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("browser run failed: %w", err)
+	}
+	slog.Info("Now restart this program without -login")
+	return nil
+}
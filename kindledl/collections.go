@@ -0,0 +1,132 @@
+package kindledl
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+)
+
+// Returns whether the book is in any of the collections
+func inCollections(b *Book, collections []string) bool {
+	for _, want := range collections {
+		for _, have := range b.Collections {
+			if strings.EqualFold(strings.TrimSpace(have), strings.TrimSpace(want)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Set up the content list to only list the books in
+// Options.Collections if it can, so the other books aren't paged
+// through.
+//
+// The IDs of the collections are found from the collections the books
+// are in. If they can't be found, or the content list doesn't filter
+// by them, each book is checked by wanted instead.
+func (c *Client) useCollections(ctx context.Context) error {
+	c.collectionIDs = nil
+	if len(c.opt.Collections) == 0 {
+		return nil
+	}
+	ids, err := c.findCollectionIDs(ctx)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		slog.Warn("Couldn't find the IDs of the collections - checking the collections of each book instead", "collections", c.opt.Collections)
+		return nil
+	}
+	c.collectionIDs = ids
+	books, err := c.fetchItems(ctx, c.contentFilter(), 0, listBatchSize)
+	if err == nil && len(books) == 0 {
+		return nil
+	}
+	for i := range books {
+		if !inCollections(&books[i], c.opt.Collections) {
+			err = errNotFiltered
+			break
+		}
+	}
+	if err != nil {
+		slog.Info("Content list doesn't filter by collection - checking the collections of each book instead", "err", err)
+		c.collectionIDs = nil
+		return nil
+	}
+	slog.Debug("Filtering content list by collection", "collections", c.opt.Collections, "ids", ids)
+	return nil
+}
+
+// Returned when the content list returns books it should have filtered
+// out
+var errNotFiltered = errors.New("content list returned books not in the collections")
+
+// Returns the key for the collection name in Client.collections
+func collectionKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// Returns the IDs of the collections in Options.Collections seen so
+// far and whether all of them have been seen
+func (c *Client) wantedCollectionIDs() (ids []string, all bool) {
+	all = true
+	for _, name := range c.opt.Collections {
+		if id, ok := c.collections[collectionKey(name)]; ok {
+			ids = append(ids, id)
+		} else {
+			all = false
+		}
+	}
+	return ids, all
+}
+
+// Find the IDs of Options.Collections from the collections the books
+// in the library are in, stopping as soon as they are all found
+func (c *Client) findCollectionIDs(ctx context.Context) (ids []string, err error) {
+	c.collections = map[string]string{}
+	it := c.ListBooks(ctx)
+	it.filter = c.contentFilter()
+	for it.Next() {
+		if _, all := c.wantedCollectionIDs(); all {
+			break
+		}
+	}
+	err = it.Err()
+	if err != nil {
+		return nil, err
+	}
+	ids, _ = c.wantedCollectionIDs()
+	return ids, nil
+}
+
+// Check the books on the page opened with the collection filter are the
+// ones the content list returned for it. If they aren't the books page
+// doesn't filter by collection, so stop filtering and check each book
+// instead, returning true if the page needs opening again.
+func (c *Client) checkCollectionPage(subLog *slog.Logger, rows []pageRow) bool {
+	if c.collectionIDs == nil {
+		return false
+	}
+	filtered := len(rows) > 0
+	for _, row := range rows {
+		if row.asin == "" {
+			// Can't tell which book the row is so play safe
+			filtered = false
+			break
+		}
+		b := c.pageBook(0, row.asin)
+		if !inCollections(&b, c.opt.Collections) {
+			filtered = false
+			break
+		}
+	}
+	if filtered {
+		return false
+	}
+	subLog.Info("Books page doesn't filter by collection - checking the collections of each book instead")
+	c.collectionIDs = nil
+	c.seekBook(c.book)
+	return true
+}
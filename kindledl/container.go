@@ -0,0 +1,51 @@
+package kindledl
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod/lib/launcher"
+)
+
+// Where things go in a container, expected to be volumes
+const (
+	ContainerOutput    = "/downloads"
+	ContainerConfigDir = "/config"
+)
+
+// How long to give the browser to start when checking it works
+const browserCheckTimeout = time.Minute
+
+// Chrome flags needed to run in a container
+//
+// There is no user namespace to sandbox with and /dev/shm is usually
+// too small for Chrome.
+func containerFlags(l *launcher.Launcher) *launcher.Launcher {
+	return l.NoSandbox(true).Set("disable-dev-shm-usage")
+}
+
+// Check the headless browser actually runs in the container, as a
+// browser which is missing libraries or fonts fails in obscure ways
+// later.
+func checkBrowser(browserPath string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), browserCheckTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, browserPath,
+		"--headless",
+		"--no-sandbox",
+		"--disable-dev-shm-usage",
+		"--disable-gpu",
+		"--dump-dom",
+		"about:blank",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("browser %q doesn't run in this container - check it and its libraries are installed: %w: %s", browserPath, err, strings.TrimSpace(string(out)))
+	}
+	slog.Debug("Browser works in the container", "browser_path", browserPath)
+	return nil
+}
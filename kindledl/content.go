@@ -0,0 +1,189 @@
+package kindledl
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Content types which can be downloaded, for Options.ContentTypes
+const (
+	ContentBooks       = "books"       // Kindle books
+	ContentDocs        = "docs"        // personal documents, eg sent with Send to Kindle
+	ContentComics      = "comics"      // comics and graphic novels
+	ContentPeriodicals = "periodicals" // newspaper and magazine issues
+)
+
+// contentType describes where to find a kind of content
+type contentType struct {
+	list   string     // name of the content list in the books URL, eg booksPurchases
+	filter itemFilter // to fetch the metadata of the items in the list
+}
+
+// The content types by name
+var contentTypes = map[string]contentType{
+	ContentBooks: {
+		list:   "booksPurchases",
+		filter: activeItems,
+	},
+	ContentDocs: {
+		list: "pdocs",
+		filter: itemFilter{
+			contentType: "KindlePDoc",
+			category:    "pdocs",
+			statuses:    []string{"Active"},
+			origins:     []string{"Purchase"},
+			search:      true,
+			collections: true,
+		},
+	},
+	ContentComics: {
+		list: "comics",
+		filter: itemFilter{
+			contentType: "Ebook",
+			category:    "comics",
+			statuses:    []string{"Active"},
+			origins:     []string{"Purchase", "KindleUnlimited", "Prime"},
+			search:      true,
+			collections: true,
+		},
+	},
+	ContentPeriodicals: {
+		list:   "newsstandSubscriptions",
+		filter: subscriptionItems,
+	},
+}
+
+// ContentTypeNames returns the names of the content types which can
+// be used in Options.ContentTypes, sorted
+func ContentTypeNames() []string {
+	names := make([]string, 0, len(contentTypes))
+	for name := range contentTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check the content types in the options are known
+func (opt *Options) checkContentTypes() error {
+	for _, name := range opt.ContentTypes {
+		if _, ok := contentTypes[name]; !ok {
+			return fmt.Errorf("unknown content type %q - use one of %s", name, strings.Join(ContentTypeNames(), ", "))
+		}
+	}
+	for name := range opt.ContentDirs {
+		if _, ok := contentTypes[name]; !ok {
+			return fmt.Errorf("unknown content type %q for directory - use one of %s", name, strings.Join(ContentTypeNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// Return rawURL with the name of its content list replaced by list
+//
+// The content list name is the part of the path after contentlist,
+// eg booksPurchases in .../contentlist/booksPurchases/dateAsc/
+func withContentList(rawURL, list string) (string, error) {
+	const marker = "/contentlist/"
+	i := strings.Index(rawURL, marker)
+	if i < 0 {
+		return "", fmt.Errorf("no %q in URL %q", marker, rawURL)
+	}
+	start := i + len(marker)
+	end := strings.IndexAny(rawURL[start:], "/?#")
+	if end < 0 {
+		end = len(rawURL) - start
+	}
+	return rawURL[:start] + list + rawURL[start+end:], nil
+}
+
+// Returns whether there is another content type to do after this one
+func (c *Client) moreContentTypes() bool {
+	return c.contentIndex+1 < len(c.opt.ContentTypes)
+}
+
+// Returns the number of content types to do
+func (c *Client) numContentTypes() int {
+	return max(len(c.opt.ContentTypes), 1)
+}
+
+// Use content type i for the URLs and checkpoint made by
+// useMarketplace
+func (c *Client) useContentType(i int) {
+	c.contentIndex = i
+	c.content = ""
+	if len(c.opt.ContentTypes) > 0 {
+		c.content = c.opt.ContentTypes[i]
+	}
+}
+
+// Set up to download content type i, starting with the first
+// marketplace, and point the browser's downloads at its directory.
+func (c *Client) startContentType(i int) error {
+	c.useContentType(i)
+	if c.content == "" {
+		return c.startMarketplace(0)
+	}
+	slog.Info("Starting content type", "content", c.content, "dir", c.contentDir())
+	if c.browser != nil && c.opt.Downloader == nil {
+		err := c.setDownloadBehavior(c.browserDownloadDir())
+		if err != nil {
+			return err
+		}
+	}
+	return c.startMarketplace(0)
+}
+
+// Returns the filter to fetch the metadata for the current content type
+func (c *Client) contentFilter() itemFilter {
+	if c.content == "" {
+		return activeItems
+	}
+	return contentTypes[c.content].filter
+}
+
+// Returns the subdirectory of Output for the current content type, /
+// separated, or "" if content types aren't in use
+func (c *Client) contentDir() string {
+	return contentDir(c.opt, c.content)
+}
+
+// Returns the subdirectory of Output for content, / separated, or ""
+// if content is ""
+func contentDir(opt *Options, content string) string {
+	if content == "" {
+		return ""
+	}
+	if dir, ok := opt.ContentDirs[content]; ok {
+		return path.Clean(filepath.ToSlash(dir))
+	}
+	return content
+}
+
+// Returns the directory the browser should download into
+func (c *Client) browserDownloadDir() string {
+	dir := c.downloadDir
+	if c.stagingDir != "" {
+		dir = c.stagingDir
+	}
+	return filepath.Join(dir, c.kindleDir(), filepath.FromSlash(c.contentDir()))
+}
+
+// Tell the browser to download into dir
+func (c *Client) setDownloadBehavior(dir string) error {
+	err := proto.BrowserSetDownloadBehavior{
+		Behavior:      proto.BrowserSetDownloadBehaviorBehaviorAllow,
+		DownloadPath:  dir,
+		EventsEnabled: c.captureDownloads(),
+	}.Call(c.browser)
+	if err != nil {
+		return fmt.Errorf("failed to set download behaviour: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package kindledl
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// How many times to try copying a file which fails verification
+const copyTries = 3
+
+// How to move books from the staging directory to the output
+// directory, for Options.StagingMove
+const (
+	MoveAuto   = "auto"   // rename, or copy if they are on different filesystems
+	MoveRename = "rename" // always rename
+	MoveCopy   = "copy"   // always copy
+)
+
+// Returns whether the files in the directory src can be renamed into
+// the directory dst, which they can't if they are on different
+// filesystems.
+//
+// This checks by renaming a temporary file across which works on all
+// platforms.
+func canRename(src, dst string) (bool, error) {
+	tmp, err := os.CreateTemp(src, "."+Program+"-rename-*.tmp")
+	if err != nil {
+		return false, err
+	}
+	_ = tmp.Close()
+	moved := filepath.Join(dst, filepath.Base(tmp.Name()))
+	err = os.Rename(tmp.Name(), moved)
+	if err != nil {
+		slog.Debug("Can't rename between directories", "src", src, "dst", dst, "err", err)
+		_ = os.Remove(tmp.Name())
+		return false, nil
+	}
+	_ = os.Remove(moved)
+	return true, nil
+}
+
+// Move src to dst by copying it as copyFile does then removing src
+func moveCopy(src, dst string) error {
+	err := copyFile(src, dst, "")
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// Move src to dst by copying it, checking the copy has the SHA-256
+// hash by reading it back and copying it again if it doesn't.
+//
+// This catches silent truncation on network filesystems. src is
+// removed once the copy is good.
+func moveVerified(src, dst, hash string) error {
+	var err error
+	for try := 1; try <= copyTries; try++ {
+		err = copyFile(src, dst, hash)
+		if err == nil {
+			return os.Remove(src)
+		}
+		if try < copyTries {
+			slog.Warn("Copy failed - trying again", "file", dst, "try", try, "err", err)
+		}
+	}
+	return fmt.Errorf("failed to copy after %d tries: %w", copyTries, err)
+}
+
+// Copy src to dst, checking the copy has the SHA-256 hash if set
+//
+// The copy is written to a hidden temporary file next to dst which is
+// synced, and read back if checking the hash, before being renamed to
+// dst, so dst is never partial or wrong.
+func copyFile(src, dst, hash string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(dst)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	_, err = io.Copy(tmp, in)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpName, 0644)
+	}
+	if err == nil {
+		err = os.Chtimes(tmpName, info.ModTime(), info.ModTime())
+	}
+	if err == nil && hash != "" {
+		err = checkHash(tmpName, hash)
+	}
+	if err == nil {
+		err = os.Rename(tmpName, dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// Check the file at path has the SHA-256 hash
+func checkHash(path, hash string) error {
+	got, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if got != hash {
+		return fmt.Errorf("copy has SHA-256 %s but should have %s", got, hash)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package kindledl
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of the months, and their abbreviations, in the languages of the
+// built-in locales so the dates Amazon shows can be read
+var monthNames = map[string]time.Month{}
+
+func init() {
+	for _, names := range [][]string{
+		{"january", "february", "march", "april", "may", "june", "july", "august", "september", "october", "november", "december"},
+		{"januar", "februar", "märz", "april", "mai", "juni", "juli", "august", "september", "oktober", "november", "dezember"},
+		{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+	} {
+		for i, name := range names {
+			month := time.Month(i + 1)
+			monthNames[name] = month
+			if runes := []rune(name); len(runes) > 3 {
+				monthNames[string(runes[:3])] = month
+			}
+		}
+	}
+	// Abbreviations which aren't the first three letters
+	monthNames["sept"] = time.September
+	monthNames["janv"] = time.January
+	monthNames["févr"] = time.February
+	monthNames["juil"] = time.July
+}
+
+// Matches the words and numbers in a date
+var reDateParts = regexp.MustCompile(`\p{L}+|\d+`)
+
+// Parse a date as Amazon shows it, eg "1 January 2020", "January 1,
+// 2020", "1. Januar 2020", "1 de enero de 2020" or "2020-01-01".
+//
+// Dates given only as numbers must be year first or year last with the
+// day before the month.
+func parseDate(s string) (time.Time, error) {
+	var numbers []int
+	var month time.Month
+	yearFirst := false
+	for _, part := range reDateParts.FindAllString(strings.ToLower(s), -1) {
+		if n, err := strconv.Atoi(part); err == nil {
+			if len(numbers) == 0 && len(part) == 4 {
+				yearFirst = true
+			}
+			numbers = append(numbers, n)
+		} else if m, ok := monthNames[part]; ok && month == 0 {
+			month = m
+		}
+	}
+	var year, day int
+	switch {
+	case month != 0 && len(numbers) == 2 && yearFirst:
+		year, day = numbers[0], numbers[1]
+	case month != 0 && len(numbers) == 2:
+		day, year = numbers[0], numbers[1]
+	case month == 0 && len(numbers) == 3 && yearFirst:
+		year, month, day = numbers[0], time.Month(numbers[1]), numbers[2]
+	case month == 0 && len(numbers) == 3:
+		day, month, year = numbers[0], time.Month(numbers[1]), numbers[2]
+	default:
+		return time.Time{}, fmt.Errorf("can't read date %q", s)
+	}
+	if year < 1000 || month < time.January || month > time.December || day < 1 || day > 31 {
+		return time.Time{}, fmt.Errorf("can't read date %q", s)
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC), nil
+}
+
+// Check the date the book was acquired against Options.Since and
+// Options.Until, returning -1 if it is before the range, 0 if it is in
+// it and +1 if it is after it.
+func (c *Client) acquiredRange(b *Book) (int, error) {
+	if c.opt.Since.IsZero() && c.opt.Until.IsZero() {
+		return 0, nil
+	}
+	if b.Acquired == "" {
+		return 0, fmt.Errorf("can't filter books by date as the date acquired couldn't be read")
+	}
+	acquired, err := parseDate(b.Acquired)
+	if err != nil {
+		return 0, fmt.Errorf("can't filter books by date: %w", err)
+	}
+	if !c.opt.Since.IsZero() && acquired.Before(dateOnly(c.opt.Since)) {
+		return -1, nil
+	}
+	if !c.opt.Until.IsZero() && acquired.After(dateOnly(c.opt.Until)) {
+		return +1, nil
+	}
+	return 0, nil
+}
+
+// Returns t as a date in UTC, dropping the time of day
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,134 @@
+package kindledl
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Device is a kindle Amazon offers to download books for
+type Device struct {
+	Marketplace string // host of the marketplace
+	Name        string // name of the device as Amazon shows it
+}
+
+// Devices starts the browser and opens the download menu of a book in
+// each marketplace to list the kindles books can be downloaded for,
+// without downloading anything.
+//
+// It returns ErrNotLoggedIn straight away rather than waiting for the
+// user to log in.
+func Devices(opt *Options) (devices []Device, err error) {
+	c, err := newClient(opt)
+	if err != nil {
+		return nil, err
+	}
+	c.noLoginWait = true
+	err = c.startBrowser()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	for i := 0; i < c.numMarketplaces(); i++ {
+		err = c.useMarketplace(i)
+		if err != nil {
+			return devices, err
+		}
+		// ErrFinished means we are on a books page, so logged in
+		err = c.openURL(c.page, c.booksURL)
+		if err != nil && !errors.Is(err, ErrFinished) {
+			return devices, err
+		}
+		marketplace := c.marketplace
+		if marketplace == "" {
+			u, err := url.Parse(c.booksURL)
+			if err == nil {
+				marketplace = u.Host
+			}
+		}
+		subLog := slog.Default().With("marketplace", marketplace)
+		names, err := c.kindleNames(subLog)
+		if err != nil {
+			return devices, err
+		}
+		for _, name := range names {
+			devices = append(devices, Device{
+				Marketplace: marketplace,
+				Name:        name,
+			})
+		}
+	}
+	return devices, nil
+}
+
+// Open the download menu of the first book on the page which has one
+// and return the names of the kindles in it
+func (c *Client) kindleNames(subLog *slog.Logger) ([]string, error) {
+	c.dismissOverlays(subLog)
+	actions, err := c.findElementWithText(subLog, "span", c.reMoreActions)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't find books (-msg-more-actions=%q): %w", c.opt.MsgMoreActions, err)
+	}
+	if len(actions) == 0 {
+		return nil, errors.New("no books found on page to list the kindles")
+	}
+	for _, action := range actions {
+		err = action.ScrollIntoView()
+		if err != nil {
+			return nil, fmt.Errorf("error scrolling button into view: %w", err)
+		}
+		time.Sleep(c.opt.TimeScrollPause)
+		err = c.click(action)
+		if err != nil {
+			return nil, fmt.Errorf("error clicking on more actions: %w", err)
+		}
+		clearFurthest, err := c.findOneElementWithText(subLog, "span", c.reClearFurthest)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't find popup menu (-msg-clear-furthest=%q): %w", c.opt.MsgClearFurthest, err)
+		}
+		// Samples don't have a download link so try the next book
+		menu, err := c.findOneElementWithText(subLog, "span", c.reDownloadViaUSB)
+		if errors.Is(err, errNoneFound) {
+			subLog.Debug("Book has no download link - trying the next")
+			err = c.dismissMenu(clearFurthest)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("couldn't find popup menu (-msg-download-usb=%q): %w", c.opt.MsgDownloadViaUSB, err)
+		}
+		err = c.click(menu)
+		if err != nil {
+			return nil, fmt.Errorf("error clicking on Download & transfer via USB button: %w", err)
+		}
+		return c.readKindleNames(subLog)
+	}
+	return nil, fmt.Errorf("none of the %d books on the page have a (-msg-download-usb=%q) link to list the kindles", len(actions), c.opt.MsgDownloadViaUSB)
+}
+
+// Read the names of the kindles in the device dialog, waiting for it
+// to open
+func (c *Client) readKindleNames(subLog *slog.Logger) (names []string, err error) {
+	for i := 0; i < 5; i++ {
+		items, err := c.kindleItems()
+		if err != nil {
+			return nil, err
+		}
+		for _, li := range items {
+			name, err := li.Text()
+			if err != nil {
+				return nil, fmt.Errorf("couldn't read name of kindle: %w", err)
+			}
+			names = append(names, strings.TrimSpace(name))
+		}
+		if len(names) > 0 {
+			return names, nil
+		}
+		c.retrySleep(subLog)
+	}
+	return nil, errors.New("no kindles found in the download menu - register one with your Amazon account")
+}
@@ -0,0 +1,776 @@
+package kindledl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Find the elements of type with the text
+//
+// If none are found, controls whose accessible name matches the text
+// are looked for in the accessibility tree instead.
+func (c *Client) findElementWithText(subLog *slog.Logger, elementName string, match *regexp.Regexp) (found rod.Elements, err error) {
+	subLog = subLog.With(
+		"elementName", elementName,
+		"text", match.String(),
+	)
+	scriptName, useScript := c.selectors[match]
+	selector, useSelector := c.overrides[match]
+	for i := 0; i < 5; i++ {
+		if useSelector {
+			subLog.Debug("Looking for element with selector", "try", i, "selector", selector)
+			found, err = c.findBySelector(selector)
+			if err != nil {
+				return nil, err
+			}
+			if len(found) > 0 {
+				break
+			}
+			c.retrySleep(subLog)
+			continue
+		}
+		if useScript {
+			subLog.Debug("Looking for element with selector script", "try", i, "name", scriptName)
+			found, err = c.findByScript(scriptName)
+			if err != nil {
+				return nil, err
+			}
+			if len(found) > 0 {
+				break
+			}
+			c.retrySleep(subLog)
+			continue
+		}
+		subLog.Debug("Looking for element with text", "try", i)
+		elements, err := c.page.Elements(elementName)
+		if err != nil {
+			return nil, fmt.Errorf("error looking for %q with %q on page: %w", elementName, match, err)
+		}
+		for _, el := range elements {
+			elText, err := el.Text()
+			if err != nil {
+				return nil, fmt.Errorf("error looking for %q with %q in span: %w", elementName, match, err)
+			}
+			if match.MatchString(elText) {
+				found = append(found, el)
+			}
+		}
+		if len(found) > 0 {
+			break
+		}
+		found, err = c.findByAXTree(nil, match)
+		if err != nil {
+			subLog.Debug("Failed to look in accessibility tree", "err", err)
+		} else if len(found) > 0 {
+			subLog.Debug("Found element in accessibility tree", "found", len(found))
+			break
+		}
+		c.retrySleep(subLog)
+	}
+	return found, nil
+}
+
+var errNoneFound = errors.New("none found")
+
+// Wait before trying to find something on the page again, dismissing
+// any overlays which might be hiding it
+func (c *Client) retrySleep(subLog *slog.Logger) {
+	c.pacer.retry()
+	if c.dismissOverlays(subLog) {
+		return
+	}
+	time.Sleep(c.opt.TimeRetrySleep)
+}
+
+// Click on the element once the pacer allows
+func (c *Client) click(el *rod.Element) error {
+	c.pacer.pause()
+	return el.Click(proto.InputMouseButtonLeft, 1)
+}
+
+// As findOneElementWithText but returns only one
+func (c *Client) findOneElementWithText(subLog *slog.Logger, elementName string, match *regexp.Regexp) (el *rod.Element, err error) {
+	found, err := c.findElementWithText(subLog, elementName, match)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no %q containing %q found: %w", elementName, match, errNoneFound)
+	} else if len(found) != 1 {
+		return nil, fmt.Errorf("expecting 1 %q containing %q but found %d", elementName, match, len(found))
+	}
+	return found[0], err
+}
+
+// Download the n-th book with the menu passed in
+//
+// It returns the status of the book for the manifest.
+func (c *Client) downloadOneBook(subLog *slog.Logger, n int, action *rod.Element, meta *Book) (status string, err error) {
+	subLog = subLog.With(
+		"book", c.book,
+		"book_number", n+1,
+	)
+	if meta.ASIN != "" {
+		subLog = subLog.With(
+			"asin", meta.ASIN,
+			"title", meta.Title,
+		)
+	}
+
+	timer := c.timings.newBook()
+	for i := range c.reKindles {
+		status, err = c.requestForKindle(subLog, i, action, meta, timer)
+		if err != nil || status != "" {
+			return status, err
+		}
+	}
+
+	if c.opt.Downloader != nil {
+		job, err := c.waitDownload(meta)
+		if err != nil {
+			return "", err
+		}
+		if c.opt.RecordCurl {
+			c.curl = job.Curl()
+		}
+		err = c.handOff(job)
+		if err != nil {
+			return "", err
+		}
+		timer.step("hand_off")
+		subLog.Debug("Step timings", timer.attrs...)
+		subLog.Info("Handed off book download")
+		return StatusQueued, nil
+	}
+
+	if c.opt.RecordCurl || c.opt.JSONSidecar {
+		job, err := c.waitDownload(meta)
+		if err != nil {
+			subLog.Warn("Couldn't record curl command or URL for book", "err", err)
+		} else {
+			if c.opt.RecordCurl {
+				c.curl = job.Curl()
+			}
+			c.downloadURL = job.URL
+		}
+		timer.step("record_curl")
+	}
+
+	subLog.Debug("Step timings", timer.attrs...)
+	subLog.Info("Downloaded book")
+	return StatusDownloaded, nil
+}
+
+// Ask Amazon to download the book for kindle i as requestDownload
+// does, waiting for it to download if Options.VerifyDownloads is set
+func (c *Client) requestForKindle(subLog *slog.Logger, i int, action *rod.Element, meta *Book, timer *bookTimer) (status string, err error) {
+	if len(c.reKindles) > 1 {
+		err = c.useKindle(i)
+		if err != nil {
+			return "", fmt.Errorf("failed to set download directory for kindle: %w", err)
+		}
+		subLog = subLog.With("kindle", c.kindleName())
+	}
+	status, err = c.requestDownload(subLog, action, meta, timer)
+	if err != nil || status != "" {
+		return status, err
+	}
+	if c.opt.VerifyDownloads {
+		err = c.verifyDownload(subLog)
+		if err != nil {
+			return "", fmt.Errorf("book didn't download: %w", err)
+		}
+		timer.step("download_complete")
+	}
+	return "", nil
+}
+
+// Ask Amazon to download the book for the current kindle using the
+// more actions menu action and wait for it to say it is done
+//
+// It returns StatusSkipped if the book can't be downloaded, otherwise
+// "" if the download was started.
+func (c *Client) requestDownload(subLog *slog.Logger, action *rod.Element, meta *Book, timer *bookTimer) (status string, err error) {
+	err = action.ScrollIntoView()
+	if err != nil {
+		return "", fmt.Errorf("error scrolling button into view: %w", err)
+	}
+
+	// Small pause to let things settle
+	time.Sleep(c.opt.TimeScrollPause)
+	timer.step("scroll")
+
+	// Surveys take the focus away from the menu so get rid of them first
+	c.dismissOverlays(subLog)
+
+	subLog.Debug("Opening more actions menu")
+	err = c.click(action)
+	if err != nil {
+		return "", fmt.Errorf("error clicking on more actions: %w", err)
+	}
+
+	// Check the menu exists
+	clearFurthest, err := c.findOneElementWithText(subLog, "span", c.reClearFurthest)
+	if err != nil {
+		return "", fmt.Errorf("couldn't find popup menu (-msg-clear-furthest=%q): %w", c.opt.MsgClearFurthest, err)
+	}
+
+	// ... as some books (eg SAMPLES) don't have a download link
+	menu, err := c.findOneElementWithText(subLog, "span", c.reDownloadViaUSB)
+	if errors.Is(err, errNoneFound) {
+		slog.Error(fmt.Sprintf("Book has no (-msg-download-usb=%q) link - skipping", c.opt.MsgDownloadViaUSB))
+		err = c.dismissMenu(clearFurthest)
+		if err != nil {
+			return "", err
+		}
+		return StatusSkipped, nil
+	} else if err != nil {
+		return "", fmt.Errorf("couldn't find popup menu (-msg-download-usb=%q): %w", c.opt.MsgDownloadViaUSB, err)
+	}
+
+	subLog.Debug("Opening download menu")
+	err = c.click(menu)
+	if err != nil {
+		return "", fmt.Errorf("error clicking on Download & transfer via USB button: %w", err)
+	}
+	timer.step("menu_open")
+
+	// Choose kindle popup
+	_ = `
+<li class="ActionList-module_action_list_item__LoNyc">
+  <div style="width: 20px;">
+    <label class="RadioButton-module_radio_container__3ni_P">
+      <input type="radio" name="actionListRadioButton">
+      <span id="download_and_transfer_list_B000JMLBHU_3" class="RadioButton-module_radio__1k8O3" tabindex="0">
+      </span>
+    </label>
+  </div>
+  <div class="ActionList-module_action_list_value__ijMh2">
+    Nick's Paperwhite Kindle
+  </div>
+</li>
+`
+
+	li, err := c.findKindle(subLog)
+	if err != nil {
+		return "", err
+	}
+
+	input, err := li.Element("input[type='radio']")
+	if err != nil {
+		return "", fmt.Errorf("couldn't find radio in kindle menu: %w", err)
+	}
+
+	err = c.checkDialogASIN(subLog, li, meta)
+	if err != nil {
+		return "", err
+	}
+
+	subLog.Debug("Selecting desired kindle")
+	err = c.click(input)
+	if err != nil {
+		return "", fmt.Errorf("error clicking on selected kindle: %w", err)
+	}
+	timer.step("device_select")
+
+	downloadButton, err := c.findOneElementWithText(subLog, "span", c.reDownloadButton)
+	if err != nil {
+		return "", fmt.Errorf("couldn't find download button (-msg-download-button=%q): %w", c.opt.MsgDownloadButton, err)
+	}
+
+	subLog.Debug("Downloading book")
+	if c.captureDownloads() {
+		c.drainDownloads()
+	}
+	err = c.journalStart(meta)
+	if err != nil {
+		return "", err
+	}
+	err = c.click(downloadButton)
+	if err != nil {
+		return "", fmt.Errorf("error clicking on download button: %w", err)
+	}
+	timer.step("download_click")
+
+	// Success popup
+	_ = `
+<div id="notification-success" class="Notification-module_message_container__1I59M">
+  <div class="Notification-module_message_wrapper__1KMgj Notification-module_message_wrapper_success__2RUp8">
+    <span id="notification-close" class="Notification-module_close__2N_IB" tabindex="0">
+    </span>
+    <div class="Notification-module_message_heading__2vO83 Notification-module_message_heading_success__1rCJl">
+      <i aria-hidden="true" class="fa fa-check">
+      </i>
+      <div class="Notification-module_message_heading_container_success__zVMaH">
+        <span>Success</span>
+      </div>
+    </div>
+    <div id="success_d0" class="Notification-module_message_heading_container__2R3WZ">
+      <span>Download your Kindle content to your computer via Your Media Library.</span>
+    </div>
+  </div>
+</div>
+`
+	err = c.waitNotification(subLog)
+	if err != nil {
+		return "", err
+	}
+
+	timer.step("success_popup")
+	return "", nil
+}
+
+// Dismiss the more actions menu containing the element by clicking
+// off the side of it
+func (c *Client) dismissMenu(el *rod.Element) error {
+	// Get the element's position
+	shape, err := el.Shape()
+	if err != nil {
+		return fmt.Errorf("failed to get shape to dismiss popup: %w", err)
+	}
+
+	// Click a bit off the side of the box to dismiss it
+	x := shape.Box().X - 50
+	y := shape.Box().Y
+
+	// Move mouse to the new coordinates and click to dismiss the box
+	err = c.page.Mouse.MoveTo(proto.Point{X: x, Y: y})
+	if err != nil {
+		return fmt.Errorf("failed to move mouse to dismiss popup: %w", err)
+	}
+	c.pacer.pause()
+	err = c.page.Mouse.Click(proto.InputMouseButtonLeft, 1)
+	if err != nil {
+		return fmt.Errorf("failed to click mouse to dismiss popup: %w", err)
+	}
+	return nil
+}
+
+// Download all the books on the given page
+func (c *Client) downloadAllOnPage() error {
+	err := c.openPage()
+	if err != nil {
+		return err
+	}
+
+	subLog := slog.Default().With(
+		"url", c.pageURL(),
+		"page", c.pageNumber,
+	)
+
+	c.dismissOverlays(subLog)
+
+	// Find out how many books on this page
+	showing, err := c.findOneElementWithText(subLog, "span", c.reShowing)
+	if err != nil {
+		return fmt.Errorf("couldn't find showing text (-msg-showing=%q): %w", c.opt.MsgShowing, err)
+	}
+	showingTxt, err := showing.Text()
+	if err != nil {
+		return fmt.Errorf("couldn't get showing text (-msg-showing=%q): %w", c.opt.MsgShowing, err)
+	}
+	match := c.reShowing.FindStringSubmatch(showingTxt)
+	if len(match) != 4 {
+		return fmt.Errorf("showing text regexp didn't match (-msg-showing=%q): %w", c.opt.MsgShowing, err)
+	}
+	startBook, _ := strconv.Atoi(match[1])
+	endBook, _ := strconv.Atoi(match[2])
+	totalBooks, _ := strconv.Atoi(match[3])
+	slog.Info("Opened new page", "startBook", startBook, "endBook", endBook, "totalBooks", totalBooks)
+	err = c.checkTotal(totalBooks)
+	if err != nil {
+		return err
+	}
+
+	// Fetch the metadata for the books on this page. This isn't
+	// essential for downloading so carry on without it if it fails.
+	c.pageBooks, err = c.fetchBooks(context.Background(), (c.pageNumber-1)*c.opt.BooksPerPage, c.opt.BooksPerPage)
+	if err != nil {
+		subLog.Warn("Couldn't fetch book metadata", "err", err)
+		c.pageBooks = nil
+	}
+
+	// Find all the spans with text "More actions"
+	// Each of these is a book
+	actions, err := c.findElementWithText(subLog, "span", c.reMoreActions)
+	if err != nil {
+		return fmt.Errorf("couldn't find books (-msg-more-actions=%q): %w", c.opt.MsgMoreActions, err)
+	}
+	subLog.Debug("Found in page", "books", len(actions))
+	if len(actions) == 0 {
+		return fmt.Errorf("no books found on page")
+	}
+	rows := c.findRows(subLog, actions)
+	if c.checkCollectionPage(subLog, rows) {
+		return errPageMoved
+	}
+	err = c.anchor(c.pageASINs(rows))
+	if err != nil {
+		return err
+	}
+	c.recordPending(subLog, rows)
+
+	for n, row := range rows {
+		if n < c.offset {
+			subLog.Debug("skip offset", "offset", n)
+			continue
+		}
+		if c.opt.LastBook > 0 && c.book > c.opt.LastBook {
+			return ErrFinished
+		}
+		c.waitWhilePaused()
+		meta := c.pageBook(n, row.asin)
+		if meta.ASIN != "" && c.seen[meta.ASIN] {
+			subLog.Info("Skipping book already done in this run", "asin", meta.ASIN)
+			err = c.nextBook(&meta)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if meta.ASIN != "" && c.newestFirst() && c.manifest.downloaded(meta.ASIN) {
+			subLog.Info("Caught up with the books downloaded by earlier runs", "asin", meta.ASIN)
+			return ErrFinished
+		}
+		if c.stateDone(&meta) {
+			subLog.Debug("Skipping book already done in state database", "asin", meta.ASIN, "status", c.bookState(&meta).Status)
+			err = c.nextBook(&meta)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		c.fillFromRow(subLog, &meta)
+		ok, err := c.wanted(subLog, &meta)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			err = c.nextBook(&meta)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if c.opt.SkipOnDisk {
+			name, err := c.existingFile(&meta)
+			if err != nil {
+				return err
+			}
+			if name != "" {
+				subLog.Info("Skipping book already in output directory", "asin", meta.ASIN, "file", name)
+				c.counts[StatusSkipped]++
+				err = c.manifest.recordExisting(meta, c.book, name)
+				if err != nil {
+					return err
+				}
+				err = c.recordState(&meta, c.book, StatusSkipped, nil)
+				if err != nil {
+					return err
+				}
+				err = c.nextBook(&meta)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		c.enrichBook(subLog, &meta)
+		var status string
+		if c.opt.SkipSamples && meta.Sample() {
+			// Samples have no download link so don't bother opening the menus
+			subLog.Info("Skipping sample", "asin", meta.ASIN)
+			status = StatusSkipped
+		} else if c.opt.SkipFree && meta.Free() {
+			subLog.Info("Skipping free book", "asin", meta.ASIN, "price", meta.Price)
+			status = StatusSkipped
+		} else if err = c.fireEvent(EventPreBook, &meta, "", nil); errors.Is(err, ErrSkipBook) {
+			subLog.Info("Skipping book as requested by hook")
+			status = StatusSkipped
+		} else if err != nil {
+			return err
+		} else {
+			c.curl, c.downloadURL = "", ""
+			status, err = c.downloadOneBook(subLog, n, row.action, &meta)
+		}
+		if err != nil && !errors.Is(err, ErrSkipBook) {
+			// Don't fail the book if the network went down, it
+			// is tried again when it comes back
+			err = c.checkOffline(err)
+			if errors.Is(err, ErrOffline) {
+				return err
+			}
+			c.counts[StatusFailed]++
+			c.pacer.failure()
+			recordErr := c.manifest.record(meta, c.book, StatusFailed, err, c.curl)
+			if recordErr != nil {
+				subLog.Error("Failed to record failure in manifest", "err", recordErr)
+			}
+			recordErr = c.recordState(&meta, c.book, StatusFailed, err)
+			if recordErr != nil {
+				subLog.Error("Failed to record failure", "err", recordErr)
+			}
+			hookErr := c.fireEvent(EventFailure, &meta, StatusFailed, err)
+			if hookErr != nil {
+				subLog.Error("Failure hook failed", "err", hookErr)
+			}
+			if !meta.Rental() && !errors.Is(err, errDownloadRefused) {
+				return err
+			}
+			// Rentals have different menus and Amazon refusing a
+			// book doesn't stop the others, so carry on with the
+			// next book from a freshly opened page.
+			if meta.Rental() {
+				subLog.Warn("Failed to download rental - carrying on", "expires", meta.Expires, "err", err)
+			} else {
+				subLog.Warn("Amazon refused to download book - carrying on", "err", err)
+			}
+			err = c.nextBook(&meta)
+			if err != nil {
+				return err
+			}
+			c.seekBook(c.book)
+			return errPageMoved
+		}
+		err = c.manifest.record(meta, c.book, status, nil, c.curl)
+		if err != nil {
+			return err
+		}
+		if status == StatusDownloaded && c.downloadURL != "" {
+			err = c.manifest.setURL(&meta, c.book, c.downloadURL)
+			if err != nil {
+				return err
+			}
+		}
+		err = c.recordState(&meta, c.book, status, nil)
+		if err != nil {
+			return err
+		}
+		err = c.fireEvent(EventPostBook, &meta, status, nil)
+		if err != nil {
+			return err
+		}
+		c.counts[status]++
+		c.pacer.success()
+		c.progress.bookDone()
+		c.progress.log(c.remaining())
+		// Books handed off to a Downloader are downloads too
+		downloaded := status == StatusDownloaded || status == StatusQueued
+		if downloaded {
+			c.jitterSleep()
+		}
+		err = c.nextBook(&meta)
+		if err != nil {
+			return err
+		}
+		if downloaded && c.opt.MaxBooks > 0 && c.counts[StatusDownloaded]+c.counts[StatusQueued] >= c.opt.MaxBooks {
+			subLog.Info("Downloaded the maximum number of books for this run", "max_books", c.opt.MaxBooks)
+			return ErrMaxBooks
+		}
+		if c.asinsDone() {
+			subLog.Info("Done all the books in the ASIN file")
+			return ErrFinished
+		}
+	}
+	c.offset = 0
+
+	return c.fireEvent(EventPostPage, nil, "", nil)
+}
+
+// errPageMoved is returned when the position in the library has
+// moved so the page needs opening again
+var errPageMoved = errors.New("position in library moved")
+
+// Check the total number of books in the library against the last page
+//
+// Books bought since the run started are added at the end so only the
+// loop bounds need changing, but if books have been removed (eg
+// returned) the later books move up the list. In that case go back so
+// none are missed, at the cost of doing a few again.
+//
+// If the books are listed newest first, books bought are added at the
+// start instead so go forward past them. They are done by the next
+// run.
+func (c *Client) checkTotal(total int) error {
+	old := c.totalBooks
+	c.totalBooks = total
+	if old < 0 || total == old {
+		return nil
+	}
+	if total > old && c.newestFirst() {
+		slog.Warn("Library has grown since the last page - going forward past the new books", "old", old, "new", total, "forward", total-old)
+		c.seekBook(c.book + total - old)
+		err := c.saveCheckpoint()
+		if err != nil {
+			return err
+		}
+		return errPageMoved
+	}
+	if total > old {
+		slog.Warn("Library has grown since the last page", "old", old, "new", total)
+		return nil
+	}
+	back := min(old-total, c.book-1)
+	slog.Warn("Library has shrunk since the last page - going back so no books are missed", "old", old, "new", total, "back", back)
+	if back == 0 {
+		return nil
+	}
+	c.seekBook(c.book - back)
+	err := c.saveCheckpoint()
+	if err != nil {
+		return err
+	}
+	return errPageMoved
+}
+
+// Returns the ASINs of the books on the current page in order, from
+// their metadata or, if that couldn't be fetched, the ids of their rows
+func (c *Client) pageASINs(rows []pageRow) []string {
+	asins := make([]string, 0, len(rows))
+	if len(c.pageBooks) > 0 {
+		for _, b := range c.pageBooks {
+			asins = append(asins, b.ASIN)
+		}
+		return asins
+	}
+	for _, row := range rows {
+		asins = append(asins, row.asin)
+	}
+	return asins
+}
+
+// Check the position in the library using the ASIN of the last book
+// done, moving it if books have been bought or removed before it
+// since it was done.
+//
+// asins are the ASINs of the books on the current page in order.
+func (c *Client) anchor(asins []string) error {
+	if c.lastASIN == "" {
+		return nil
+	}
+	pageStart := (c.pageNumber - 1) * c.opt.BooksPerPage
+	for i := range asins {
+		if !strings.EqualFold(asins[i], c.lastASIN) {
+			continue
+		}
+		book := pageStart + i + 2 // the book after the last one done, 1 based
+		if book == c.book {
+			return nil
+		}
+		slog.Warn("Library has changed - moving to the book after the last one done", "asin", c.lastASIN, "old", c.book, "new", book)
+		pageNumber := c.pageNumber
+		c.seekBook(book)
+		err := c.saveCheckpoint()
+		if err != nil {
+			return err
+		}
+		if c.pageNumber != pageNumber {
+			return errPageMoved
+		}
+		return nil
+	}
+	return nil
+}
+
+// Run downloads books until there are none left or an error occurs
+//
+// It returns ErrFinished when all the books have been processed.
+func (c *Client) Run() (err error) {
+	if c.opt.KindleName == "" && len(c.opt.Kindles) == 0 {
+		return errors.New("need name of kindle to download for")
+	}
+	start, firstBook := time.Now(), c.book
+	if c.opt.PostWorkers > 0 && c.post == nil {
+		c.startPostPool()
+	}
+	err = c.fireEvent(EventPreRun, nil, "", nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		var runErr error
+		if !errors.Is(err, ErrFinished) && !errors.Is(err, ErrMaxBooks) {
+			runErr = err
+		}
+		hookErr := c.fireEvent(EventPostRun, nil, "", runErr)
+		if hookErr != nil && runErr == nil {
+			err = hookErr
+		}
+		c.recordRun(start, firstBook, err)
+	}()
+	for {
+		err = c.downloadAllOnPage()
+		if errors.Is(err, errPageMoved) {
+			continue
+		}
+		if errors.Is(err, ErrOffline) {
+			err = c.waitOnline(err)
+			if err != nil {
+				return err
+			}
+			// Open the page again at the book which was interrupted
+			c.seekBook(c.book)
+			continue
+		}
+		if err == nil {
+			c.pageNumber++
+			if c.book > c.totalBooks || (c.opt.LastBook > 0 && c.book > c.opt.LastBook) {
+				err = ErrFinished
+			} else if c.opt.Benchmark {
+				return ErrBenchmarkDone
+			}
+		}
+		if errors.Is(err, ErrFinished) && c.newestFirst() && c.opt.LastBook == 0 {
+			resetErr := c.restartCheckpoint()
+			if resetErr != nil {
+				return resetErr
+			}
+		}
+		// Carry on with the next marketplace if there is one
+		if errors.Is(err, ErrFinished) && c.moreMarketplaces() {
+			err = c.startMarketplace(c.marketplaceIndex + 1)
+		} else if errors.Is(err, ErrFinished) && c.moreContentTypes() {
+			err = c.startContentType(c.contentIndex + 1)
+		} else if errors.Is(err, ErrFinished) && c.opt.Audit {
+			c.audit()
+		}
+		if err != nil {
+			return err
+		}
+		err = c.recycleBrowser()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Sleep for a random time up to the jitter
+func (c *Client) jitterSleep() {
+	if c.opt.TimeJitter <= 0 {
+		return
+	}
+	d := rand.N(c.opt.TimeJitter)
+	slog.Debug("Jitter", "sleep", d.Round(time.Millisecond))
+	time.Sleep(d)
+}
+
+// Summary logs a summary of what happened in this run
+func (c *Client) Summary() {
+	slog.Info("Summary",
+		"downloaded", c.counts[StatusDownloaded],
+		"skipped", c.counts[StatusSkipped],
+		"failed", c.counts[StatusFailed],
+	)
+	c.logASINsMissing()
+	c.timings.log()
+}
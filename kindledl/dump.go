@@ -0,0 +1,125 @@
+package kindledl
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Maximum length of the text of an element to show in DumpStrings
+const dumpMaxText = 120
+
+// JavaScript to read the tag and text of the candidate elements on
+// the page
+const dumpJS = `() => Array.from(document.querySelectorAll("span, div")).map(el => [el.tagName.toLowerCase(), el.innerText || ""])`
+
+// A configured regexp to try in DumpStrings
+type dumpMatcher struct {
+	name string // the flag which sets it
+	re   *regexp.Regexp
+}
+
+// Returns the regexps the text on the page is matched against named
+// by the flag which sets them
+func (c *Client) dumpMatchers() []dumpMatcher {
+	return []dumpMatcher{
+		{"msg-showing", c.reShowing},
+		{"msg-more-actions", c.reMoreActions},
+		{"msg-clear-furthest", c.reClearFurthest},
+		{"msg-download-usb", c.reDownloadViaUSB},
+		{"kindle", c.reKindleName},
+		{"msg-download-button", c.reDownloadButton},
+		{"msg-success", c.reSuccess},
+		{"msg-profile-menu", c.reProfileMenu},
+		{"profile", c.reProfile},
+		{"msg-order-total", c.reOrderTotal},
+		{"msg-order-date", c.reOrderDate},
+	}
+}
+
+// DumpStrings writes the text of every span and div on the current
+// page to w with the flags whose regexps match it, to help work out
+// why text isn't being found, eg on an Amazon in another language.
+//
+// The first more actions menu is then opened, if found, and its text
+// written too as the menu items are only on the page when it is open.
+func (c *Client) DumpStrings(w io.Writer) error {
+	info, err := c.page.Info()
+	if err != nil {
+		return fmt.Errorf("failed to read page info: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "# Page %s\n", info.URL)
+	if err != nil {
+		return err
+	}
+	err = c.dumpPage(w)
+	if err != nil {
+		return err
+	}
+	actions, err := c.findElementWithText(slog.Default(), "span", c.reMoreActions)
+	if err != nil {
+		return err
+	}
+	if len(actions) == 0 {
+		_, err = fmt.Fprintf(w, "\n# No more actions button found (-msg-more-actions=%q) so can't show the menu\n", c.opt.MsgMoreActions)
+		return err
+	}
+	err = c.click(actions[0])
+	if err != nil {
+		return fmt.Errorf("failed to open more actions menu: %w", err)
+	}
+	time.Sleep(c.opt.TimeRetrySleep)
+	_, err = fmt.Fprintf(w, "\n# Page with the first more actions menu open\n")
+	if err != nil {
+		return err
+	}
+	return c.dumpPage(w)
+}
+
+// Write the text of the candidate elements on the page to w with the
+// names of the regexps matching them
+//
+// Elements with the same text, eg a span and the divs around it, are
+// only shown once.
+func (c *Client) dumpPage(w io.Writer) error {
+	res, err := c.page.Eval(dumpJS)
+	if err != nil {
+		return fmt.Errorf("failed to read text on page: %w", err)
+	}
+	var elements [][2]string
+	err = res.Value.Unmarshal(&elements)
+	if err != nil {
+		return fmt.Errorf("failed to decode text on page: %w", err)
+	}
+	matchers := c.dumpMatchers()
+	seen := map[string]bool{}
+	for _, el := range elements {
+		tag, text := el[0], strings.TrimSpace(el[1])
+		if text == "" || seen[text] {
+			continue
+		}
+		seen[text] = true
+		var matched []string
+		for _, m := range matchers {
+			if m.re != nil && m.re.MatchString(text) {
+				matched = append(matched, "-"+m.name)
+			}
+		}
+		show := strings.Join(strings.Fields(text), " ")
+		if runes := []rune(show); len(runes) > dumpMaxText {
+			show = string(runes[:dumpMaxText]) + "..."
+		}
+		match := "-"
+		if len(matched) > 0 {
+			match = strings.Join(matched, ", ")
+		}
+		_, err = fmt.Fprintf(w, "%-4s %-40s %q\n", tag, match, show)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
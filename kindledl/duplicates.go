@@ -0,0 +1,174 @@
+package kindledl
+
+import (
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Matches an ASIN in a file name
+var reFileASIN = regexp.MustCompile(`(?:^|[^A-Z0-9])(B[0-9A-Z]{9})(?:[^A-Z0-9]|$)`)
+
+// Matches the " (1)" the browser adds to the name of a file which
+// already exists
+var reCopySuffix = regexp.MustCompile(` \(\d+\)$`)
+
+// Extensions of the book files Amazon delivers. Only these are checked
+// for duplicates so files written next to the books, eg series.json,
+// are left alone.
+var bookExts = map[string]bool{
+	".azw":  true,
+	".azw1": true,
+	".azw3": true,
+	".azw4": true,
+	".kfx":  true,
+	".mobi": true,
+	".pdf":  true,
+	".prc":  true,
+	".tpz":  true,
+}
+
+// Returns whether the file name is of a book
+func isBookFile(name string) bool {
+	return bookExts[strings.ToLower(path.Ext(name))]
+}
+
+// Duplicate is a set of files in the download directory which are
+// all the same book
+type Duplicate struct {
+	Key    string   // ASIN or file name the files have in common
+	Keep   string   // file to keep, relative to the download directory
+	Remove []string // files which are extra copies
+}
+
+// Returns the key identifying the book in the file name
+//
+// This is the ASIN if the name has one, in the directory of the kindle
+// the file is for as each kindle has its own copy of the book.
+// Otherwise it is the lower case name, including the directory, without
+// the browser's copy suffix, so books with the same title in different
+// directories, eg by different authors, aren't taken as copies.
+func (c *Client) duplicateKey(name string) string {
+	base := path.Base(name)
+	for _, match := range reFileASIN.FindAllStringSubmatch(strings.ToUpper(base), -1) {
+		// Words like BESTSELLER look like ASINs but don't have digits
+		if strings.ContainsAny(match[1], "0123456789") {
+			return path.Join(c.kindleDirOf(name), match[1])
+		}
+	}
+	ext := path.Ext(name)
+	stem := reCopySuffix.ReplaceAllString(strings.TrimSuffix(name, ext), "")
+	return strings.ToLower(stem + ext)
+}
+
+// Returns whether the file looks like a book which downloaded properly
+func (c *Client) validBook(f completedFile) bool {
+	if f.size == 0 {
+		return false
+	}
+	format, err := detectFormat(filepath.Join(c.downloadDir, filepath.FromSlash(f.name)))
+	return err == nil && format != FormatUnknown
+}
+
+// FindDuplicates finds files in the download directory which are
+// copies of the same book, eg the " (1)" copies the browser makes
+// when a book is downloaded again.
+//
+// The newest valid file of each set is the one to keep.
+func (c *Client) FindDuplicates() ([]Duplicate, error) {
+	files, _, err := c.completedFiles()
+	if err != nil {
+		return nil, err
+	}
+	byKey := map[string][]completedFile{}
+	var keys []string
+	for _, f := range files {
+		if !isBookFile(f.name) || c.isSidecar(f.name) {
+			continue
+		}
+		key := c.duplicateKey(f.name)
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], f)
+	}
+	var dups []Duplicate
+	for _, key := range keys {
+		group := byKey[key]
+		if len(group) < 2 {
+			continue
+		}
+		valid := make(map[string]bool, len(group))
+		for _, f := range group {
+			valid[f.name] = c.validBook(f)
+		}
+		// Best first: valid, then newest
+		sort.SliceStable(group, func(i, j int) bool {
+			if valid[group[i].name] != valid[group[j].name] {
+				return valid[group[i].name]
+			}
+			return group[i].modTime.After(group[j].modTime)
+		})
+		dup := Duplicate{Key: key, Keep: group[0].name}
+		for _, f := range group[1:] {
+			dup.Remove = append(dup.Remove, f.name)
+		}
+		dups = append(dups, dup)
+	}
+	return dups, nil
+}
+
+// Report duplicate files at the end of the run, removing the extra
+// copies if Options.Dedupe is set
+func (c *Client) duplicatesHook(e Event) error {
+	if e.Type != EventPostRun {
+		return nil
+	}
+	_, _, err := c.waitCompletedFiles(true)
+	if err == nil {
+		err = c.dedupe()
+	}
+	if err != nil {
+		slog.Error("Failed to check for duplicate files", "err", err)
+	}
+	return nil
+}
+
+// Find the duplicate files and log them, removing the extra copies if
+// Options.Dedupe is set.
+func (c *Client) dedupe() error {
+	dups, err := c.FindDuplicates()
+	if err != nil {
+		return err
+	}
+	removed := map[string]string{} // file removed to file kept
+	for _, dup := range dups {
+		if !c.opt.Dedupe {
+			slog.Warn("Duplicate files - use -dedupe to remove", "keep", dup.Keep, "copies", dup.Remove)
+			continue
+		}
+		for _, name := range dup.Remove {
+			err := os.Remove(filepath.Join(c.downloadDir, filepath.FromSlash(name)))
+			if err != nil {
+				slog.Error("Failed to remove duplicate file", "file", name, "err", err)
+				continue
+			}
+			slog.Info("Removed duplicate file", "file", name, "kept", dup.Keep)
+			removed[name] = dup.Keep
+		}
+	}
+	// Point the manifest at the files kept
+	for _, e := range c.manifest.Snapshot() {
+		if keep, ok := removed[e.File]; ok {
+			err := c.manifest.setFile(&e.Book, e.Number, keep, e.Format, c.hashes[keep])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package kindledl
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Shortest normalized title matched against a file name, so short
+// titles like "It" don't match unrelated files
+const minExistingTitle = 4
+
+// Separators which can come between the title and the rest of a file
+// name, eg the series in "Dune - Dune Chronicles 1"
+var titleSeparators = []string{" - ", " (", " [", "_", ", "}
+
+// Returns s in lower case with everything but letters and digits
+// removed, so titles and file names can be compared however they were
+// punctuated or made safe for the file system
+func normalizeTitle(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Returns the name of the file in the output directory which the book
+// was downloaded to, or "" if there isn't one
+//
+// Files are matched by the ASIN in their name, or failing that by
+// their name being the title of the book, ignoring case and
+// punctuation, optionally followed by a separator and more, eg the
+// series, or the browser's copy suffix. The output directory is read the first time this is
+// called in each run.
+func (c *Client) existingFile(b *Book) (string, error) {
+	if c.existing == nil {
+		files, _, err := c.completedFiles()
+		if err != nil {
+			return "", err
+		}
+		c.existing = make([]string, 0, len(files))
+		for _, f := range files {
+			c.existing = append(c.existing, f.name)
+		}
+	}
+	if b.ASIN != "" {
+		asin := strings.ToLower(b.ASIN)
+		for _, name := range c.existing {
+			if strings.Contains(strings.ToLower(filepath.Base(name)), asin) {
+				return name, nil
+			}
+		}
+	}
+	// The series is left off so it matches with or without it
+	title := normalizeTitle(bareTitle(b.Title))
+	if len(title) < minExistingTitle {
+		return "", nil
+	}
+	for _, name := range c.existing {
+		base := filepath.Base(name)
+		if stemIsTitle(strings.TrimSuffix(base, filepath.Ext(base)), title) {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// Returns whether the stem of a file name is the normalized title,
+// either on its own or followed by one of the titleSeparators, so
+// "Dune" doesn't match "Dune Messiah"
+func stemIsTitle(stem, title string) bool {
+	stem = reCopySuffix.ReplaceAllString(stem, "")
+	if normalizeTitle(stem) == title {
+		return true
+	}
+	for _, sep := range titleSeparators {
+		before, _, found := strings.Cut(stem, sep)
+		if found && normalizeTitle(before) == title {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package kindledl
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Columns written to the CSV export
+var exportColumns = []string{
+	"number",
+	"asin",
+	"title",
+	"authors",
+	"acquired",
+	"order_id",
+	"order_date",
+	"price",
+	"read_status",
+	"percent_read",
+	"collections",
+	"tags",
+	"audible",
+	"whispersync",
+	"origin",
+	"expires",
+	"renews",
+	"status",
+	"time",
+	"error",
+}
+
+// Return the CSV row for the entry
+func (e *ManifestEntry) csvRow() []string {
+	return []string{
+		strconv.Itoa(e.Number),
+		e.ASIN,
+		e.Title,
+		e.Authors,
+		e.Acquired,
+		e.OrderID,
+		e.OrderDate,
+		e.Price,
+		e.ReadStatus,
+		strconv.Itoa(e.PercentRead),
+		strings.Join(e.Collections, "; "),
+		strings.Join(e.Tags, "; "),
+		strconv.FormatBool(e.Audible),
+		strconv.FormatBool(e.Whispersync),
+		e.Origin,
+		e.Expires,
+		e.Renews,
+		e.Status,
+		e.Time.Format(time.RFC3339),
+		e.Error,
+	}
+}
+
+// Export writes the manifest entries to path as CSV if it ends in
+// .csv, Markdown if it ends in .md, otherwise as JSON
+func (m *Manifest) Export(path string) (err error) {
+	return m.ExportWith(path, ExportOptions{})
+}
+
+// ExportWith writes the manifest entries to path as Export does,
+// controlled by eo
+func (m *Manifest) ExportWith(path string, eo ExportOptions) (err error) {
+	entries := m.Snapshot()
+	if eo.DownloadedOnly {
+		downloaded := entries[:0]
+		for _, e := range entries {
+			if e.Status == StatusDownloaded {
+				downloaded = append(downloaded, e)
+			}
+		}
+		entries = downloaded
+	}
+	if eo.ByAuthor || strings.EqualFold(filepath.Ext(path), ".md") {
+		err = exportMarkdown(path, entries, eo)
+		if err != nil {
+			return fmt.Errorf("failed to write export file: %w", err)
+		}
+		return nil
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer func() {
+		closeErr := out.Close()
+		if err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to close export file: %w", closeErr)
+		}
+	}()
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		w := csv.NewWriter(out)
+		err = w.Write(exportColumns)
+		if err != nil {
+			return fmt.Errorf("failed to write export file: %w", err)
+		}
+		for i := range entries {
+			err = w.Write(entries[i].csvRow())
+			if err != nil {
+				return fmt.Errorf("failed to write export file: %w", err)
+			}
+		}
+		w.Flush()
+		err = w.Error()
+	} else {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "\t")
+		err = enc.Encode(entries)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	return nil
+}
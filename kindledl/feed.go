@@ -0,0 +1,131 @@
+package kindledl
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Maximum number of books in the feed
+const feedEntries = 50
+
+// atomFeed is an Atom feed as described in RFC 4287
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// atomPerson is the author of a feed or entry
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+// atomLink is a link from an entry
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+// atomEntry is a single book in the feed
+type atomEntry struct {
+	ID      string       `xml:"id"`
+	Title   string       `xml:"title"`
+	Updated string       `xml:"updated"`
+	Authors []atomPerson `xml:"author"`
+	Links   []atomLink   `xml:"link"`
+	Summary string       `xml:"summary,omitempty"`
+}
+
+// Return the URL of the book on Amazon using the host of the books URL
+// or the book's marketplace if known
+func (c *Client) productURL(b *Book) string {
+	u, err := url.Parse(c.opt.BooksURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	host := u.Host
+	if b.Marketplace != "" {
+		host = b.Marketplace
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: host, Path: "/dp/" + b.ASIN}).String()
+}
+
+// WriteFeed writes an Atom feed of the most recently downloaded books
+// in the manifest to path.
+func (c *Client) WriteFeed(path string) error {
+	var entries []ManifestEntry
+	for _, e := range c.manifest.Snapshot() {
+		if e.Status == StatusDownloaded {
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.After(entries[j].Time)
+	})
+	if len(entries) > feedEntries {
+		entries = entries[:feedEntries]
+	}
+	feed := atomFeed{
+		ID:      "urn:" + Program + ":feed:" + url.PathEscape(c.opt.KindleName),
+		Title:   "Kindle books archived by " + Program,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Author:  atomPerson{Name: Program},
+	}
+	if len(entries) > 0 {
+		feed.Updated = entries[0].Time.UTC().Format(time.RFC3339)
+	}
+	for _, e := range entries {
+		entry := atomEntry{
+			ID:      "urn:" + Program + ":asin:" + e.ASIN,
+			Title:   e.Title,
+			Updated: e.Time.UTC().Format(time.RFC3339),
+		}
+		if entry.Title == "" {
+			entry.Title = e.ASIN
+		}
+		if e.Authors != "" {
+			entry.Authors = []atomPerson{{Name: e.Authors}}
+			entry.Summary = "by " + e.Authors
+		}
+		if u := c.productURL(&e.Book); u != "" {
+			entry.Links = append(entry.Links, atomLink{Href: u, Rel: "alternate", Type: "text/html"})
+		}
+		if e.Cover != "" {
+			entry.Links = append(entry.Links, atomLink{Href: e.Cover, Rel: "enclosure", Type: "image/jpeg"})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	data, err := xml.MarshalIndent(feed, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to make feed: %w", err)
+	}
+	data = append([]byte(xml.Header), data...)
+	data = append(data, '\n')
+	err = writeFileAtomic(path, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write feed: %w", err)
+	}
+	return nil
+}
+
+// Write the feed at the end of the run
+func (c *Client) feedHook(e Event) error {
+	if e.Type != EventPostRun {
+		return nil
+	}
+	err := c.WriteFeed(c.opt.Feed)
+	if err != nil {
+		slog.Error("Failed to write feed", "err", err)
+	} else {
+		slog.Info("Wrote feed", "file", c.opt.Feed)
+	}
+	return nil
+}
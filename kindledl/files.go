@@ -0,0 +1,183 @@
+package kindledl
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Suffixes of files which are still being downloaded
+var partialSuffixes = []string{".crdownload", ".part", ".download", ".tmp"}
+
+// completedFile is a file in the download directory which has
+// finished downloading
+type completedFile struct {
+	name    string // path relative to the download directory, / separated
+	size    int64
+	modTime time.Time
+}
+
+// Returns whether name is a file which is still being downloaded
+func isPartial(name string) bool {
+	lower := strings.ToLower(name)
+	for _, suffix := range partialSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Find the files in the download directory which have finished
+// downloading, returning whether any files are still being downloaded
+// too.
+//
+// Hidden files are ignored.
+func (c *Client) completedFiles() (files []completedFile, partial bool, err error) {
+	return listCompleted(c.downloadDir)
+}
+
+// Find the files in dir which have finished downloading as
+// completedFiles does
+func listCompleted(dir string) (files []completedFile, partial bool, err error) {
+	files, partials, err := listDownloads(dir)
+	return files, len(partials) > 0, err
+}
+
+// Find the files in dir which have finished downloading and those
+// which are still being downloaded
+func listDownloads(dir string) (files, partials []completedFile, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		f := completedFile{
+			name:    filepath.ToSlash(rel),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		}
+		if isPartial(d.Name()) {
+			partials = append(partials, f)
+		} else {
+			files = append(files, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list download directory: %w", err)
+	}
+	return files, partials, nil
+}
+
+// Find the completed files as completedFiles does
+//
+// If wait is set then wait for files being downloaded to complete
+// first, giving up on any which stall as waitPartial does.
+func (c *Client) waitCompletedFiles(wait bool) (files []completedFile, partial bool, err error) {
+	if wait {
+		return c.waitPartial(c.downloadDir)
+	}
+	return c.completedFiles()
+}
+
+// Write data to path atomically so readers never see a partial file
+//
+// The data is written to a temporary file in the same directory which
+// is renamed over path.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	err = tmp.Close()
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Write data to path so it survives a crash or power cut, keeping the
+// old file as backup.
+//
+// The data is synced to disk before the old file is moved to backup
+// and the new one renamed into place, then the directory is synced so
+// the renames are on disk too. If we crash between the renames there
+// is no file at path, but the backup has the previous generation.
+func writeFileDurable(path, backup string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(path, backup)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// Sync the directory so renames in it are on disk
+//
+// This isn't possible on all platforms so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
@@ -0,0 +1,72 @@
+package kindledl
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+)
+
+// Returns whether the book should be downloaded according to the
+// filtering flags, logging the reason if not.
+func (c *Client) wanted(subLog *slog.Logger, b *Book) (bool, error) {
+	if c.opt.SkipRentals && b.Rental() {
+		subLog.Info("Skipping rental", "asin", b.ASIN, "expires", b.Expires)
+		return false, nil
+	}
+	if len(c.opt.ASINs) > 0 {
+		if b.ASIN == "" {
+			return false, errors.New("can't pick out the books in the ASIN file as the book metadata couldn't be read")
+		}
+		if !c.opt.ASINs[strings.ToUpper(b.ASIN)] {
+			subLog.Debug("Skipping book not in ASIN file", "asin", b.ASIN)
+			return false, nil
+		}
+	}
+	if c.reAuthor != nil {
+		if b.Authors == "" {
+			return false, errors.New("can't filter books by author as the author couldn't be read")
+		}
+		if !c.reAuthor.MatchString(b.Authors) {
+			subLog.Debug("Skipping book by another author", "authors", b.Authors)
+			return false, nil
+		}
+	}
+	if c.reTitle != nil {
+		if b.Title == "" {
+			return false, errors.New("can't filter books by title as the title couldn't be read")
+		}
+		if !c.reTitle.MatchString(b.Title) {
+			subLog.Debug("Skipping book with another title", "title", b.Title)
+			return false, nil
+		}
+	}
+	// The rest of the books are outside the range too if the library
+	// is in date order
+	inRange, err := c.acquiredRange(b)
+	if err != nil {
+		return false, err
+	}
+	if inRange > 0 && c.oldestFirst() {
+		subLog.Info("Reached books acquired after -until", "acquired", b.Acquired)
+		return false, ErrFinished
+	}
+	if inRange < 0 && c.newestFirst() {
+		subLog.Info("Reached books acquired before -since", "acquired", b.Acquired)
+		return false, ErrFinished
+	}
+	if inRange != 0 {
+		subLog.Debug("Skipping book acquired outside date range", "acquired", b.Acquired)
+		return false, nil
+	}
+	if len(c.opt.Collections) == 0 {
+		return true, nil
+	}
+	if b.ASIN == "" {
+		return false, errors.New("can't filter books as the book metadata couldn't be read")
+	}
+	if !inCollections(b, c.opt.Collections) {
+		subLog.Debug("Skipping book not in collections", "collections", b.Collections)
+		return false, nil
+	}
+	return true, nil
+}
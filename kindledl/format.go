@@ -0,0 +1,258 @@
+package kindledl
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Formats Amazon delivers books in
+const (
+	FormatAZW3    = "azw3"    // KF8, possibly combined with MOBI
+	FormatMOBI    = "mobi"    // older MOBI without KF8
+	FormatKFX     = "kfx"     // KFX, usually DRM protected
+	FormatTopaz   = "topaz"   // very old Topaz
+	FormatPDF     = "pdf"     // personal documents
+	FormatUnknown = "unknown" // couldn't tell
+)
+
+// Magic numbers at the start of the files
+var (
+	magicKFX     = []byte("CONT")
+	magicKFXDRM  = []byte("\xeaDRMION\xee")
+	magicTopaz   = []byte("TPZ")
+	magicPDF     = []byte("%PDF")
+	magicZip     = []byte("PK\x03\x04")
+	magicMOBI    = []byte("BOOKMOBI") // type and creator in the Palm database header
+	magicMOBIHdr = []byte("MOBI")
+	magicEXTH    = []byte("EXTH")
+)
+
+// Constants for reading MOBI files
+const (
+	pdbHeaderSize  = 78         // size of the Palm database header
+	exthKF8Offset  = 121        // EXTH record with the offset of the KF8 section
+	mobiNoKF8      = 0xFFFFFFFF // KF8 offset if there isn't a KF8 section
+	mobiKF8Version = 8          // MOBI header version for KF8
+)
+
+// Work out the format of the book in the file at path
+func detectFormat(path string) (format string, err error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	header := make([]byte, pdbHeaderSize)
+	n, err := io.ReadFull(in, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	header = header[:n]
+	switch {
+	case bytes.HasPrefix(header, magicKFX), bytes.HasPrefix(header, magicKFXDRM):
+		return FormatKFX, nil
+	case bytes.HasPrefix(header, magicTopaz):
+		return FormatTopaz, nil
+	case bytes.HasPrefix(header, magicPDF):
+		return FormatPDF, nil
+	case bytes.HasPrefix(header, magicZip):
+		return zipFormat(in)
+	case len(header) == pdbHeaderSize && bytes.Equal(header[60:68], magicMOBI):
+		return mobiFormat(in)
+	}
+	return FormatUnknown, nil
+}
+
+// Work out the format of a zip file
+//
+// KFX books are sometimes delivered as a zip of .kfx files.
+func zipFormat(in *os.File) (string, error) {
+	info, err := in.Stat()
+	if err != nil {
+		return "", err
+	}
+	zr, err := zip.NewReader(in, info.Size())
+	if err != nil {
+		return FormatUnknown, nil
+	}
+	for _, f := range zr.File {
+		if strings.EqualFold(path.Ext(f.Name), ".kfx") {
+			return FormatKFX, nil
+		}
+	}
+	return FormatUnknown, nil
+}
+
+// Work out whether a MOBI file has a KF8 section which makes it AZW3
+//
+// This is the case if the MOBI header is version 8 or if the EXTH
+// header has a KF8 boundary record.
+func mobiFormat(in *os.File) (string, error) {
+	// Read the first record which has the MOBI and EXTH headers
+	var offset [4]byte
+	_, err := in.ReadAt(offset[:], pdbHeaderSize)
+	if err != nil {
+		return "", err
+	}
+	record0 := make([]byte, 64*1024)
+	n, err := in.ReadAt(record0, int64(binary.BigEndian.Uint32(offset[:])))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	record0 = record0[:n]
+	// The MOBI header follows the 16 byte PalmDOC header
+	if len(record0) < 132 || !bytes.Equal(record0[16:20], magicMOBIHdr) {
+		return FormatUnknown, nil
+	}
+	mobiHeaderLen := int(binary.BigEndian.Uint32(record0[20:24]))
+	version := binary.BigEndian.Uint32(record0[36:40])
+	if version >= mobiKF8Version {
+		return FormatAZW3, nil
+	}
+	exthFlags := binary.BigEndian.Uint32(record0[128:132])
+	exth := 16 + mobiHeaderLen
+	if exthFlags&0x40 == 0 || exth+12 > len(record0) || !bytes.Equal(record0[exth:exth+4], magicEXTH) {
+		return FormatMOBI, nil
+	}
+	count := int(binary.BigEndian.Uint32(record0[exth+8 : exth+12]))
+	p := exth + 12
+	for i := 0; i < count && p+8 <= len(record0); i++ {
+		recordType := binary.BigEndian.Uint32(record0[p : p+4])
+		recordLen := int(binary.BigEndian.Uint32(record0[p+4 : p+8]))
+		if recordLen < 8 || p+recordLen > len(record0) {
+			break
+		}
+		if recordType == exthKF8Offset && recordLen >= 12 && binary.BigEndian.Uint32(record0[p+8:p+12]) != mobiNoKF8 {
+			return FormatAZW3, nil
+		}
+		p += recordLen
+	}
+	return FormatMOBI, nil
+}
+
+// Record the format of completed downloads when each book finishes
+// and at the end of the run
+func (c *Client) formatHook(e Event) error {
+	switch e.Type {
+	case EventPostBook:
+		c.recordFormats(false)
+	case EventPostRun:
+		c.recordFormats(true)
+	}
+	return nil
+}
+
+// Find the files of the downloaded books in the manifest which don't
+// have a format yet, work out their format and record it.
+//
+// If Options.FormatDirs is set the files are moved into a
+// subdirectory named after the format.
+//
+// If wait is set then wait for files being downloaded to complete
+// first. Failures are logged and retried next time this is called.
+func (c *Client) recordFormats(wait bool) {
+	files, _, err := c.waitCompletedFiles(wait)
+	if err != nil {
+		slog.Error("Failed to find files to record format", "err", err)
+		return
+	}
+	// Don't give a file to more than one book
+	entries := c.manifest.Snapshot()
+	claimed := map[string]bool{}
+	for _, e := range entries {
+		if e.File != "" {
+			claimed[e.File] = true
+		}
+	}
+	var unclaimed []completedFile
+	for _, f := range files {
+		if !claimed[f.name] {
+			unclaimed = append(unclaimed, f)
+		}
+	}
+	for _, e := range entries {
+		if e.Status != StatusDownloaded || e.Format != "" {
+			continue
+		}
+		i := findBookFile(unclaimed, &e.Book)
+		if i < 0 {
+			continue
+		}
+		name := unclaimed[i].name
+		unclaimed = append(unclaimed[:i], unclaimed[i+1:]...)
+		err := c.recordFormat(&e, name)
+		if err != nil {
+			slog.Error("Failed to record format", "file", name, "err", err)
+		}
+	}
+}
+
+// Work out the format of name for the entry, move it to its format
+// directory, the place Options.OrganizePreset wants it or the name
+// Options.FilenameTemplate gives it if required and record it in the
+// manifest.
+func (c *Client) recordFormat(e *ManifestEntry, name string) error {
+	format, err := detectFormat(filepath.Join(c.downloadDir, filepath.FromSlash(name)))
+	if err != nil {
+		return fmt.Errorf("failed to detect format: %w", err)
+	}
+	hash := c.hashes[name]
+	newName := name
+	if c.opt.FormatDirs {
+		base := path.Base(name)
+		if c.opt.FilenameTemplate != "" {
+			base = c.templatedName(e, name, format)
+		}
+		newName = path.Join(contentDir(c.opt, e.Content), format, base)
+	} else if c.opt.OrganizePreset != "" {
+		newName = c.organizedName(e, name)
+	} else if c.opt.FilenameTemplate != "" {
+		newName = path.Join(contentDir(c.opt, e.Content), c.templatedName(e, name, format))
+	}
+	if newName != name {
+		newPath, err := uniquePath(filepath.Join(c.downloadDir, filepath.FromSlash(newName)))
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(filepath.Dir(newPath), 0777)
+		if err != nil {
+			return fmt.Errorf("failed to make directory for book: %w", err)
+		}
+		err = os.Rename(filepath.Join(c.downloadDir, filepath.FromSlash(name)), newPath)
+		if err != nil {
+			return fmt.Errorf("failed to move book to %q: %w", newName, err)
+		}
+		newName, err = filepath.Rel(c.downloadDir, newPath)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(newName)
+		if hash != "" {
+			c.hashes[name] = hash
+		}
+	}
+	slog.Info("Recorded book format", "file", name, "format", format)
+	err = c.manifest.setFile(&e.Book, e.Number, name, format, hash)
+	if err != nil {
+		return err
+	}
+	e.File, e.Format, e.SHA256 = name, format, hash
+	if c.opt.OrganizePreset == PresetKomga {
+		err = c.writeKomgaSeries(e)
+		if err != nil {
+			return err
+		}
+	}
+	return c.writeSidecar(e)
+}
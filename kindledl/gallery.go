@@ -0,0 +1,186 @@
+package kindledl
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// galleryBook is a book shown in the gallery
+type galleryBook struct {
+	ManifestEntry
+	Link string // relative link to the downloaded file, "" if not found
+}
+
+// galleryData is passed to the gallery template
+type galleryData struct {
+	Program string
+	Time    time.Time
+	Counts  map[string]int
+	Books   []galleryBook
+	Others  []galleryBook // files which aren't in the manifest
+}
+
+// The gallery is a single HTML file with no external resources
+// other than the covers so it can be browsed from a file share.
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Kindle books</title>
+<style>
+body { font-family: sans-serif; margin: 1em; background: #f4f4f4; color: #222; }
+header p { color: #666; }
+.books { display: grid; grid-template-columns: repeat(auto-fill, minmax(160px, 1fr)); gap: 1em; }
+.book { background: #fff; border-radius: 6px; padding: 0.6em; box-shadow: 0 1px 3px rgba(0,0,0,0.2); }
+.cover { width: 100%; aspect-ratio: 2 / 3; object-fit: contain; background: #ddd; display: block; }
+.nocover { width: 100%; aspect-ratio: 2 / 3; background: #ddd; display: flex; align-items: center; justify-content: center; text-align: center; color: #888; }
+.title { font-weight: bold; margin: 0.4em 0 0.2em; overflow-wrap: anywhere; }
+.authors { color: #555; font-size: 0.9em; }
+.badge { display: inline-block; border-radius: 3px; padding: 0 0.4em; font-size: 0.8em; color: #fff; background: #888; margin-top: 0.4em; }
+.downloaded { background: #2a7d2e; }
+.failed { background: #b3261e; }
+.skipped { background: #8a6d00; }
+a { color: inherit; }
+</style>
+</head>
+<body>
+<header>
+<h1>Kindle books</h1>
+<p>{{len .Books}} books{{range $status, $count := .Counts}} &middot; {{$count}} {{$status}}{{end}} &middot; made by {{.Program}} at {{.Time.Format "2006-01-02 15:04"}}</p>
+</header>
+<div class="books">
+{{- range .Books}}
+<div class="book" title="{{.Error}}">
+{{- if .Cover}}<img class="cover" src="{{.Cover}}" alt="" loading="lazy">{{else}}<div class="nocover">{{.Title}}</div>{{end}}
+<div class="title">{{if .Link}}<a href="{{.Link}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</div>
+<div class="authors">{{.Authors}}</div>
+<span class="badge {{.Status}}">{{.Status}}</span>
+</div>
+{{- end}}
+</div>
+{{- if .Others}}
+<h2>Other files</h2>
+<ul>
+{{- range .Others}}
+<li><a href="{{.Link}}">{{.Title}}</a></li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
+
+// Return a relative link from dir to the file name in the download
+// directory
+func (c *Client) galleryLink(dir, name string) string {
+	rel, err := filepath.Rel(dir, filepath.Join(c.downloadDir, filepath.FromSlash(name)))
+	if err != nil {
+		return ""
+	}
+	return (&url.URL{Path: filepath.ToSlash(rel)}).String()
+}
+
+// Find the downloaded file for the book
+//
+// The file names contain the ASIN or the title of the book. JSON
+// sidecars are never the book.
+func findBookFile(files []completedFile, b *Book) int {
+	for i, f := range files {
+		base := strings.ToLower(filepath.Base(f.name))
+		if strings.HasSuffix(base, jsonSidecarSuffix) {
+			continue
+		}
+		if b.ASIN != "" && strings.Contains(base, strings.ToLower(b.ASIN)) {
+			return i
+		}
+	}
+	title := strings.ToLower(b.Title)
+	if title == "" {
+		return -1
+	}
+	for i, f := range files {
+		base := strings.ToLower(filepath.Base(f.name))
+		if strings.HasSuffix(base, jsonSidecarSuffix) {
+			continue
+		}
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+		if strings.HasPrefix(title, base) || strings.HasPrefix(base, title) {
+			return i
+		}
+	}
+	return -1
+}
+
+// WriteGallery writes an HTML index of the books in the manifest and
+// the files in the download directory to path.
+func (c *Client) WriteGallery(path string) error {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("failed to find gallery directory: %w", err)
+	}
+	files, _, err := c.completedFiles()
+	if err != nil {
+		return err
+	}
+	entries := c.manifest.Snapshot()
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Number < entries[j].Number
+	})
+	data := galleryData{
+		Program: Program,
+		Time:    time.Now(),
+		Counts:  map[string]int{},
+	}
+	used := make([]bool, len(files))
+	galleryPath := filepath.Join(dir, filepath.Base(path))
+	for _, e := range entries {
+		gb := galleryBook{ManifestEntry: e}
+		if i := findBookFile(files, &e.Book); i >= 0 {
+			gb.Link = c.galleryLink(dir, files[i].name)
+			used[i] = true
+		}
+		data.Counts[e.Status]++
+		data.Books = append(data.Books, gb)
+	}
+	for i, f := range files {
+		if used[i] || filepath.Join(c.downloadDir, filepath.FromSlash(f.name)) == galleryPath {
+			continue
+		}
+		data.Others = append(data.Others, galleryBook{
+			ManifestEntry: ManifestEntry{Book: Book{Title: f.name}},
+			Link:          c.galleryLink(dir, f.name),
+		})
+	}
+	var buf bytes.Buffer
+	err = galleryTemplate.Execute(&buf, data)
+	if err != nil {
+		return fmt.Errorf("failed to make gallery: %w", err)
+	}
+	err = writeFileAtomic(path, buf.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write gallery: %w", err)
+	}
+	return nil
+}
+
+// Write the gallery at the end of the run
+func (c *Client) galleryHook(e Event) error {
+	if e.Type != EventPostRun {
+		return nil
+	}
+	err := c.WriteGallery(c.opt.Gallery)
+	if err != nil {
+		slog.Error("Failed to write gallery", "err", err)
+	} else {
+		slog.Info("Wrote gallery", "file", c.opt.Gallery)
+	}
+	return nil
+}
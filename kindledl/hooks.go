@@ -0,0 +1,92 @@
+package kindledl
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// EventType says at which point in the run an Event happened
+type EventType string
+
+// Types of Event
+const (
+	EventPreRun    EventType = "pre-run"    // before anything is downloaded
+	EventPostRun   EventType = "post-run"   // at the end of the run, Err is set if it failed
+	EventPostPage  EventType = "post-page"  // after all the books on a page are done
+	EventPreBook   EventType = "pre-book"   // before a book is downloaded
+	EventPostBook  EventType = "post-book"  // after a book has been downloaded or skipped
+	EventFailure   EventType = "on-failure" // when a book fails to download, Err is set
+	EventAttention EventType = "attention"  // when the run is blocked until the user does something, Err says what
+)
+
+// Event describes something that happened during the run
+type Event struct {
+	Type   EventType
+	Time   time.Time
+	Page   int            // page number being processed
+	Number int            // book number in the library, 1 based
+	Book   *Book          // book being processed, nil for run and page events
+	Status string         // status of the book for EventPostBook
+	Err    error          // error for EventFailure, EventPostRun and EventAttention
+	Counts map[string]int // number of books with each status so far
+}
+
+// Hook is called at each Event
+//
+// If a hook returns an error the run is stopped, except if an
+// EventPreBook hook returns ErrSkipBook in which case the book is
+// skipped.
+type Hook func(Event) error
+
+// ErrSkipBook may be returned from an EventPreBook Hook to skip the book
+var ErrSkipBook = errors.New("skip this book")
+
+// AddHook adds a hook to be called at each Event
+func (c *Client) AddHook(hook Hook) {
+	c.hooks = append(c.hooks, hook)
+}
+
+// Call the hooks with an event of type t
+func (c *Client) fireEvent(t EventType, b *Book, status string, eventErr error) error {
+	e := Event{
+		Type:   t,
+		Time:   time.Now(),
+		Page:   c.pageNumber,
+		Number: c.book,
+		Book:   b,
+		Status: status,
+		Err:    eventErr,
+		Counts: make(map[string]int, len(c.counts)),
+	}
+	for k, v := range c.counts {
+		e.Counts[k] = v
+	}
+	if c.post != nil && t == EventPostBook {
+		c.queuePost(e)
+		return nil
+	}
+	if t == EventPostRun {
+		// Let the post-processing catch up first
+		c.waitPost()
+	}
+	for i, hook := range c.hooks {
+		var err error
+		if c.post != nil && i < c.builtinHooks {
+			// The workers may be running the built in hooks too
+			c.post.mu.Lock()
+			err = hook(e)
+			c.post.mu.Unlock()
+		} else {
+			err = hook(e)
+		}
+		if errors.Is(err, ErrSkipBook) && t == EventPreBook {
+			return err
+		} else if err != nil {
+			slog.Debug("Hook failed", "event", t, "err", err)
+			return fmt.Errorf("%s hook failed: %w", t, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package kindledl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Set up a new page with the window size and identity from the options
+func (c *Client) setupPage(page *rod.Page) error {
+	err := c.setViewport(page)
+	if err != nil {
+		return err
+	}
+	if c.opt.Stealth {
+		err = c.setStealth(page)
+		if err != nil {
+			return err
+		}
+	}
+	return c.setIdentity(page)
+}
+
+// Make the page look like the user's normal browser by setting the
+// user agent, languages and timezone from the options.
+//
+// Amazon is more likely to challenge a session which looks different
+// from the one the user logged in with.
+func (c *Client) setIdentity(page *rod.Page) error {
+	if c.opt.UserAgent != "" || c.opt.AcceptLanguage != "" || c.opt.Stealth {
+		override := proto.NetworkSetUserAgentOverride{
+			UserAgent:      c.opt.UserAgent,
+			AcceptLanguage: c.opt.AcceptLanguage,
+		}
+		if override.UserAgent == "" {
+			version, err := proto.BrowserGetVersion{}.Call(page)
+			if err != nil {
+				return fmt.Errorf("failed to read user agent: %w", err)
+			}
+			override.UserAgent = version.UserAgent
+		}
+		if c.opt.Stealth {
+			override.UserAgent = strings.ReplaceAll(override.UserAgent, "HeadlessChrome", "Chrome")
+			override.UserAgentMetadata = clientHints(override.UserAgent)
+		}
+		err := override.Call(page)
+		if err != nil {
+			return fmt.Errorf("failed to set user agent: %w", err)
+		}
+	}
+	if c.opt.AcceptLanguage != "" {
+		// The locale is the first language without its weight
+		locale, _, _ := strings.Cut(c.opt.AcceptLanguage, ",")
+		locale, _, _ = strings.Cut(locale, ";")
+		err := proto.EmulationSetLocaleOverride{
+			Locale: strings.ReplaceAll(strings.TrimSpace(locale), "-", "_"),
+		}.Call(page)
+		if err != nil {
+			return fmt.Errorf("failed to set locale: %w", err)
+		}
+	}
+	if c.opt.Timezone != "" {
+		err := proto.EmulationSetTimezoneOverride{
+			TimezoneID: c.opt.Timezone,
+		}.Call(page)
+		if err != nil {
+			return fmt.Errorf("failed to set timezone %q: %w", c.opt.Timezone, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package kindledl
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Record the archived books and expired loans at the end of the run
+func (c *Client) inactiveHook(e Event) error {
+	if e.Type != EventPostRun {
+		return nil
+	}
+	err := c.RecordInactive(context.Background())
+	if err != nil {
+		slog.Error("Failed to record archived and expired books", "err", err)
+	}
+	return nil
+}
+
+// RecordInactive lists the archived books and expired loans in each
+// marketplace and records them in the manifest as StatusUnavailable
+// so it covers the whole history of the account.
+func (c *Client) RecordInactive(ctx context.Context) error {
+	defer func(i int) {
+		_ = c.useMarketplace(i)
+	}(c.marketplaceIndex)
+	var books []Book
+	for i := 0; i < c.numMarketplaces(); i++ {
+		err := c.useMarketplace(i)
+		if err != nil {
+			return err
+		}
+		it := c.ListInactiveBooks(ctx)
+		for it.Next() {
+			books = append(books, it.Book())
+		}
+		if err := it.Err(); err != nil {
+			return fmt.Errorf("failed to list archived and expired books: %w", err)
+		}
+	}
+	added, err := c.manifest.recordInventory(books, StatusUnavailable)
+	if err != nil {
+		return err
+	}
+	slog.Info("Recorded archived and expired books", "found", len(books), "added", added)
+	return nil
+}
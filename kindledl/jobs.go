@@ -0,0 +1,47 @@
+package kindledl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// JobFile is a Downloader which writes each DownloadJob to a file as
+// a line of JSON for another program to download.
+type JobFile struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewJobFile makes a JobFile which appends the jobs to path
+func NewJobFile(path string) *JobFile {
+	return &JobFile{path: path}
+}
+
+// Download writes the job to the file
+func (f *JobFile) Download(ctx context.Context, job DownloadJob) (err error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode download job: %w", err)
+	}
+	data = append(data, '\n')
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open download jobs file: %w", err)
+	}
+	defer func() {
+		closeErr := out.Close()
+		if err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to close download jobs file: %w", closeErr)
+		}
+	}()
+	_, err = out.Write(data)
+	if err != nil {
+		return fmt.Errorf("failed to write download jobs file: %w", err)
+	}
+	return nil
+}
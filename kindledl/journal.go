@@ -0,0 +1,86 @@
+package kindledl
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// errInterrupted is recorded for books whose download was interrupted
+// by a crash
+var errInterrupted = errors.New("run was interrupted before the download arrived")
+
+// Record in the manifest that the book is about to be downloaded, so
+// if the run crashes before the outcome is recorded the book can be
+// checked at the next start by reconcileJournal.
+func (c *Client) journalStart(meta *Book) error {
+	err := c.manifest.record(*meta, c.book, StatusDownloading, nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to record download start: %w", err)
+	}
+	return nil
+}
+
+// Check the books left as StatusDownloading by a run which crashed
+// between clicking download and recording the outcome.
+//
+// If the file arrived the book is recorded as downloaded and isn't
+// downloaded again this run. Otherwise it is recorded as failed so it
+// isn't a silent gap and it gets downloaded again when the run reaches
+// it.
+func (c *Client) reconcileJournal() error {
+	entries := c.manifest.Snapshot()
+	var interrupted []ManifestEntry
+	claimed := map[string]bool{}
+	for _, e := range entries {
+		if e.Status == StatusDownloading {
+			interrupted = append(interrupted, e)
+		}
+		if e.File != "" {
+			claimed[e.File] = true
+		}
+	}
+	if len(interrupted) == 0 {
+		return nil
+	}
+	files, _, err := c.completedFiles()
+	if err != nil {
+		return fmt.Errorf("failed to check interrupted downloads: %w", err)
+	}
+	var unclaimed []completedFile
+	for _, f := range files {
+		if !claimed[f.name] {
+			unclaimed = append(unclaimed, f)
+		}
+	}
+	for _, e := range interrupted {
+		subLog := slog.With("book", e.Number, "asin", e.ASIN, "title", e.Title)
+		i := findBookFile(unclaimed, &e.Book)
+		if i < 0 {
+			subLog.Warn("Download interrupted by the last run didn't arrive - it will be downloaded again")
+			err = c.manifest.record(e.Book, e.Number, StatusFailed, errInterrupted, e.Curl)
+			if err != nil {
+				return err
+			}
+			err = c.recordState(&e.Book, e.Number, StatusFailed, errInterrupted)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		subLog.Info("Download interrupted by the last run arrived", "file", unclaimed[i].name)
+		unclaimed = append(unclaimed[:i], unclaimed[i+1:]...)
+		err = c.manifest.record(e.Book, e.Number, StatusDownloaded, nil, e.Curl)
+		if err != nil {
+			return err
+		}
+		err = c.recordState(&e.Book, e.Number, StatusDownloaded, nil)
+		if err != nil {
+			return err
+		}
+		if e.ASIN != "" {
+			c.seen[e.ASIN] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package kindledl
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/go-rod/rod"
+)
+
+// Returns the names of the kindles to download each book for
+func (opt *Options) kindles() []string {
+	if len(opt.Kindles) > 0 {
+		return opt.Kindles
+	}
+	return []string{opt.KindleName}
+}
+
+// Check the kindles in the options can be used together
+func (opt *Options) checkKindles() error {
+	if len(opt.Kindles) < 2 {
+		return nil
+	}
+	if opt.Downloader != nil {
+		return errors.New("can't download for more than one kindle with a Downloader")
+	}
+	// The manifest only has room for one file for each book
+	if opt.FormatDirs || opt.OrganizePreset != "" || opt.FilenameTemplate != "" {
+		return errors.New("can't move, organize or rename the books when downloading for more than one kindle")
+	}
+	seen := map[string]bool{}
+	for _, name := range opt.Kindles {
+		dir := kindleDirName(name)
+		if seen[dir] {
+			return fmt.Errorf("kindle names %q give the same directory %q", opt.Kindles, dir)
+		}
+		seen[dir] = true
+	}
+	return nil
+}
+
+// Compile the regexps to find each kindle in the device dialog
+//
+// The first is c.reKindleName, so the selectors for it apply, and
+// the others use the same selectors if any are set.
+func (c *Client) compileKindles() error {
+	c.reKindles = []*regexp.Regexp{c.reKindleName}
+	for _, name := range c.opt.kindles()[1:] {
+		re, err := regexp.Compile(`(?i)^\s*` + name + `\s*$`)
+		if err != nil {
+			return fmt.Errorf("failed to compile kindle name %q as regexp: %w", name, err)
+		}
+		if selector, ok := c.overrides[c.reKindleName]; ok {
+			c.overrides[re] = selector
+		}
+		if name, ok := c.selectors[c.reKindleName]; ok {
+			c.selectors[re] = name
+		}
+		c.reKindles = append(c.reKindles, re)
+	}
+	return nil
+}
+
+// Returns the name of the kindle being downloaded for
+func (c *Client) kindleName() string {
+	return c.opt.kindles()[c.kindleIndex]
+}
+
+// Returns the name of the subdirectory of Output for the kindle name
+func kindleDirName(name string) string {
+	return safeName(name, "kindle")
+}
+
+// Returns the subdirectory of Output for the kindle being downloaded
+// for, or "" if there is only one kindle
+func (c *Client) kindleDir() string {
+	if len(c.opt.Kindles) < 2 {
+		return ""
+	}
+	return kindleDirName(c.kindleName())
+}
+
+// Returns the kindle subdirectory of Output the file name, / separated
+// and relative to Output, is in, or "" if it isn't in one
+func (c *Client) kindleDirOf(name string) string {
+	if len(c.opt.Kindles) < 2 {
+		return ""
+	}
+	first, _, found := strings.Cut(name, "/")
+	if !found {
+		return ""
+	}
+	for _, kindle := range c.opt.Kindles {
+		if first == kindleDirName(kindle) {
+			return first
+		}
+	}
+	return ""
+}
+
+// Returns the name of the kindle the file name, / separated and
+// relative to Output, was downloaded for
+func (c *Client) kindleOf(name string) string {
+	dir := c.kindleDirOf(name)
+	if dir == "" {
+		return c.opt.KindleName
+	}
+	for _, kindle := range c.opt.Kindles {
+		if kindleDirName(kindle) == dir {
+			return kindle
+		}
+	}
+	return c.opt.KindleName
+}
+
+// Download for kindle i, pointing the browser's downloads at its
+// directory for the current content type even if i is already in use
+func (c *Client) resetKindle(i int) error {
+	c.kindleIndex = -1
+	return c.useKindle(i)
+}
+
+// Download for kindle i, pointing the browser's downloads at its
+// directory
+func (c *Client) useKindle(i int) error {
+	if i == c.kindleIndex {
+		return nil
+	}
+	c.kindleIndex = i
+	if c.browser == nil || c.opt.Downloader != nil {
+		return nil
+	}
+	return c.setDownloadBehavior(c.browserDownloadDir())
+}
+
+// Find the li in the device dialog for the kindle being downloaded for
+//
+// If the kindle can't be found by name but only one kindle is
+// registered to the account then that one is used.
+func (c *Client) findKindle(subLog *slog.Logger) (*rod.Element, error) {
+	kindle, err := c.findOneElementWithText(subLog, "li div", c.reKindles[c.kindleIndex])
+	if errors.Is(err, errNoneFound) && len(c.reKindles) == 1 {
+		li, onlyErr := c.onlyKindle(subLog)
+		if onlyErr != nil {
+			subLog.Debug("Couldn't use the only kindle in menu", "err", onlyErr)
+		} else if li != nil {
+			return li, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't find kindle name in menu (-kindle=%q): %w", c.kindleName(), err)
+	}
+	li, err := kindle.Parent()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't find li parent of kindle: %w", err)
+	}
+	return li, nil
+}
+
+// Returns the li of each kindle in the device dialog, found by its
+// radio button
+func (c *Client) kindleItems() (items rod.Elements, err error) {
+	radios, err := c.page.Elements("li input[type='radio']")
+	if err != nil {
+		return nil, fmt.Errorf("error looking for kindles in menu: %w", err)
+	}
+	for _, radio := range radios {
+		parents, err := radio.Parents("li")
+		if err != nil {
+			return nil, fmt.Errorf("couldn't find li parent of kindle: %w", err)
+		}
+		li := parents.First()
+		if li == nil {
+			return nil, errors.New("couldn't find li parent of kindle")
+		}
+		items = append(items, li)
+	}
+	return items, nil
+}
+
+// Returns the li of the kindle in the device dialog if it is the only
+// one there, or nil if there are more
+func (c *Client) onlyKindle(subLog *slog.Logger) (*rod.Element, error) {
+	items, err := c.kindleItems()
+	if err != nil {
+		return nil, err
+	}
+	if len(items) != 1 {
+		subLog.Debug("Not choosing kindle as more than one in menu", "kindles", len(items))
+		return nil, nil
+	}
+	li := items[0]
+	name, err := li.Text()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read name of kindle: %w", err)
+	}
+	subLog.Warn("Kindle not found in menu so using the only one there - fix -kindle to stop this warning", "kindle", c.kindleName(), "found", strings.TrimSpace(name))
+	return li, nil
+}
@@ -0,0 +1,381 @@
+package kindledl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// Book is the metadata Amazon holds about a single book in the library
+type Book struct {
+	ASIN         string   `json:"asin"`
+	Title        string   `json:"title,omitempty"`
+	Authors      string   `json:"authors,omitempty"`
+	Acquired     string   `json:"acquired,omitempty"`
+	Availability string   `json:"availability,omitempty"` // eg Active
+	OrderID      string   `json:"order_id,omitempty"`
+	OrderDate    string   `json:"order_date,omitempty"`   // only set with -enrich-orders
+	Price        string   `json:"price,omitempty"`        // only set with -enrich-orders
+	ReadStatus   string   `json:"read_status,omitempty"`  // eg READ, UNREAD
+	Marketplace  string   `json:"marketplace,omitempty"`  // host of the marketplace, only set with Options.Marketplaces
+	Content      string   `json:"content,omitempty"`      // type of content, eg docs, only set with Options.ContentTypes
+	Audible      bool     `json:"audible,omitempty"`      // has Audible companion narration
+	Whispersync  bool     `json:"whispersync,omitempty"`  // has Whispersync for Voice data
+	Origin       string   `json:"origin,omitempty"`       // how the book was acquired, eg Purchase, Rental, Sample
+	Expires      string   `json:"expires,omitempty"`      // when a rental expires
+	Renews       string   `json:"renews,omitempty"`       // when a subscription renews
+	Tags         []string `json:"tags,omitempty"`         // the user's own tags from Options.Tags
+	PercentRead  int      `json:"percent_read,omitempty"` // how far through the book the reader is
+	Collections  []string `json:"collections,omitempty"`  // names of the collections the book is in
+	Cover        string   `json:"cover,omitempty"`        // URL of the cover image
+}
+
+// ownershipItem is a single item as returned by the content list AJAX call
+type ownershipItem struct {
+	ASIN           string  `json:"asin"`
+	Title          string  `json:"title"`
+	Authors        string  `json:"authors"`
+	AcquiredDate   string  `json:"acquiredDate"`
+	OrderID        string  `json:"orderId"`
+	OrderDetailURL string  `json:"orderDetailURL"`
+	ItemStatus     string  `json:"itemStatus"`
+	ReadStatus     string  `json:"readStatus"`
+	PercentageRead float64 `json:"percentageRead"`
+	ProductImage   string  `json:"productImage"`
+	CollectionList []struct {
+		ID   string `json:"collectionId"`
+		Name string `json:"collectionName"`
+	} `json:"collectionList"`
+	CapabilityList []string `json:"capabilityList"` // eg AUDIBLE_NARRATION, WHISPERSYNC
+	OriginType     string   `json:"originType"`     // eg Purchase, Rental, Sample
+	ExpirationDate string   `json:"expirationDate"` // for rentals and loans
+	RenewalDate    string   `json:"renewalDate"`    // for subscriptions
+}
+
+// ownershipResponse is the response to the content list AJAX call
+type ownershipResponse struct {
+	Success bool `json:"success"`
+	Data    struct {
+		Success       bool            `json:"success"`
+		NumberOfItems int             `json:"numberOfItems"`
+		HasMoreItems  bool            `json:"hasMoreItems"`
+		Items         []ownershipItem `json:"items"`
+	} `json:"GetContentOwnershipData"`
+}
+
+// ownershipRequest is the activityInput of the content list AJAX call
+type ownershipRequest struct {
+	ContentType              string        `json:"contentType"`
+	ContentCategoryReference string        `json:"contentCategoryReference"`
+	ItemStatusList           []string      `json:"itemStatusList"`
+	OriginTypes              []string      `json:"originTypes"`
+	ShowSharedContent        bool          `json:"showSharedContent"`
+	SearchText               string        `json:"searchText,omitempty"`
+	CollectionIDs            []string      `json:"collectionIdList,omitempty"`
+	FetchCriteria            fetchCriteria `json:"fetchCriteria"`
+}
+
+// fetchCriteria selects which part of the content list to fetch
+type fetchCriteria struct {
+	SortOrder         string `json:"sortOrder"`
+	SortIndex         string `json:"sortIndex"`
+	StartIndex        int    `json:"startIndex"`
+	BatchSize         int    `json:"batchSize"`
+	TotalContentCount int    `json:"totalContentCount"`
+}
+
+// This runs in the page to call the same AJAX endpoint the content
+// list uses to fetch its data, using the page's CSRF token.
+const ownershipJS = `async (activityInput) => {
+	const body = new URLSearchParams({
+		activity: "GetContentOwnershipData",
+		activityInput: activityInput,
+		csrfToken: window.csrfToken,
+	});
+	const resp = await fetch("/hz/mycd/digital-console/ajax", {
+		method: "POST",
+		body: body,
+		credentials: "include",
+	});
+	if (resp.redirected && resp.url.includes("/signin")) {
+		throw new Error("login required");
+	}
+	if (!resp.ok) {
+		throw new Error("HTTP error " + resp.status);
+	}
+	return await resp.text();
+}`
+
+// itemFilter selects which items the content list returns
+type itemFilter struct {
+	contentType string   // eg Ebook
+	category    string   // tab of the content list, eg booksAll
+	statuses    []string // eg Active
+	origins     []string // how the book was acquired, eg Purchase
+	search      bool     // set to apply Options.Search
+	collections bool     // set to apply Options.Collections if the content list can
+}
+
+// Filters for the content list
+var (
+	// The books which can be downloaded, as shown on the books page
+	activeItems = itemFilter{
+		contentType: "Ebook",
+		category:    "booksAll",
+		statuses:    []string{"Active"},
+		origins:     []string{"Purchase", "Rental", "Sample"},
+		search:      true,
+		collections: true,
+	}
+	// Archived items and expired loans which can't be downloaded
+	inactiveItems = itemFilter{
+		contentType: "Ebook",
+		category:    "booksAll",
+		statuses:    []string{"Archived", "Expired", "Returned"},
+		origins:     []string{"Purchase", "KindleUnlimited", "Prime", "PublicLibraryLending", "PersonalLending", "Rental"},
+		search:      true,
+	}
+	// Newspaper and magazine subscriptions, as shown on the
+	// Newspapers & Magazines tab
+	subscriptionItems = itemFilter{
+		contentType: "KindlePeriodical",
+		category:    "newsstandSubscriptions",
+		statuses:    []string{"Active"},
+		origins:     []string{"Subscription"},
+	}
+)
+
+// Fetch the metadata for batchSize books starting from startIndex (0
+// based) in the same order as the books page shows them.
+func (c *Client) fetchBooks(ctx context.Context, startIndex, batchSize int) ([]Book, error) {
+	books, err := c.fetchItems(ctx, c.contentFilter(), startIndex, batchSize)
+	for i := range books {
+		books[i].Content = c.content
+	}
+	return books, err
+}
+
+// Fetch the metadata for batchSize items selected by filter starting
+// from startIndex (0 based).
+func (c *Client) fetchItems(ctx context.Context, filter itemFilter, startIndex, batchSize int) ([]Book, error) {
+	sortIndex, sortOrder := c.sortCriteria()
+	req := ownershipRequest{
+		ContentType:              filter.contentType,
+		ContentCategoryReference: filter.category,
+		ItemStatusList:           filter.statuses,
+		OriginTypes:              filter.origins,
+		ShowSharedContent:        true,
+		FetchCriteria: fetchCriteria{
+			SortOrder:         sortOrder,
+			SortIndex:         sortIndex,
+			StartIndex:        startIndex,
+			BatchSize:         batchSize,
+			TotalContentCount: -1,
+		},
+	}
+	if filter.search {
+		req.SearchText = c.opt.Search
+	}
+	if filter.collections {
+		req.CollectionIDs = c.collectionIDs
+	}
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make content list request: %w", err)
+	}
+	res, err := c.page.Context(ctx).Eval(ownershipJS, string(reqJSON))
+	if err != nil && strings.Contains(err.Error(), "login required") {
+		return nil, fmt.Errorf("content list request failed: %w", ErrNotLoggedIn)
+	} else if err != nil {
+		return nil, fmt.Errorf("content list request failed: %w", classifyNetworkError(err))
+	}
+	var resp ownershipResponse
+	err = json.Unmarshal([]byte(res.Value.Str()), &resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode content list response: %w", err)
+	}
+	if !resp.Success || !resp.Data.Success {
+		return nil, fmt.Errorf("content list request was not successful")
+	}
+	books := make([]Book, 0, len(resp.Data.Items))
+	for _, item := range resp.Data.Items {
+		if c.collections != nil {
+			for _, collection := range item.CollectionList {
+				if collection.ID != "" {
+					c.collections[collectionKey(collection.Name)] = collection.ID
+				}
+			}
+		}
+		b := item.book()
+		b.Marketplace = c.marketplace
+		b.Tags = c.opt.Tags[strings.ToUpper(b.ASIN)]
+		books = append(books, b)
+	}
+	return books, nil
+}
+
+// Batch size to use when listing the library
+const listBatchSize = 100
+
+// BookIter iterates over the books in the library
+//
+// Use it like this
+//
+//	it := c.ListBooks(ctx)
+//	for it.Next() {
+//		book := it.Book()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type BookIter struct {
+	c      *Client
+	ctx    context.Context
+	filter itemFilter // which items to list
+	books  []Book     // current batch of books
+	i      int        // index of the current book in books
+	start  int        // index in the library of the start of the next batch
+	done   bool       // set if there are no more batches
+	err    error
+}
+
+// ListBooks returns an iterator over all the books in the library in
+// the same order the books page shows them.
+//
+// This doesn't download anything.
+func (c *Client) ListBooks(ctx context.Context) *BookIter {
+	return &BookIter{
+		c:      c,
+		ctx:    ctx,
+		filter: activeItems,
+		i:      -1,
+	}
+}
+
+// ListInactiveBooks returns an iterator over the archived books and
+// expired loans in the library. These can't be downloaded.
+func (c *Client) ListInactiveBooks(ctx context.Context) *BookIter {
+	it := c.ListBooks(ctx)
+	it.filter = inactiveItems
+	return it
+}
+
+// Next advances to the next book returning false if there are no more
+// books or there was an error.
+func (it *BookIter) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.i++
+	if it.i < len(it.books) {
+		return true
+	}
+	if it.done {
+		return false
+	}
+	if it.start == 0 {
+		it.err = it.c.openLibrary(it.ctx)
+		if it.err != nil {
+			return false
+		}
+	}
+	slog.Debug("Listing books", "start", it.start)
+	it.books, it.err = it.c.fetchItems(it.ctx, it.filter, it.start, listBatchSize)
+	if it.err != nil {
+		return false
+	}
+	it.start += len(it.books)
+	it.done = len(it.books) < listBatchSize
+	it.i = 0
+	return len(it.books) > 0
+}
+
+// Book returns the current book
+func (it *BookIter) Book() Book {
+	return it.books[it.i]
+}
+
+// Number returns the position of the current book in the library, 1 based
+func (it *BookIter) Number() int {
+	return it.start - len(it.books) + it.i + 1
+}
+
+// Err returns the error, if any, which stopped the iteration
+func (it *BookIter) Err() error {
+	return it.err
+}
+
+// Find the book with the asin in the library, returning its book
+// number (1 based).
+func (c *Client) findASIN(ctx context.Context, asin string) (int, error) {
+	it := c.ListBooks(ctx)
+	it.filter = c.contentFilter()
+	for it.Next() {
+		b := it.Book()
+		if strings.EqualFold(b.ASIN, asin) {
+			slog.Info("Found start ASIN", "asin", asin, "book", it.Number(), "title", b.Title)
+			return it.Number(), nil
+		}
+	}
+	if err := it.Err(); err != nil {
+		return 0, fmt.Errorf("failed to find ASIN %q: %w", asin, err)
+	}
+	return 0, fmt.Errorf("ASIN %q not found in library", asin)
+}
+
+// Rental returns whether the book is a rental, eg an eTextbook
+func (b *Book) Rental() bool {
+	return strings.EqualFold(b.Origin, "Rental")
+}
+
+// Convert the AJAX data into a Book
+func (item *ownershipItem) book() Book {
+	b := Book{
+		ASIN:         item.ASIN,
+		Title:        item.Title,
+		Authors:      item.Authors,
+		Acquired:     item.AcquiredDate,
+		Availability: item.ItemStatus,
+		OrderID:      item.OrderID,
+		ReadStatus:   item.ReadStatus,
+		PercentRead:  int(item.PercentageRead + 0.5),
+		Cover:        item.ProductImage,
+		Origin:       item.OriginType,
+		Expires:      item.ExpirationDate,
+		Renews:       item.RenewalDate,
+	}
+	for _, collection := range item.CollectionList {
+		b.Collections = append(b.Collections, collection.Name)
+	}
+	b.Audible = hasCapability(item.CapabilityList, "AUDIBLE", "NARRATION")
+	b.Whispersync = hasCapability(item.CapabilityList, "WHISPERSYNC")
+	// Not all responses have the order ID, but the order details
+	// link always contains it.
+	if b.OrderID == "" && item.OrderDetailURL != "" {
+		u, err := url.Parse(item.OrderDetailURL)
+		if err == nil {
+			b.OrderID = u.Query().Get("orderID")
+		}
+	}
+	return b
+}
+
+// Returns whether any of the capabilities contains any of the words
+//
+// The capability names aren't documented and vary a little so they are
+// matched loosely.
+func hasCapability(capabilities []string, words ...string) bool {
+	for _, capability := range capabilities {
+		capability = strings.ToUpper(capability)
+		for _, word := range words {
+			if strings.Contains(capability, word) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package kindledl
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+)
+
+// Formats for ListLibrary
+const (
+	ListCSV  = "csv"
+	ListJSON = "json"
+)
+
+// Columns written by ListLibrary as CSV
+var listColumns = []string{
+	"number",
+	"asin",
+	"title",
+	"authors",
+	"acquired",
+	"origin",
+	"content",
+	"marketplace",
+	"read_status",
+}
+
+// ListedBook is a book written by ListLibrary
+type ListedBook struct {
+	Book
+	Number int `json:"number"` // position of the book in the library, 1 based
+}
+
+// Return the CSV row for the book
+func (b *ListedBook) csvRow() []string {
+	return []string{
+		strconv.Itoa(b.Number),
+		b.ASIN,
+		b.Title,
+		b.Authors,
+		b.Acquired,
+		b.Origin,
+		b.Content,
+		b.Marketplace,
+		b.ReadStatus,
+	}
+}
+
+// ListLibrary starts the browser and writes every book in the library
+// to w in format, ListCSV or ListJSON, without downloading anything.
+//
+// It goes through each of Options.Marketplaces and
+// Options.ContentTypes in turn as a run would. It returns
+// ErrNotLoggedIn straight away rather than waiting for the user to
+// log in.
+func ListLibrary(ctx context.Context, opt *Options, w io.Writer, format string) (err error) {
+	if format != ListCSV && format != ListJSON {
+		return fmt.Errorf("unknown list format %q - use %s or %s", format, ListCSV, ListJSON)
+	}
+	c, err := newClient(opt)
+	if err != nil {
+		return err
+	}
+	c.noLoginWait = true
+	err = c.startBrowser()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	books := []ListedBook{}
+	var cw *csv.Writer
+	if format == ListCSV {
+		cw = csv.NewWriter(w)
+		err = cw.Write(listColumns)
+		if err != nil {
+			return fmt.Errorf("failed to write list: %w", err)
+		}
+	}
+	for content := 0; content < c.numContentTypes(); content++ {
+		c.useContentType(content)
+		for i := 0; i < c.numMarketplaces(); i++ {
+			err = c.useMarketplace(i)
+			if err != nil {
+				return err
+			}
+			err = c.selectProfile(ctx)
+			if err != nil {
+				return err
+			}
+			slog.Info("Listing library", "marketplace", c.marketplace, "content", c.content)
+			it := c.ListBooks(ctx)
+			it.filter = c.contentFilter()
+			for it.Next() {
+				b := ListedBook{Book: it.Book(), Number: it.Number()}
+				b.Content = c.content
+				if cw != nil {
+					err = cw.Write(b.csvRow())
+					if err != nil {
+						return fmt.Errorf("failed to write list: %w", err)
+					}
+				} else {
+					books = append(books, b)
+				}
+			}
+			err = it.Err()
+			if err != nil {
+				return fmt.Errorf("failed to list library: %w", err)
+			}
+		}
+	}
+	if cw != nil {
+		cw.Flush()
+		err = cw.Error()
+	} else {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		err = enc.Encode(books)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write list: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package kindledl
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultLocale is the locale the default Options use
+const DefaultLocale = "en"
+
+// Directory in the config directory for the user's own locales
+const localesDir = "locales"
+
+// The built in locales
+//
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// Locale is a bundle of the text to look for on the Amazon pages in
+// one language
+//
+// Locales are JSON files like locales/en.json. The built in ones can
+// be overridden, or new ones added, by putting a file with the same
+// name in the locales directory of the config directory. Only the
+// messages which need changing need to be in the override.
+type Locale struct {
+	Name        string            `json:"-"`           // name of the locale, eg de
+	Description string            `json:"description"` // what the locale is for, eg German, eg amazon.de
+	Messages    map[string]string `json:"messages"`    // regexps keyed by the -msg-* flag they set without the prefix, eg more-actions
+	Sources     []string          `json:"-"`           // where the locale was read from, built in or the file
+}
+
+// Source to show for a built in locale
+const builtinLocale = "built in"
+
+// The Options each message in a Locale sets
+func localeMessages(opt *Options) map[string]*string {
+	return map[string]*string{
+		"more-actions":    &opt.MsgMoreActions,
+		"download-usb":    &opt.MsgDownloadViaUSB,
+		"clear-furthest":  &opt.MsgClearFurthest,
+		"download-button": &opt.MsgDownloadButton,
+		"success":         &opt.MsgSuccess,
+		"showing":         &opt.MsgShowing,
+		"order-total":     &opt.MsgOrderTotal,
+		"order-date":      &opt.MsgOrderDate,
+		"profile-menu":    &opt.MsgProfileMenu,
+	}
+}
+
+// LocaleMessageNames returns the names of the messages a Locale can
+// have, sorted
+func LocaleMessageNames() []string {
+	var names []string
+	for name := range localeMessages(&Options{}) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply sets the messages in opt from the locale
+func (l *Locale) Apply(opt *Options) {
+	msgs := localeMessages(opt)
+	for name, value := range l.Messages {
+		if p := msgs[name]; p != nil {
+			*p = value
+		}
+	}
+}
+
+// Merge the locale in data from source into l, checking its messages
+func (l *Locale) merge(data []byte, source string) error {
+	var in Locale
+	err := json.Unmarshal(data, &in)
+	if err != nil {
+		return fmt.Errorf("failed to read locale %q from %s: %w", l.Name, source, err)
+	}
+	msgs := localeMessages(&Options{})
+	for name, value := range in.Messages {
+		if msgs[name] == nil {
+			return fmt.Errorf("unknown message %q in locale %q from %s - use one of %s", name, l.Name, source, strings.Join(LocaleMessageNames(), ", "))
+		}
+		_, err = regexp.Compile(value)
+		if err != nil {
+			return fmt.Errorf("bad regexp for message %q in locale %q from %s: %w", name, l.Name, source, err)
+		}
+		if l.Messages == nil {
+			l.Messages = map[string]string{}
+		}
+		l.Messages[name] = value
+	}
+	if in.Description != "" {
+		l.Description = in.Description
+	}
+	l.Sources = append(l.Sources, source)
+	return nil
+}
+
+// Returns the directory for the user's own locales
+func userLocalesDir(opt *Options) (string, error) {
+	root, err := ConfigRoot(opt)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, localesDir), nil
+}
+
+// LoadLocale reads the locale called name
+//
+// This is the built in locale with the user's file of the same name
+// in the config directory, if any, on top.
+func LoadLocale(opt *Options, name string) (*Locale, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid locale name %q", name)
+	}
+	l := &Locale{Name: name}
+	data, err := localeFS.ReadFile(path.Join(localesDir, name+".json"))
+	if err == nil {
+		err = l.merge(data, builtinLocale)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dir, err := userLocalesDir(opt)
+	if err != nil {
+		return nil, err
+	}
+	file := filepath.Join(dir, name+".json")
+	data, err = os.ReadFile(file)
+	if err == nil {
+		err = l.merge(data, file)
+		if err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read locale: %w", err)
+	}
+	if len(l.Sources) == 0 {
+		names, _ := localeNames(opt)
+		return nil, fmt.Errorf("unknown locale %q - use one of %s or add %s", name, strings.Join(names, ", "), file)
+	}
+	return l, nil
+}
+
+// Returns the names of the built in locales and the user's own, sorted
+func localeNames(opt *Options) ([]string, error) {
+	seen := map[string]bool{}
+	builtin, err := fs.Glob(localeFS, path.Join(localesDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range builtin {
+		seen[strings.TrimSuffix(path.Base(name), ".json")] = true
+	}
+	dir, err := userLocalesDir(opt)
+	if err != nil {
+		return nil, err
+	}
+	user, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range user {
+		seen[strings.TrimSuffix(filepath.Base(name), ".json")] = true
+	}
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ListLocales returns the built in locales and the user's own, sorted
+// by name
+func ListLocales(opt *Options) ([]*Locale, error) {
+	names, err := localeNames(opt)
+	if err != nil {
+		return nil, err
+	}
+	var locales []*Locale
+	for _, name := range names {
+		l, err := LoadLocale(opt, name)
+		if err != nil {
+			return nil, err
+		}
+		locales = append(locales, l)
+	}
+	return locales, nil
+}
+
+// Returns the built in locale called name, panicking if it is broken
+// as that is a bug
+func mustLocale(name string) *Locale {
+	l := &Locale{Name: name}
+	data, err := localeFS.ReadFile(path.Join(localesDir, name+".json"))
+	if err == nil {
+		err = l.merge(data, builtinLocale)
+	}
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
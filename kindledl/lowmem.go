@@ -0,0 +1,84 @@
+package kindledl
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// LowMemoryRecycleBooks is the default number of books to download before
+// restarting the browser in low memory mode
+const LowMemoryRecycleBooks = 100
+
+// Chrome flags to use less memory
+//
+// Chrome's --single-process mode crashes too often to be usable, so
+// instead the renderers are limited to a single process.
+func lowMemoryFlags(l *launcher.Launcher) *launcher.Launcher {
+	return l.
+		Set("renderer-process-limit", "1").
+		Set("process-per-site").
+		Set("disable-site-isolation-trials").
+		Set("disable-extensions").
+		Set("disable-background-networking").
+		Set("enable-low-end-device-mode").
+		Set("disable-features", "Translate,BackForwardCache,MediaRouter,OptimizationHints").
+		Set("aggressive-cache-discard").
+		Set("js-flags", "--max-old-space-size=256").
+		Set("window-size", "1024,768")
+}
+
+// Free as much memory as possible in the browser between pages
+//
+// This closes any tabs other than the main one, clears the cache and
+// runs the garbage collector.
+func (c *Client) freeMemory() {
+	pages, err := c.browser.Pages()
+	if err != nil {
+		slog.Debug("Failed to list tabs", "err", err)
+	}
+	for _, page := range pages {
+		if page.TargetID != c.page.TargetID {
+			slog.Debug("Discarding tab", "target", page.TargetID)
+			_ = page.Close()
+		}
+	}
+	err = proto.NetworkClearBrowserCache{}.Call(c.page)
+	if err != nil {
+		slog.Debug("Failed to clear browser cache", "err", err)
+	}
+	err = proto.HeapProfilerCollectGarbage{}.Call(c.page)
+	if err != nil {
+		slog.Debug("Failed to collect garbage", "err", err)
+	}
+}
+
+// Returns the number of books processed this run
+func (c *Client) booksDone() (n int) {
+	for _, count := range c.counts {
+		n += count
+	}
+	return n
+}
+
+// Called between pages to restart the browser every RecycleBooks
+// books to get back the memory it leaks, and to free memory in low
+// memory mode.
+func (c *Client) recycleBrowser() error {
+	if c.opt.RecycleBooks > 0 && c.booksDone()-c.recycledAt >= c.opt.RecycleBooks {
+		slog.Info("Restarting browser to free memory", "books", c.booksDone()-c.recycledAt)
+		c.Close()
+		err := c.startBrowser()
+		if err != nil {
+			return fmt.Errorf("failed to restart browser: %w", err)
+		}
+		c.recycledAt = c.booksDone()
+		return nil
+	}
+	if c.opt.LowMemory {
+		c.freeMemory()
+	}
+	return nil
+}
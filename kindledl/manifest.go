@@ -0,0 +1,235 @@
+package kindledl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// Status of a book in the manifest
+const (
+	StatusDownloaded   = "downloaded"
+	StatusSkipped      = "skipped"
+	StatusFailed       = "failed"
+	StatusQueued       = "queued"       // handed to Options.Downloader to download
+	StatusDownloading  = "downloading"  // download clicked but outcome not recorded yet
+	StatusUnavailable  = "unavailable"  // archived or an expired loan so can't be downloaded
+	StatusSubscription = "subscription" // an active newspaper or magazine subscription
+)
+
+// ManifestEntry is the record of what happened to a single book
+type ManifestEntry struct {
+	Book
+	Number int       `json:"number"` // position of the book in the library, 1 based
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+	Error  string    `json:"error,omitempty"`
+	Curl   string    `json:"curl,omitempty"`   // command to download the book again while the session lasts
+	File   string    `json:"file,omitempty"`   // path of the downloaded file relative to the output directory
+	Format string    `json:"format,omitempty"` // format Amazon delivered the book in, eg azw3, mobi, kfx
+	SHA256 string    `json:"sha256,omitempty"` // hash of the file, only set with Options.Staging
+	URL    string    `json:"url,omitempty"`    // URL the browser downloaded the book from, only set with Options.JSONSidecar
+}
+
+// Manifest records every book we've processed
+//
+// It is safe to read the manifest with Snapshot while books are being
+// recorded.
+type Manifest struct {
+	mu      sync.Mutex
+	store   Store
+	Entries []*ManifestEntry `json:"entries"`
+}
+
+// LoadManifest reads the manifest from path, returning an empty one if
+// it doesn't exist yet
+func LoadManifest(path string) (*Manifest, error) {
+	return LoadManifestFrom(fileStore{path: path, perm: 0600})
+}
+
+// LoadManifestFrom reads the manifest from s, returning an empty one
+// if it doesn't exist yet
+func LoadManifestFrom(s Store) (*Manifest, error) {
+	m := &Manifest{store: s}
+	err := loadState(s, "manifest", func(data []byte) error {
+		m.Entries = nil
+		err := json.Unmarshal(data, m)
+		if err != nil {
+			return fmt.Errorf("failed to decode manifest: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return m, nil
+}
+
+// find the entry for the book, returning nil if not found
+//
+// Books are identified by ASIN if known, otherwise by their number,
+// marketplace and content type.
+func (m *Manifest) find(b *Book, number int) *ManifestEntry {
+	for _, e := range m.Entries {
+		if b.ASIN != "" {
+			if e.ASIN == b.ASIN {
+				return e
+			}
+		} else if e.ASIN == "" && e.Number == number && e.Marketplace == b.Marketplace && e.Content == b.Content {
+			return e
+		}
+	}
+	return nil
+}
+
+// Record the outcome for a book and save the manifest
+func (m *Manifest) Record(b Book, number int, status string, bookErr error) error {
+	return m.record(b, number, status, bookErr, "")
+}
+
+// Record the outcome for a book with the curl command to download it
+// and save the manifest
+func (m *Manifest) record(b Book, number int, status string, bookErr error, curl string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.find(&b, number)
+	if e == nil {
+		e = &ManifestEntry{}
+		m.Entries = append(m.Entries, e)
+	}
+	e.Book = b
+	e.Number = number
+	e.Status = status
+	e.Time = time.Now()
+	e.Error = ""
+	e.Curl = curl
+	e.File = ""
+	e.Format = ""
+	e.URL = ""
+	if bookErr != nil {
+		e.Error = bookErr.Error()
+	}
+	return m.save()
+}
+
+// Record the book as skipped as it already has file in the output
+// directory and save the manifest
+//
+// Books already recorded as downloaded are left alone as they may have
+// their own file recorded.
+func (m *Manifest) recordExisting(b Book, number int, file string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.find(&b, number)
+	if e != nil && e.Status == StatusDownloaded {
+		return nil
+	}
+	if e == nil {
+		e = &ManifestEntry{}
+		m.Entries = append(m.Entries, e)
+	}
+	*e = ManifestEntry{
+		Book:   b,
+		Number: number,
+		Status: StatusSkipped,
+		Time:   time.Now(),
+		File:   file,
+	}
+	return m.save()
+}
+
+// Record the URL the book was downloaded from and save the manifest
+func (m *Manifest) setURL(b *Book, number int, url string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.find(b, number)
+	if e == nil {
+		return fmt.Errorf("book %q not found in manifest to record its URL", b.ASIN)
+	}
+	e.URL = url
+	return m.save()
+}
+
+// Record items found in the account which aren't downloaded, eg
+// archived books or subscriptions, with status and save the manifest
+//
+// Entries already in the manifest with a different status are left
+// alone so books downloaded before they were archived or expired keep
+// their status. It returns the number of items added.
+func (m *Manifest) recordInventory(books []Book, status string) (added int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, b := range books {
+		if b.ASIN == "" {
+			continue
+		}
+		e := m.find(&b, 0)
+		if e == nil {
+			e = &ManifestEntry{Status: status}
+			m.Entries = append(m.Entries, e)
+			added++
+		} else if e.Status != status {
+			continue
+		}
+		e.Book = b
+		e.Time = now
+	}
+	return added, m.save()
+}
+
+// Record the file the book was downloaded to, its format and hash and
+// save the manifest
+func (m *Manifest) setFile(b *Book, number int, file, format, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.find(b, number)
+	if e == nil {
+		return fmt.Errorf("book %d not in manifest", number)
+	}
+	e.File = file
+	e.Format = format
+	e.SHA256 = hash
+	return m.save()
+}
+
+// Returns whether the book with asin is recorded as downloaded
+func (m *Manifest) downloaded(asin string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.find(&Book{ASIN: asin}, 0)
+	return e != nil && e.Status == StatusDownloaded
+}
+
+// Snapshot returns a copy of the manifest entries
+func (m *Manifest) Snapshot() []ManifestEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := make([]ManifestEntry, len(m.Entries))
+	for i, e := range m.Entries {
+		entries[i] = *e
+	}
+	return entries
+}
+
+// save the manifest atomically
+//
+// It is only readable by the user as it may contain session cookies.
+//
+// Call with the lock held
+func (m *Manifest) save() error {
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	err = m.store.Save(data)
+	if err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	return nil
+}
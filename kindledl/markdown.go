@@ -0,0 +1,119 @@
+package kindledl
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ExportOptions control what Manifest.ExportWith writes
+type ExportOptions struct {
+	DownloadedOnly bool   // set to only export the books which were downloaded
+	ByAuthor       bool   // set to write a Markdown file per author into the directory given instead of one file
+	Output         string // directory the books were downloaded to, for the links in Markdown
+}
+
+// Escape s for use in a Markdown table cell
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Write the entries as a Markdown table to buf with links to the
+// files relative to dir
+//
+// The authors column is left out if withAuthors isn't set.
+func writeMarkdownTable(buf *bytes.Buffer, entries []ManifestEntry, eo ExportOptions, dir string, withAuthors bool) {
+	if withAuthors {
+		buf.WriteString("| Title | Authors | Acquired | Read | Collections | Tags | Status |\n")
+		buf.WriteString("| --- | --- | --- | --- | --- | --- | --- |\n")
+	} else {
+		buf.WriteString("| Title | Acquired | Read | Collections | Tags | Status |\n")
+		buf.WriteString("| --- | --- | --- | --- | --- | --- |\n")
+	}
+	for i := range entries {
+		e := &entries[i]
+		title := markdownCell(e.Title)
+		if title == "" {
+			title = e.ASIN
+		}
+		if link := markdownLink(eo.Output, dir, e.File); link != "" {
+			title = "[" + strings.NewReplacer("[", "\\[", "]", "\\]").Replace(title) + "](" + link + ")"
+		}
+		cells := []string{title}
+		if withAuthors {
+			cells = append(cells, markdownCell(e.Authors))
+		}
+		cells = append(cells,
+			markdownCell(e.Acquired),
+			markdownCell(e.ReadStatus),
+			markdownCell(strings.Join(e.Collections, ", ")),
+			markdownCell(strings.Join(e.Tags, ", ")),
+			e.Status,
+		)
+		buf.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+}
+
+// Return a relative link from dir to the file name in the output
+// directory, or "" if there isn't a file
+func markdownLink(output, dir, name string) string {
+	if name == "" || output == "" {
+		return ""
+	}
+	target, err := filepath.Abs(filepath.Join(output, filepath.FromSlash(name)))
+	if err != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(dir, target)
+	if err != nil {
+		return ""
+	}
+	return (&url.URL{Path: filepath.ToSlash(rel)}).String()
+}
+
+// Write the entries as Markdown to path, or to a file per author in
+// the directory path if eo.ByAuthor is set
+func exportMarkdown(path string, entries []ManifestEntry, eo ExportOptions) error {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Number < entries[j].Number
+	})
+	if !eo.ByAuthor {
+		dir, err := filepath.Abs(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		buf.WriteString("# Kindle books\n\n")
+		writeMarkdownTable(&buf, entries, eo, dir, true)
+		return writeFileAtomic(path, buf.Bytes(), 0644)
+	}
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dir, 0777)
+	if err != nil {
+		return fmt.Errorf("failed to make export directory: %w", err)
+	}
+	byAuthor := map[string][]ManifestEntry{}
+	for _, e := range entries {
+		author := safeName(e.Authors, "Unknown Author")
+		byAuthor[author] = append(byAuthor[author], e)
+	}
+	for author, books := range byAuthor {
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "# %s\n\n", author)
+		writeMarkdownTable(&buf, books, eo, dir, false)
+		err = writeFileAtomic(filepath.Join(dir, author+".md"), buf.Bytes(), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package kindledl
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// Return rawURL with its host replaced by host
+//
+// The rest of the URL is left exactly as it is so the %s in the order
+// URL survives.
+func withHost(rawURL, host string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL %q: %w", rawURL, err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("no host in URL %q", rawURL)
+	}
+	return strings.Replace(rawURL, "//"+u.Host, "//"+host, 1), nil
+}
+
+// Return the checkpoint file to use for the marketplace at host
+//
+// This is the checkpoint file with the host inserted before the
+// extension, eg kindledl-checkpoint-www.amazon.com.txt
+func marketplaceCheckpoint(checkpoint, host string) string {
+	return WithSuffix(checkpoint, sanitizeHost(host))
+}
+
+// Make host safe to use in a file name
+func sanitizeHost(host string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, host)
+}
+
+// Returns the URLs of the books page of each marketplace
+func (c *Client) marketplaceURLs() ([]string, error) {
+	if len(c.opt.Marketplaces) == 0 {
+		return []string{c.opt.BooksURL}, nil
+	}
+	urls := make([]string, 0, len(c.opt.Marketplaces))
+	for _, host := range c.opt.Marketplaces {
+		u, err := withHost(c.opt.BooksURL, host)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	return urls, nil
+}
+
+// Returns whether there is another marketplace to do after this one
+func (c *Client) moreMarketplaces() bool {
+	return c.marketplaceIndex+1 < len(c.opt.Marketplaces)
+}
+
+// Use marketplace i for the URLs and checkpoint
+//
+// These are made from the options with the host replaced, and the
+// content list, order and checkpoint name changed for the content type
+// and order if set.
+func (c *Client) useMarketplace(i int) (err error) {
+	c.marketplaceIndex = i
+	c.marketplace = ""
+	c.booksURL = c.opt.BooksURL
+	c.orderURL = c.opt.OrderURL
+	c.checkpoint = c.opt.Checkpoint
+	if len(c.opt.Marketplaces) > 0 {
+		c.marketplace = c.opt.Marketplaces[i]
+		c.booksURL, err = withHost(c.opt.BooksURL, c.marketplace)
+		if err != nil {
+			return err
+		}
+		c.orderURL, err = withHost(c.opt.OrderURL, c.marketplace)
+		if err != nil {
+			return err
+		}
+		c.checkpoint = marketplaceCheckpoint(c.opt.Checkpoint, c.marketplace)
+	}
+	if c.content != "" {
+		c.booksURL, err = withContentList(c.booksURL, contentTypes[c.content].list)
+		if err != nil {
+			return err
+		}
+		c.checkpoint = WithSuffix(c.checkpoint, c.content)
+	}
+	// The positions of the books differ in each order
+	if c.opt.Order != "" {
+		c.booksURL, err = withOrder(c.booksURL, c.opt.Order)
+		if err != nil {
+			return err
+		}
+		if c.opt.Order != OrderDateAsc {
+			c.checkpoint = WithSuffix(c.checkpoint, c.opt.Order)
+		}
+	}
+	c.checkpointStore, err = c.opt.openStore(c.checkpoint, 0644)
+	return err
+}
+
+// Returns the number of marketplaces to do
+func (c *Client) numMarketplaces() int {
+	return max(len(c.opt.Marketplaces), 1)
+}
+
+// Check the last book done is where the checkpoint says it is, and if
+// the library has changed since, eg books were bought or returned,
+// find it so the run carries on with the book after it.
+//
+// Failures are logged and the position in the checkpoint used.
+func (c *Client) locateLastASIN(ctx context.Context) {
+	if c.lastASIN == "" || c.book < 2 {
+		return
+	}
+	err := c.openLibrary(ctx)
+	if err == nil {
+		var books []Book
+		books, err = c.fetchItems(ctx, c.contentFilter(), c.book-2, 1)
+		if err == nil && len(books) == 1 && strings.EqualFold(books[0].ASIN, c.lastASIN) {
+			return
+		}
+	}
+	book, err := c.findASIN(ctx, c.lastASIN)
+	if err != nil {
+		slog.Warn("Couldn't find the last book done - carrying on from the checkpoint", "asin", c.lastASIN, "book", c.book, "err", err)
+		return
+	}
+	slog.Warn("Library has changed - moving to the book after the last one done", "asin", c.lastASIN, "old", c.book, "new", book+1)
+	c.book = book + 1
+}
+
+// Set up to download the books from marketplace i, working out which
+// book to start from.
+//
+// -book and -start-asin only apply to the first marketplace of the
+// first content type.
+func (c *Client) startMarketplace(i int) (err error) {
+	err = c.useMarketplace(i)
+	if err != nil {
+		return err
+	}
+	if c.marketplace != "" {
+		slog.Info("Starting marketplace", "marketplace", c.marketplace, "url", c.booksURL)
+	}
+	err = c.selectProfile(context.Background())
+	if err != nil {
+		return err
+	}
+	err = c.useCollections(context.Background())
+	if err != nil {
+		return err
+	}
+	c.totalBooks = -1
+	c.pageBooks = nil
+	c.lastASIN = ""
+	first := i == 0 && c.contentIndex == 0
+	if first && c.opt.Book > 0 {
+		c.book = c.opt.Book
+	} else if first && c.opt.StartASIN != "" {
+		c.book, err = c.findASIN(context.Background(), c.opt.StartASIN)
+		if err != nil {
+			return err
+		}
+	} else if c.stateDB != nil {
+		// Books already done are skipped using the state database
+		c.book = max(c.opt.FirstBook, 1)
+	} else {
+		err = c.loadCheckpoint()
+		if err != nil {
+			return err
+		}
+		c.locateLastASIN(context.Background())
+	}
+	c.seekBook(c.book)
+	return nil
+}
@@ -0,0 +1,136 @@
+package kindledl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// ErrOffline is returned when Amazon can't be reached, eg because the
+// network is down, as opposed to the browser not being logged in.
+var ErrOffline = errors.New("can't reach Amazon - check the network connection")
+
+// Chrome network errors which don't mean the network is down
+var notNetworkErrors = []string{
+	"net::ERR_ABORTED",
+	"net::ERR_BLOCKED_BY_CLIENT",
+	"net::ERR_BLOCKED_BY_RESPONSE",
+}
+
+// Messages from fetch in the page when the request didn't get a
+// response
+var fetchNetworkErrors = []string{
+	"Failed to fetch",
+	"NetworkError",
+	"ERR_INTERNET_DISCONNECTED",
+}
+
+// Prefix of the URL Chrome shows its own error pages on, eg "No
+// internet"
+const chromeErrorURL = "chrome-error://"
+
+// Returns whether err from the browser means Amazon couldn't be
+// reached, eg DNS, TCP or TLS failures
+func isNetworkError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var navErr *rod.NavigationError
+	if errors.As(err, &navErr) {
+		for _, notNet := range notNetworkErrors {
+			if strings.Contains(navErr.Reason, notNet) {
+				return false
+			}
+		}
+		return strings.Contains(navErr.Reason, "net::ERR_")
+	}
+	msg := err.Error()
+	for _, netErr := range fetchNetworkErrors {
+		if strings.Contains(msg, netErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// If err is a network failure wrap it in ErrOffline, otherwise return
+// it as it is
+func classifyNetworkError(err error) error {
+	if isNetworkError(err) {
+		return fmt.Errorf("%w: %v", ErrOffline, err)
+	}
+	return err
+}
+
+// How often to check whether the network has come back
+const offlineProbeInterval = 30 * time.Second
+
+// How long to wait for Amazon to answer a probe
+const offlineProbeTimeout = 10 * time.Second
+
+// Check Amazon can be reached, returning an error if not
+//
+// Any HTTP response counts as the network being up.
+func (c *Client) probeNetwork() error {
+	u, err := url.Parse(c.booksURL)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), offlineProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.Scheme+"://"+u.Host+"/", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// If err isn't a network failure already but Amazon can't be reached
+// then wrap it in ErrOffline, as the network probably went down while
+// working on the page.
+func (c *Client) checkOffline(err error) error {
+	if errors.Is(err, ErrOffline) {
+		return err
+	}
+	probeErr := c.probeNetwork()
+	if probeErr == nil {
+		return err
+	}
+	slog.Debug("Network probe failed", "err", probeErr)
+	return fmt.Errorf("%w: %v", ErrOffline, err)
+}
+
+// Wait for the network to come back after err showed it was down,
+// checking every offlineProbeInterval.
+//
+// This returns err if it doesn't come back within
+// Options.TimeOfflineWait.
+func (c *Client) waitOnline(err error) error {
+	if c.opt.TimeOfflineWait <= 0 {
+		return err
+	}
+	start := time.Now()
+	slog.Warn("Can't reach Amazon - waiting for the network to come back", "err", err, "max", c.opt.TimeOfflineWait)
+	for time.Since(start) < c.opt.TimeOfflineWait {
+		time.Sleep(offlineProbeInterval)
+		probeErr := c.probeNetwork()
+		if probeErr == nil {
+			slog.Info("Network is back - carrying on", "offline", time.Since(start).Round(time.Second))
+			return nil
+		}
+		slog.Debug("Still offline", "err", probeErr)
+	}
+	return fmt.Errorf("gave up waiting for the network after %v: %w", c.opt.TimeOfflineWait, err)
+}
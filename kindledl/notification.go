@@ -0,0 +1,97 @@
+package kindledl
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+)
+
+// Ids of the notifications shown after the download button is clicked
+const (
+	notificationSuccess = "notification-success"
+	notificationError   = "notification-error"
+	notificationFailure = "notification-failure"
+	notificationClose   = "notification-close"
+)
+
+// errDownloadRefused is returned when Amazon shows a failure
+// notification for a book, eg because the device limit was reached
+var errDownloadRefused = errors.New("amazon couldn't download the book")
+
+// Wait for the notification after the download button is clicked and
+// close it
+//
+// The notification is found by the id of its container. If Amazon
+// has changed the ids it is found by its text with -msg-success
+// instead. A failure notification returns errDownloadRefused with its
+// message.
+func (c *Client) waitNotification(subLog *slog.Logger) error {
+	selector := "#" + notificationSuccess + ", #" + notificationError + ", #" + notificationFailure
+	for i := 0; i < 5; i++ {
+		subLog.Debug("Looking for notification", "try", i)
+		found, err := c.page.Elements(selector)
+		if err != nil {
+			return fmt.Errorf("error looking for notification: %w", err)
+		}
+		if len(found) > 0 {
+			return c.closeNotification(subLog, found[0])
+		}
+		c.pacer.retry()
+		time.Sleep(c.opt.TimeRetrySleep)
+	}
+
+	// Fall back to looking for the text
+	_, err := c.findOneElementWithText(subLog, "span", c.reSuccess)
+	if err != nil {
+		return fmt.Errorf("couldn't find success popup (-msg-success=%q): %w", c.opt.MsgSuccess, err)
+	}
+	closeBoxes, err := c.page.Elements("#" + notificationClose)
+	if err != nil || len(closeBoxes) == 0 {
+		subLog.Debug("Couldn't find close box of success popup", "err", err)
+		return nil
+	}
+	err = c.click(closeBoxes[0])
+	if err != nil {
+		return fmt.Errorf("error clicking on success popup: %w", err)
+	}
+	return nil
+}
+
+// Close the notification and return an error if it was a failure
+func (c *Client) closeNotification(subLog *slog.Logger, notification *rod.Element) error {
+	id, err := notification.Attribute("id")
+	if err != nil {
+		return fmt.Errorf("failed to read notification id: %w", err)
+	}
+	var message string
+	if id != nil && *id != notificationSuccess {
+		message, err = notification.Text()
+		if err != nil {
+			return fmt.Errorf("failed to read failure notification: %w", err)
+		}
+		message = strings.Join(strings.Fields(message), " ")
+	}
+
+	// Click in the close box to make it go away
+	closeBoxes, err := notification.Elements("#" + notificationClose)
+	if err != nil {
+		return fmt.Errorf("notification close box: %w", err)
+	}
+	if len(closeBoxes) > 0 {
+		err = c.click(closeBoxes[0])
+		if err != nil {
+			return fmt.Errorf("error clicking on notification: %w", err)
+		}
+	} else {
+		subLog.Debug("Couldn't find close box of notification")
+	}
+
+	if message != "" {
+		return fmt.Errorf("%w: %s", errDownloadRefused, message)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package kindledl
+
+import (
+	"io"
+	"time"
+)
+
+// Options configure the Client
+//
+// Use DefaultOptions to get a set with sensible defaults then change
+// the ones you need.
+type Options struct {
+	Debug        bool   // set to trace the browser actions
+	Show         bool   // set to show the browser (not headless)
+	Container    bool   // set when running in a container to use browser flags which work there
+	LowMemory    bool   // set to make the browser use as little memory as possible
+	RecycleBooks int    // restart the browser after this many books, 0 for never
+	ConfigDir    string // directory for the browser profile, "" for the user config dir
+	Output       string // directory to store the downloaded books
+	FormatDirs   bool   // set to move the books into a subdirectory of Output for each format, eg azw3, kfx
+	Dedupe       bool   // set to remove extra copies of books in Output at the end of the run, keeping the newest
+	Checkpoint   string // file noting where the download has got to
+	Manifest     string // file recording the details and outcome of each book processed
+	Audit        bool   // set to check the library against the manifest and the files at the end of the run
+	Archived     bool   // set to record archived books and expired loans in the manifest at the end of the run
+	Periodicals  bool   // set to record the active newspaper and magazine subscriptions in the manifest at the end of the run
+	Gallery      string // if set, write an HTML index of the books here at the end of each run
+	Views        string // if set, make trees of symlinks to the books by author and series here at the end of each run
+	Feed         string // if set, write an Atom feed of the newly downloaded books here at the end of each run
+	Samples      string // if set, write a CSV of the samples here at the end of each run
+	StatusFile   string // if set, keep the status of the run up to date in this JSON file
+	KindleName   string // name of the kindle to download for
+	BooksURL     string // URL to show purchased kindle books in date order, oldest first
+	BooksPerPage int    // books shown on each page
+	Order        string // order to list the books in, one of Orders, "" for the order in BooksURL
+
+	// If there is more than one, download each book for each of these
+	// kindles, into a subdirectory of Output named after each,
+	// instead of for KindleName
+	Kindles []string
+
+	// Hosts of the Amazon marketplaces to download from in turn, eg
+	// www.amazon.co.uk and www.amazon.com. BooksURL and OrderURL are
+	// used with their host replaced and each marketplace has its own
+	// checkpoint. If empty, just BooksURL is used.
+	Marketplaces []string
+
+	// Kinds of content to download in turn, eg books and docs, see
+	// ContentTypeNames. Each is read from BooksURL with the content
+	// list replaced, downloaded into its own subdirectory of Output
+	// and has its own checkpoint. If empty, just BooksURL is used.
+	ContentTypes []string
+
+	// Subdirectory of Output for each content type, the name of the
+	// content type if not set
+	ContentDirs map[string]string
+
+	// Size of the browser window in CSS pixels, 0 for the default
+	WindowWidth  int
+	WindowHeight int
+	DeviceScale  float64 // device scale factor, 0 for the default
+
+	// Make the browser look like the user's normal browser
+	UserAgent      string // user agent, "" for the browser's
+	AcceptLanguage string // languages the browser accepts, eg "en-GB,en;q=0.9", "" for the browser's
+	Timezone       string // IANA timezone, eg "Europe/London", "" for the system's
+	Stealth        bool   // set to hide the signs that the browser is automated
+
+	// Which books to download
+	Book        int      // book to start downloading from, 0 to use the checkpoint
+	StartASIN   string   // ASIN of the book to start downloading from
+	FirstBook   int      // first book of the range to download, 0 for no range
+	LastBook    int      // last book of the range to download, 0 for no range
+	MaxBooks    int      // stop the run after downloading this many books, 0 for no limit
+	Search      string   // only download books found by searching for this
+	Collections []string // only download books in these collections
+	Author      string   // only download books whose authors match this regexp, ignoring case
+	Title       string   // only download books whose titles match this regexp, ignoring case
+	SkipRentals bool     // set to skip rented books, eg eTextbooks
+	SkipSamples bool     // set to skip samples without opening their menus
+	SkipFree    bool     // set to skip books which cost nothing, read from their orders
+	SkipOnDisk  bool     // set to skip books which already have a file in Output, matched by ASIN or title
+	Profile     string   // name of the profile whose library to download, eg a child's Amazon Kids profile, "" for the account holder's
+
+	// The user's own tags for each book keyed by upper case ASIN,
+	// see ReadTags
+	Tags map[string][]string
+
+	// Only download books acquired on or after Since and on or before
+	// Until, ignoring the time of day. Zero for no limit.
+	Since time.Time
+	Until time.Time
+
+	// If set, only download the books with these upper case ASINs,
+	// see ReadASINs
+	ASINs map[string]bool
+
+	// Order history
+	EnrichOrders bool   // set to read the purchase price and date of each book from its order
+	OrderURL     string // URL to show a digital order, %s is replaced with the order ID
+
+	// Text to look for on the pages, as case insensitive regexps -
+	// these are set from DefaultLocale, see Locale
+	MsgMoreActions    string // to find the more actions button
+	MsgDownloadViaUSB string // in the more actions menu
+	MsgClearFurthest  string // in the more actions menu to check it is OK
+	MsgDownloadButton string // to find the download button
+	MsgSuccess        string // in the title of the success popup
+	MsgShowing        string // which books the page is showing
+	MsgOrderTotal     string // on the order page to find the price paid
+	MsgOrderDate      string // on the order page to find the order date
+	MsgProfileMenu    string // to find the menu to switch profiles
+
+	// JavaScript to find elements on the page instead of the text
+	// above - see selectors.go for details
+	SelectorScript string
+
+	// CSS selectors or XPaths to find elements on the page instead of
+	// the text above, keyed by the names of the selector script
+	// functions. These take precedence over SelectorScript.
+	Selectors map[string]string
+
+	// Timings
+	TimeActionInterval time.Duration // time to wait before each click or navigation
+	TimeRetrySleep     time.Duration // time to wait between retries of finding something on the page
+	TimeScrollPause    time.Duration // time to wait after scrolling the page
+	TimeJitter         time.Duration // maximum random extra time to wait between books
+	StatusInterval     time.Duration // how often to log the progress, 0 to disable
+	Adaptive           bool          // set to adjust the action interval according to how well things are going
+	Benchmark          bool          // set to stop after one page of books so the step timings can be reported
+	TimeOfflineWait    time.Duration // how long to wait for the network to come back if it goes down, 0 to fail straight away
+	TimeDownloadStall  time.Duration // how long a download can go without progress before it fails
+
+	// Where to upload the books to as they complete
+	Uploaders []Uploader
+
+	// If set, download the books with this instead of the browser
+	Downloader Downloader
+
+	// If set, record a curl command to download each book in the
+	// manifest
+	RecordCurl bool
+
+	// Opens the Checkpoint and Manifest if they are URLs rather than
+	// files, eg for SQLite, HTTP or S3 storage
+	StoreOpener StoreOpener
+
+	// If set, record the status of every book in this database, eg a
+	// SQLite file, opened with StateDBOpener. Runs then carry on with
+	// the books not done yet instead of using the Checkpoint.
+	StateDB       string
+	StateDBOpener StateDBOpener
+
+	// Set to wait for the browser to say each download has completed
+	// before going on to the next book, failing the book if the
+	// download is cancelled or stalls for TimeDownloadStall
+	VerifyDownloads bool
+
+	// If set, lay the books out in Output the way a self-hosted
+	// reader expects, PresetKavita or PresetKomga, or in a directory
+	// for each author with PresetAuthor
+	OrganizePreset string
+
+	// If set, rename each book once it has downloaded using this
+	// template, eg "{author} - {title} ({asin}).{ext}". Directories
+	// can be used too, eg "{author}/{title}.{ext}".
+	FilenameTemplate string
+
+	// If set, the browser downloads into this directory and each
+	// book is moved into Output once it is complete and has been
+	// checked, so Output never has partial files in it.
+	Staging string
+
+	// How to move the books from Staging to Output: MoveAuto (the
+	// default) renames them unless Output is on a different
+	// filesystem, eg a NAS, when they are copied, synced and renamed
+	// into place. MoveRename and MoveCopy force one or the other.
+	StagingMove string
+
+	// Set to copy each book from Staging to Output rather than
+	// moving it, reading the copy back to check its hash and
+	// copying it again if it doesn't match, eg for network storage
+	VerifyCopy bool
+
+	// If set, write each book downloaded as a tar archive to this as
+	// it completes, followed by its manifest entry as JSON. The tar
+	// is finished when the Client is closed.
+	Tar io.Writer
+
+	// Set to remove each book from Output once it is in the tar
+	TarRemove bool
+
+	// If set, write a sidecar file next to each book rendered from
+	// this Go template file - see sidecar.go for details
+	SidecarTemplate string
+
+	// Set to write a JSON sidecar of the book's details next to each
+	// book, named after the book with .json added
+	JSONSidecar bool
+
+	// Called at each event, as if added with Client.AddHook
+	Hooks []Hook
+
+	// If set, run the EventPostBook hooks, eg uploads, in this many
+	// background workers so they don't hold up the browser. Failed
+	// hooks are tried again and logged rather than stopping the run.
+	PostWorkers int
+}
+
+// DefaultOptions returns the default options
+func DefaultOptions() *Options {
+	opt := &Options{
+		Output:             "Books",
+		Checkpoint:         Program + "-checkpoint.txt",
+		Manifest:           Program + "-manifest.json",
+		BooksURL:           "https://www.amazon.co.uk/hz/mycd/digital-console/contentlist/booksPurchases/dateAsc/",
+		BooksPerPage:       25,
+		SkipSamples:        true,
+		OrderURL:           "https://www.amazon.co.uk/gp/digital/your-account/order-summary.html?orderID=%s",
+		TimeActionInterval: time.Second,
+		TimeRetrySleep:     time.Second,
+		TimeScrollPause:    500 * time.Millisecond,
+		StatusInterval:     5 * time.Minute,
+		TimeOfflineWait:    12 * time.Hour,
+		TimeDownloadStall:  2 * time.Minute,
+	}
+	mustLocale(DefaultLocale).Apply(opt)
+	return opt
+}
@@ -0,0 +1,91 @@
+package kindledl
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Orders the content list can be sorted in, for Options.Order
+const (
+	OrderDateAsc  = "dateAsc"  // oldest first
+	OrderDateDsc  = "dateDsc"  // newest first
+	OrderTitleAsc = "titleAsc" // by title A-Z
+	OrderTitleDsc = "titleDsc" // by title Z-A
+)
+
+// Orders lists the orders which can be used in Options.Order
+var Orders = []string{OrderDateAsc, OrderDateDsc, OrderTitleAsc, OrderTitleDsc}
+
+// Matches the order in a books URL, eg /booksPurchases/dateAsc
+var reURLOrder = regexp.MustCompile(`/contentlist/[^/?#]+/(date|title)(Asc|Dsc)(?:[/?#]|$)`)
+
+// Check the order in the options is known
+func (opt *Options) checkOrder() error {
+	if opt.Order == "" {
+		return nil
+	}
+	for _, order := range Orders {
+		if opt.Order == order {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown order %q - use one of %s", opt.Order, strings.Join(Orders, ", "))
+}
+
+// Return rawURL with its order replaced by order
+//
+// The order is the part of the path after the content list, eg
+// dateAsc in .../contentlist/booksPurchases/dateAsc/
+func withOrder(rawURL, order string) (string, error) {
+	loc := reURLOrder.FindStringSubmatchIndex(rawURL)
+	if loc == nil {
+		return "", fmt.Errorf("no order like %q in URL %q", OrderDateAsc, rawURL)
+	}
+	// From the start of date/title to the end of Asc/Dsc
+	return rawURL[:loc[2]] + order + rawURL[loc[5]:], nil
+}
+
+// Returns the sort index and order for the content list AJAX call to
+// match the order of the books page
+func (c *Client) sortCriteria() (index, order string) {
+	index, order = "DATE", "ASCENDING"
+	match := reURLOrder.FindStringSubmatch(c.booksURL)
+	if match == nil {
+		return index, order
+	}
+	index = strings.ToUpper(match[1])
+	if match[2] == "Dsc" {
+		order = "DESCENDING"
+	}
+	return index, order
+}
+
+// Returns whether the books are listed by date, oldest first
+func (c *Client) oldestFirst() bool {
+	index, order := c.sortCriteria()
+	return c.opt.Search == "" && index == "DATE" && order == "ASCENDING"
+}
+
+// Returns whether the books are listed by date, newest first, so books
+// bought are added at the start of the list rather than the end
+func (c *Client) newestFirst() bool {
+	index, order := c.sortCriteria()
+	return c.opt.Search == "" && index == "DATE" && order == "DESCENDING"
+}
+
+// Set the checkpoint back to the first book once the library has been
+// done newest first, so the next run starts with the books bought
+// since and stops when it reaches the books done already.
+func (c *Client) restartCheckpoint() error {
+	if c.stateDB != nil {
+		return nil
+	}
+	err := c.checkpointStore.Save([]byte("1"))
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint %q: %w", c.checkpoint, err)
+	}
+	slog.Debug("Set checkpoint back to the newest book", "checkpoint", c.checkpoint)
+	return nil
+}
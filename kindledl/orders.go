@@ -0,0 +1,116 @@
+package kindledl
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// orderDetails is what we find out from the order history
+type orderDetails struct {
+	price string
+	date  string
+}
+
+// Find the purchase price and date of the book from its order and add
+// them to the book.
+//
+// Failures are logged but not returned as they shouldn't stop the
+// download.
+func (c *Client) enrichBook(subLog *slog.Logger, b *Book) {
+	if !(c.opt.EnrichOrders || c.opt.SkipFree) || b.OrderID == "" {
+		return
+	}
+	details, ok := c.orders[b.OrderID]
+	if !ok {
+		var err error
+		details, err = c.fetchOrder(b.OrderID)
+		if err != nil {
+			subLog.Warn("Couldn't fetch order details", "order_id", b.OrderID, "err", err)
+			return
+		}
+		c.orders[b.OrderID] = details
+	}
+	b.Price = details.price
+	b.OrderDate = details.date
+}
+
+// Read the order details page for orderID in a separate browser page
+func (c *Client) fetchOrder(orderID string) (details orderDetails, err error) {
+	page, err := c.browser.Page(proto.TargetCreateTarget{})
+	if err != nil {
+		return details, fmt.Errorf("failed to open order page: %w", err)
+	}
+	defer func() {
+		closeErr := page.Close()
+		if closeErr != nil {
+			slog.Debug("Failed to close order page", "err", closeErr)
+		}
+	}()
+	err = c.setupPage(page)
+	if err != nil {
+		return details, err
+	}
+	url := fmt.Sprintf(c.orderURL, orderID)
+	err = page.Navigate(url)
+	if err != nil {
+		return details, fmt.Errorf("couldn't open order URL %q: %w", url, err)
+	}
+	err = page.WaitLoad()
+	if err != nil {
+		return details, fmt.Errorf("order page load: %w", err)
+	}
+	details.price, err = findSubmatch(page, c.reOrderTotal)
+	if err != nil {
+		return details, fmt.Errorf("couldn't find order total (-msg-order-total=%q): %w", c.opt.MsgOrderTotal, err)
+	}
+	details.date, err = findSubmatch(page, c.reOrderDate)
+	if err != nil {
+		return details, fmt.Errorf("couldn't find order date (-msg-order-date=%q): %w", c.opt.MsgOrderDate, err)
+	}
+	slog.Debug("Read order", "order_id", orderID, "price", details.price, "date", details.date)
+	return details, nil
+}
+
+// Find the first element on the page matching re and return the first
+// submatch of its text
+func findSubmatch(page *rod.Page, re *regexp.Regexp) (string, error) {
+	elements, err := page.Elements("span, div, td")
+	if err != nil {
+		return "", err
+	}
+	for _, el := range elements {
+		elText, err := el.Text()
+		if err != nil {
+			return "", err
+		}
+		match := re.FindStringSubmatch(elText)
+		if len(match) >= 2 {
+			return strings.TrimSpace(match[1]), nil
+		}
+	}
+	return "", errNoneFound
+}
+
+// Free returns whether the price paid for the book was nothing, eg a
+// promotional freebie. The price is only known with
+// Options.EnrichOrders or Options.SkipFree.
+func (b *Book) Free() bool {
+	if strings.EqualFold(strings.TrimSpace(b.Price), "free") {
+		return true
+	}
+	zero := false
+	for _, r := range b.Price {
+		if r >= '1' && r <= '9' {
+			return false
+		}
+		if r == '0' {
+			zero = true
+		}
+	}
+	return zero
+}
@@ -0,0 +1,105 @@
+package kindledl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Layouts for the output directory, for Options.OrganizePreset
+const (
+	PresetKavita = "kavita" // a directory per series or book as Kavita expects
+	PresetKomga  = "komga"  // a directory per series or book with series.json as Komga expects
+	PresetAuthor = "author" // a directory per author
+)
+
+// Check the organize preset in the options is known and doesn't
+// clash with other options
+func (opt *Options) checkOrganizePreset() error {
+	switch opt.OrganizePreset {
+	case "":
+		return nil
+	case PresetKavita, PresetKomga, PresetAuthor:
+	default:
+		return fmt.Errorf("unknown organize preset %q - use %s, %s or %s", opt.OrganizePreset, PresetKavita, PresetKomga, PresetAuthor)
+	}
+	if opt.FormatDirs {
+		return fmt.Errorf("can't sort the books into format directories with the %s layout", opt.OrganizePreset)
+	}
+	return nil
+}
+
+// Return the title of the book without the series on the end
+func bareTitle(title string) string {
+	if loc := reSeries.FindStringIndex(title); loc != nil {
+		title = title[:loc[0]]
+	}
+	return strings.TrimSpace(title)
+}
+
+// Return the file name the book in e should have in the
+// layout of Options.OrganizePreset, / separated and relative to the
+// output directory
+//
+// Books in a series go in a directory named after the series as
+// "Series Vol. 01 - Title.ext" which both Kavita and Komga parse.
+// Other books go in a directory of their own named after the title.
+//
+// With PresetAuthor the books go in a directory named after the
+// author as "Title.ext" instead.
+func (c *Client) organizedName(e *ManifestEntry, name string) string {
+	ext := path.Ext(name)
+	if c.opt.OrganizePreset == PresetAuthor {
+		author := safeName(e.Authors, "Unknown Author")
+		title := safeName(e.Title, strings.TrimSuffix(path.Base(name), ext))
+		return path.Join(contentDir(c.opt, e.Content), author, title+ext)
+	}
+	title := safeName(bareTitle(e.Title), strings.TrimSuffix(path.Base(name), ext))
+	dir := title
+	file := title + ext
+	series, number := seriesFromTitle(e.Title)
+	if series != "" {
+		dir = safeName(series, title)
+		file = fmt.Sprintf("%s Vol. %s - %s%s", dir, number, title, ext)
+	}
+	return path.Join(contentDir(c.opt, e.Content), dir, file)
+}
+
+// komgaSeries is the series.json Komga reads the series metadata from
+type komgaSeries struct {
+	Version  string `json:"version"`
+	Metadata struct {
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Publisher string `json:"publisher"`
+		Status    string `json:"status"`
+	} `json:"metadata"`
+}
+
+// Write series.json for Komga in the directory of the book in e if
+// there isn't one already
+func (c *Client) writeKomgaSeries(e *ManifestEntry) error {
+	dir := filepath.Dir(filepath.Join(c.downloadDir, filepath.FromSlash(e.File)))
+	seriesPath := filepath.Join(dir, "series.json")
+	if _, err := os.Stat(seriesPath); err == nil {
+		return nil
+	}
+	var s komgaSeries
+	s.Version = "1.0.2"
+	s.Metadata.Type = "comicSeries"
+	s.Metadata.Name = filepath.Base(dir)
+	s.Metadata.Publisher = e.Authors
+	s.Metadata.Status = "Continuing"
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(seriesPath, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write series.json: %w", err)
+	}
+	return nil
+}
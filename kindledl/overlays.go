@@ -0,0 +1,97 @@
+package kindledl
+
+import (
+	"log/slog"
+	"time"
+)
+
+// An overlay Amazon puts over the page which gets in the way of
+// finding and clicking things
+type overlay struct {
+	Name     string `json:"name"`     // what the overlay is for the logs
+	Selector string `json:"selector"` // CSS selector for the overlay
+	Text     string `json:"text"`     // JavaScript regexp its text must match, case insensitive, "" for any
+}
+
+// The overlays which are dismissed when found
+//
+// The device dialog kindledl opens itself is a dialog too so dialogs
+// are only dismissed if their text matches.
+var overlays = []overlay{
+	{
+		Name:     "kindle unlimited promotion",
+		Selector: `[role=dialog], [aria-modal=true], .a-modal-scroller, .a-popover[aria-hidden=false]`,
+		Text:     `Kindle Unlimited|Prime Reading|free trial|try (?:it )?(?:for )?free`,
+	},
+	{
+		Name:     "app install banner",
+		Selector: `[role=dialog], [aria-modal=true], .a-modal-scroller, [id*=app-banner i], [class*=app-banner i], [id*=appbanner i], [class*=appbanner i]`,
+		Text:     `(?:get|download|install|open) (?:the )?(?:free )?Kindle app|in the app`,
+	},
+	{
+		Name:     "interstitial",
+		Selector: `[id*=interstitial i], [class*=interstitial i]`,
+	},
+	{
+		Name:     "feedback survey",
+		Selector: `[role=dialog], [aria-modal=true], .a-modal-scroller, .a-popover[aria-hidden=false], [id*=survey i], [class*=survey i], [id*=feedback i], [class*=feedback i]`,
+		Text:     `tell us what you think|(?:give|share|send) (?:us )?(?:your )?feedback|how (?:are|did) we do|how likely are you|take (?:a|our) (?:short |quick )?survey`,
+	},
+	{
+		Name:     "survey invitation",
+		Selector: `[id^=QSIWebResponsive], .QSIPopOver, .QSIWebResponsive, #fsrInvite, .__fsr, [id^=acsMainInvite]`,
+	},
+}
+
+// JavaScript to dismiss the overlays passed in which are showing
+//
+// Each is closed with its close button if it has one, otherwise it is
+// removed from the page. It returns the names of the overlays
+// dismissed.
+const overlaysJS = `(overlays) => {
+	const visible = el => !!(el.offsetWidth || el.offsetHeight || el.getClientRects().length) && getComputedStyle(el).visibility !== "hidden";
+	const closeText = /^\s*(?:close|dismiss|no,? thanks|not now|maybe later|skip|×|✕|x)\s*$/i;
+	const closeLabel = /close|dismiss/i;
+	const dismissed = [];
+	for (const o of overlays) {
+		const re = o.text ? new RegExp(o.text, "i") : null;
+		for (const el of document.querySelectorAll(o.selector)) {
+			if (!el.isConnected || !visible(el) || (re && !re.test(el.innerText || ""))) continue;
+			const close = Array.from(el.querySelectorAll("button, a, [role=button], [aria-label], input[type=button], input[type=submit]")).find(b =>
+				closeLabel.test(b.getAttribute("aria-label") || "") || closeText.test(b.innerText || b.value || ""));
+			if (close) {
+				close.click();
+			} else {
+				el.remove();
+			}
+			dismissed.push(o.name);
+		}
+	}
+	return dismissed;
+}`
+
+// Dismiss any overlays on the page, returning whether any were found
+//
+// Failures are logged as the overlays are only a nuisance.
+func (c *Client) dismissOverlays(subLog *slog.Logger) bool {
+	res, err := c.page.Eval(overlaysJS, overlays)
+	if err != nil {
+		subLog.Debug("Failed to look for overlays", "err", err)
+		return false
+	}
+	var dismissed []string
+	err = res.Value.Unmarshal(&dismissed)
+	if err != nil {
+		subLog.Debug("Failed to decode overlays dismissed", "err", err)
+		return false
+	}
+	for _, name := range dismissed {
+		subLog.Info("Dismissed overlay", "overlay", name)
+	}
+	if len(dismissed) == 0 {
+		return false
+	}
+	// Let the page settle after the overlay goes
+	time.Sleep(c.opt.TimeScrollPause)
+	return true
+}
@@ -0,0 +1,74 @@
+package kindledl
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Limits of the adaptive pacing as multiples of the action interval
+const (
+	pacerMinFactor   = 0.25
+	pacerMaxFactor   = 8
+	pacerSpeedUp     = 0.9 // multiply the delay by this on success
+	pacerSlowDown    = 2   // multiply the delay by this on failure
+	pacerMinInterval = 10 * time.Millisecond
+)
+
+// pacer controls the delay before clicks and navigation
+//
+// We do this rather than using rod's SlowMotion as that slows down
+// every element query too, which is where most of the time goes on
+// large pages.
+//
+// If adaptive it speeds up while everything works first time and
+// backs off when books fail.
+type pacer struct {
+	adaptive bool
+	delay    time.Duration
+	minDelay time.Duration
+	maxDelay time.Duration
+	failures int // number of times failure was called
+	retries  int // number of times retry was called
+}
+
+// newPacer makes a pacer starting at interval, adjusting it if adaptive is set
+func newPacer(interval time.Duration, adaptive bool) pacer {
+	return pacer{
+		adaptive: adaptive,
+		delay:    interval,
+		minDelay: max(time.Duration(float64(interval)*pacerMinFactor), pacerMinInterval),
+		maxDelay: max(time.Duration(float64(interval)*pacerMaxFactor), pacerMinInterval),
+	}
+}
+
+// Pause before a browser action
+func (p *pacer) pause() {
+	time.Sleep(p.delay)
+}
+
+// Note that a book downloaded without problems
+func (p *pacer) success() {
+	if !p.adaptive {
+		return
+	}
+	p.delay = max(time.Duration(float64(p.delay)*pacerSpeedUp), p.minDelay)
+	slog.Debug("Pacing faster", "delay", p.delay)
+}
+
+// Note that something had to be looked for on the page again
+//
+// This doesn't slow the pacing down as some lookups are expected to
+// find nothing, eg the download menu item of samples.
+func (p *pacer) retry() {
+	p.retries++
+}
+
+// Note that a book or action failed
+func (p *pacer) failure() {
+	p.failures++
+	if !p.adaptive {
+		return
+	}
+	p.delay = min(p.delay*pacerSlowDown, p.maxDelay)
+	slog.Debug("Pacing slower", "delay", p.delay)
+}
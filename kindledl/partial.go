@@ -0,0 +1,221 @@
+package kindledl
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// errStalled is recorded for books whose download stopped part way
+var errStalled = errors.New("download stalled before it finished")
+
+// When a file still being downloaded was last seen to grow
+type partialSeen struct {
+	size    int64
+	changed time.Time
+}
+
+// partialWatch follows the files still being downloaded into a
+// directory so waiting for them can give up on each one separately
+// when it stops growing
+type partialWatch struct {
+	stall time.Duration
+	seen  map[string]partialSeen
+}
+
+// Make a partialWatch which gives up on files which don't grow for stall
+func newPartialWatch(stall time.Duration) *partialWatch {
+	return &partialWatch{
+		stall: stall,
+		seen:  map[string]partialSeen{},
+	}
+}
+
+// Sort the partial files into those which have grown in the last
+// stall, or have just appeared, and those which haven't
+func (w *partialWatch) check(partials []completedFile) (growing, stalled []completedFile) {
+	now := time.Now()
+	for _, f := range partials {
+		seen, ok := w.seen[f.name]
+		if !ok || seen.size != f.size {
+			seen = partialSeen{size: f.size, changed: now}
+			w.seen[f.name] = seen
+		}
+		if now.Sub(seen.changed) < w.stall {
+			growing = append(growing, f)
+		} else {
+			stalled = append(stalled, f)
+		}
+	}
+	return growing, stalled
+}
+
+// How many times a book whose download stalled is asked for again
+// before it is recorded as failed
+const maxStallRetries = 2
+
+// Wait for the files in dir still being downloaded to finish, giving
+// up on each one when it makes no progress for
+// Options.TimeDownloadStall, then list the completed files as
+// listCompleted does.
+//
+// Files which stalled are removed and their books asked for again up
+// to maxStallRetries times, after which they are recorded as failed.
+func (c *Client) waitPartial(dir string) (files []completedFile, partial bool, err error) {
+	w := newPartialWatch(c.opt.TimeDownloadStall)
+	want, wantBy := 0, time.Time{}
+	for {
+		files, partials, err := listDownloads(dir)
+		if err != nil {
+			return nil, false, err
+		}
+		growing, stalled := w.check(partials)
+		if len(growing) > 0 {
+			time.Sleep(c.opt.TimeRetrySleep)
+			continue
+		}
+		if len(stalled) == 0 {
+			// Give the books asked for again time to start downloading
+			if len(files)+len(partials) < want && time.Now().Before(wantBy) {
+				time.Sleep(c.opt.TimeRetrySleep)
+				continue
+			}
+			return files, false, nil
+		}
+		retried := c.retryStalled(dir, stalled)
+		for _, f := range stalled {
+			delete(w.seen, f.name)
+		}
+		if retried > 0 {
+			want = len(files) + len(partials) - len(stalled) + retried
+			wantBy = time.Now().Add(c.opt.TimeDownloadStall)
+			continue
+		}
+		files, partials, err = listDownloads(dir)
+		return files, len(partials) > 0, err
+	}
+}
+
+// Remove the partial files which stalled and ask for the books they
+// were for again, recording them as failed if that has been done
+// maxStallRetries times already or doesn't work.
+//
+// It returns the number of books asked for again.
+func (c *Client) retryStalled(dir string, stalled []completedFile) (retried int) {
+	if c.stallRetries == nil {
+		c.stallRetries = map[string]int{}
+	}
+	entries := c.manifest.Snapshot()
+	for _, f := range stalled {
+		subLog := slog.With("file", f.name, "size", f.size)
+		subLog.Warn("Download stalled - removing it", "stall", c.opt.TimeDownloadStall)
+		err := os.Remove(filepath.Join(dir, filepath.FromSlash(f.name)))
+		if err != nil {
+			subLog.Error("Failed to remove stalled download", "err", err)
+		}
+		e, ok := stalledEntry(entries, f)
+		if !ok {
+			continue
+		}
+		subLog = subLog.With("book", e.Number, "asin", e.ASIN, "title", e.Title)
+		if e.ASIN != "" && c.stallRetries[e.ASIN] < maxStallRetries {
+			c.stallRetries[e.ASIN]++
+			subLog.Warn("Book didn't finish downloading - asking for it again", "try", c.stallRetries[e.ASIN], "tries", maxStallRetries)
+			err = c.requestAgain(&e, f.name)
+			if err == nil {
+				retried++
+				continue
+			}
+			subLog.Error("Failed to ask for book again", "err", err)
+		}
+		subLog.Warn("Book didn't finish downloading - recording it as failed")
+		err = c.manifest.record(e.Book, e.Number, StatusFailed, errStalled, e.Curl)
+		if err != nil {
+			subLog.Error("Failed to record stalled download in manifest", "err", err)
+		}
+		err = c.recordState(&e.Book, e.Number, StatusFailed, errStalled)
+		if err != nil {
+			subLog.Error("Failed to record stalled download", "err", err)
+		}
+	}
+	return retried
+}
+
+// Find the manifest entry for the book the stalled partial file f was
+// for, if any
+func stalledEntry(entries []ManifestEntry, f completedFile) (ManifestEntry, bool) {
+	// The partial file is named after the final file, eg
+	// book.azw3.crdownload, once the browser knows what it is
+	final := []completedFile{{name: strings.TrimSuffix(f.name, filepath.Ext(f.name))}}
+	for _, e := range entries {
+		if e.Status == StatusDownloaded && e.File == "" && findBookFile(final, &e.Book) >= 0 {
+			return e, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+// Ask for the book in e to be downloaded again from its page of the
+// library for the kindle the stalled file name was for
+//
+// The marketplace, content type and kindle are switched to those of
+// the book, and they and the position in the library are put back
+// afterwards.
+func (c *Client) requestAgain(e *ManifestEntry, name string) error {
+	if c.page == nil {
+		return errors.New("browser isn't running")
+	}
+	book, pageNumber, offset := c.book, c.pageNumber, c.offset
+	defer func(content, marketplace, kindle int) {
+		c.useContentType(content)
+		err := c.useMarketplace(marketplace)
+		if err == nil {
+			err = c.resetKindle(kindle)
+		}
+		if err != nil {
+			slog.Error("Failed to go back to the library after asking for book again", "err", err)
+		}
+		c.book, c.pageNumber, c.offset = book, pageNumber, offset
+	}(c.contentIndex, c.marketplaceIndex, c.kindleIndex)
+	c.useContentType(max(slices.Index(c.opt.ContentTypes, e.Content), 0))
+	err := c.useMarketplace(max(slices.Index(c.opt.Marketplaces, e.Marketplace), 0))
+	if err != nil {
+		return err
+	}
+	kindle := max(slices.Index(c.opt.kindles(), c.kindleOf(name)), 0)
+	err = c.resetKindle(kindle)
+	if err != nil {
+		return fmt.Errorf("failed to set download directory for kindle: %w", err)
+	}
+	c.seekBook(e.Number)
+	subLog := slog.Default().With(
+		"url", c.pageURL(),
+		"page", c.pageNumber,
+	)
+	err = c.openPage()
+	if err != nil {
+		return err
+	}
+	c.dismissOverlays(subLog)
+	actions, err := c.findElementWithText(subLog, "span", c.reMoreActions)
+	if err != nil {
+		return fmt.Errorf("couldn't find books (-msg-more-actions=%q): %w", c.opt.MsgMoreActions, err)
+	}
+	for _, row := range c.findRows(subLog, actions) {
+		if row.asin != e.ASIN {
+			continue
+		}
+		meta := e.Book
+		status, err := c.requestForKindle(subLog, kindle, row.action, &meta, c.timings.newBook())
+		if err == nil && status != "" {
+			err = fmt.Errorf("book was %s instead of downloaded", status)
+		}
+		return err
+	}
+	return errors.New("book not found on its page of the library")
+}
@@ -0,0 +1,59 @@
+package kindledl
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// pauser lets the run be paused between books
+type pauser struct {
+	mu     sync.Mutex
+	paused bool
+	resume chan struct{} // closed when the run is resumed
+}
+
+// Pause stops the run before the next book until Resume is called
+//
+// This is safe to call from another goroutine.
+func (c *Client) Pause() {
+	c.pauser.mu.Lock()
+	defer c.pauser.mu.Unlock()
+	if c.pauser.paused {
+		return
+	}
+	c.pauser.paused = true
+	c.pauser.resume = make(chan struct{})
+	slog.Info("Pausing downloads")
+}
+
+// Resume continues a run stopped by Pause
+//
+// This is safe to call from another goroutine.
+func (c *Client) Resume() {
+	c.pauser.mu.Lock()
+	defer c.pauser.mu.Unlock()
+	if !c.pauser.paused {
+		return
+	}
+	c.pauser.paused = false
+	close(c.pauser.resume)
+	slog.Info("Resuming downloads")
+}
+
+// Paused returns whether the run is paused
+func (c *Client) Paused() bool {
+	c.pauser.mu.Lock()
+	defer c.pauser.mu.Unlock()
+	return c.pauser.paused
+}
+
+// Wait while the run is paused
+func (c *Client) waitWhilePaused() {
+	c.pauser.mu.Lock()
+	paused, resume := c.pauser.paused, c.pauser.resume
+	c.pauser.mu.Unlock()
+	if paused {
+		slog.Info("Paused - waiting to be resumed")
+		<-resume
+	}
+}
@@ -0,0 +1,102 @@
+package kindledl
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// How many books can wait for the post-processing workers before the
+// run waits for them to catch up
+const postQueueSize = 100
+
+// How many times to try a post-processing hook before giving up
+const postTries = 3
+
+// postPool runs the EventPostBook hooks in the background so slow
+// post-processing, eg uploads or conversions, doesn't hold up the
+// browser.
+type postPool struct {
+	queue   chan Event
+	workers sync.WaitGroup // running workers
+	pending sync.WaitGroup // events queued but not processed yet
+	mu      sync.Mutex     // held while running the built in hooks as they share state
+}
+
+// Start Options.PostWorkers workers to run the EventPostBook hooks
+func (c *Client) startPostPool() {
+	c.post = &postPool{
+		queue: make(chan Event, postQueueSize),
+	}
+	for range c.opt.PostWorkers {
+		c.post.workers.Add(1)
+		go c.postWorker()
+	}
+	slog.Debug("Started post-processing workers", "workers", c.opt.PostWorkers)
+}
+
+// Queue the event for the workers
+//
+// The book is copied as the caller reuses it.
+func (c *Client) queuePost(e Event) {
+	if e.Book != nil {
+		b := *e.Book
+		e.Book = &b
+	}
+	c.post.pending.Add(1)
+	c.post.queue <- e
+}
+
+// Wait for the events queued so far to be processed
+func (c *Client) waitPost() {
+	if c.post == nil {
+		return
+	}
+	c.post.pending.Wait()
+}
+
+// Wait for the queued events to be processed then stop the workers
+func (c *Client) stopPostPool() {
+	if c.post == nil {
+		return
+	}
+	close(c.post.queue)
+	c.post.workers.Wait()
+	c.post = nil
+}
+
+// Run the hooks for each event in the queue until it is closed
+func (c *Client) postWorker() {
+	defer c.post.workers.Done()
+	for e := range c.post.queue {
+		for i, hook := range c.hooks {
+			c.runPostHook(hook, i < c.builtinHooks, e)
+		}
+		c.post.pending.Done()
+	}
+}
+
+// Run the hook for the event, trying it again if it fails
+//
+// Failures don't stop the run but are logged.
+func (c *Client) runPostHook(hook Hook, builtin bool, e Event) {
+	for try := 1; ; try++ {
+		var err error
+		if builtin {
+			c.post.mu.Lock()
+			err = hook(e)
+			c.post.mu.Unlock()
+		} else {
+			err = hook(e)
+		}
+		if err == nil {
+			return
+		}
+		if try >= postTries {
+			slog.Error("Post-processing failed", "book", e.Number, "tries", try, "err", err)
+			return
+		}
+		slog.Warn("Post-processing failed - trying again", "book", e.Number, "try", try, "err", err)
+		time.Sleep(time.Duration(try) * c.opt.TimeRetrySleep)
+	}
+}
@@ -0,0 +1,47 @@
+package kindledl
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Switch the library to the profile in Options.Profile, eg the Amazon
+// Kids profile of a child in the household.
+//
+// This opens the profile menu and picks the profile from it. Amazon
+// remembers the choice for the rest of the session.
+func (c *Client) selectProfile(ctx context.Context) error {
+	if c.opt.Profile == "" {
+		return nil
+	}
+	subLog := slog.With("profile", c.opt.Profile)
+	err := c.openLibrary(ctx)
+	if err != nil {
+		return err
+	}
+	menu, err := c.findOneElementWithText(subLog, "span", c.reProfileMenu)
+	if err != nil {
+		return fmt.Errorf("couldn't find profile menu (-msg-profile-menu=%q): %w", c.opt.MsgProfileMenu, err)
+	}
+	subLog.Debug("Opening profile menu")
+	err = c.click(menu)
+	if err != nil {
+		return fmt.Errorf("error clicking on profile menu: %w", err)
+	}
+	profile, err := c.findOneElementWithText(subLog, "span", c.reProfile)
+	if err != nil {
+		return fmt.Errorf("couldn't find profile in menu (-profile=%q): %w", c.opt.Profile, err)
+	}
+	subLog.Debug("Selecting profile")
+	err = c.click(profile)
+	if err != nil {
+		return fmt.Errorf("error clicking on profile: %w", err)
+	}
+	err = c.page.WaitLoad()
+	if err != nil {
+		return fmt.Errorf("profile page load: %w", err)
+	}
+	subLog.Info("Switched to profile")
+	return nil
+}
@@ -0,0 +1,64 @@
+package kindledl
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Weight given to the latest book in the moving average
+const progressAlpha = 0.1
+
+// progress tracks how fast books are being downloaded
+type progress struct {
+	done     int           // books done this run
+	avg      time.Duration // moving average time per book
+	lastBook time.Time     // when the last book finished
+	interval time.Duration // how often to log the status
+	lastLog  time.Time     // when we last logged the status
+}
+
+// Start timing the books, logging the status every interval
+func (p *progress) start(interval time.Duration) {
+	p.interval = interval
+	p.lastBook = time.Now()
+	p.lastLog = p.lastBook
+}
+
+// Note that a book has been done, returning how long it took
+func (p *progress) bookDone() time.Duration {
+	now := time.Now()
+	took := now.Sub(p.lastBook)
+	p.lastBook = now
+	p.done++
+	if p.done == 1 {
+		p.avg = took
+	} else {
+		p.avg = time.Duration(progressAlpha*float64(took) + (1-progressAlpha)*float64(p.avg))
+	}
+	return took
+}
+
+// Log the status if the interval has passed since the last time
+//
+// remaining is the number of books left to do or -1 if not known.
+func (p *progress) log(remaining int) {
+	now := time.Now()
+	if p.interval <= 0 || now.Sub(p.lastLog) < p.interval || p.done == 0 {
+		return
+	}
+	p.lastLog = now
+	attrs := []any{
+		"done", p.done,
+		"per_book", p.avg.Round(time.Second),
+		"books_per_hour", int(float64(time.Hour)/float64(p.avg) + 0.5),
+	}
+	if remaining >= 0 {
+		eta := time.Duration(remaining) * p.avg
+		attrs = append(attrs,
+			"remaining", remaining,
+			"time_left", eta.Round(time.Minute),
+			"eta", now.Add(eta).Format(time.DateTime),
+		)
+	}
+	slog.Info("Status", attrs...)
+}
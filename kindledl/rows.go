@@ -0,0 +1,200 @@
+package kindledl
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/go-rod/rod"
+)
+
+// Attribute the ASIN of each row is put in by rowsJS
+const rowASINAttr = "data-kindledl-asin"
+
+// JavaScript to find the row of each book on the page
+//
+// The elements in each row have the ASIN of the book in their ids, eg
+// content-title-B000JMLBHU, or in data-asin. The row of a book is
+// the biggest element containing the elements with its ASIN but none
+// with another ASIN. The ASIN is noted in rowASINAttr on the row.
+const rowsJS = `() => {
+	const re = /(?:^|[^A-Z0-9])(B[0-9A-Z]{9})(?:[^A-Z0-9]|$)/;
+	const carriers = [];
+	for (const el of document.querySelectorAll("[id], [data-asin]")) {
+		const m = (el.getAttribute("data-asin") || el.id).match(re);
+		if (m) carriers.push([el, m[1]]);
+	}
+	const rows = [];
+	const done = new Set();
+	for (const [el, asin] of carriers) {
+		if (done.has(asin)) continue;
+		done.add(asin);
+		let row = el;
+		while (row.parentElement && !carriers.some(([other, otherASIN]) => otherASIN !== asin && row.parentElement.contains(other))) {
+			row = row.parentElement;
+		}
+		row.setAttribute("` + rowASINAttr + `", asin);
+		rows.push(row);
+	}
+	return rows;
+}`
+
+// A book found on the page
+type pageRow struct {
+	asin   string       // ASIN read from the row, "" if not known
+	action *rod.Element // button to open the book's more actions menu
+}
+
+// Find the row of each book on the page and the more actions button
+// in it so each button is tied to the ASIN of its book.
+//
+// actions are the more actions buttons found on the whole page. If
+// the rows can't be found, or they don't account for all the buttons,
+// the buttons are returned in order without ASINs so the books are
+// matched to their metadata by position instead.
+func (c *Client) findRows(subLog *slog.Logger, actions rod.Elements) []pageRow {
+	ordered := make([]pageRow, len(actions))
+	for i, action := range actions {
+		ordered[i].action = action
+	}
+	rowElements, err := c.page.ElementsByJS(rod.Eval(rowsJS))
+	if err != nil {
+		subLog.Debug("Failed to find book rows - using positions", "err", err)
+		return ordered
+	}
+	if len(rowElements) != len(actions) {
+		subLog.Debug("Book rows don't match more actions buttons - using positions", "rows", len(rowElements), "buttons", len(actions))
+		return ordered
+	}
+	rows := make([]pageRow, 0, len(rowElements))
+	for _, row := range rowElements {
+		asin, err := row.Attribute(rowASINAttr)
+		if err != nil || asin == nil {
+			subLog.Debug("Failed to read ASIN of book row - using positions", "err", err)
+			return ordered
+		}
+		found, err := c.findInRow(row, c.reMoreActions)
+		if err != nil || len(found) != 1 {
+			subLog.Debug("Didn't find one more actions button in book row - using positions", "asin", *asin, "found", len(found), "err", err)
+			return ordered
+		}
+		rows = append(rows, pageRow{asin: *asin, action: found[0]})
+	}
+	subLog.Debug("Found book rows", "rows", len(rows))
+	return rows
+}
+
+// Prefixes of the ids of the elements in a book's row with its details,
+// followed by the ASIN
+const (
+	rowTitlePrefix  = "content-title-"
+	rowAuthorPrefix = "content-author-"
+	rowDatePrefix   = "content-acquired-date-"
+)
+
+// Read the text of the element with id prefix+asin in the row of the
+// book, returning "" if it isn't found
+func (c *Client) rowText(subLog *slog.Logger, prefix, asin string) string {
+	elements, err := c.page.Elements(fmt.Sprintf("[id=%q]", prefix+asin))
+	if err != nil || len(elements) == 0 {
+		subLog.Debug("Couldn't find text in book row", "id", prefix+asin, "err", err)
+		return ""
+	}
+	text, err := elements[0].Text()
+	if err != nil {
+		subLog.Debug("Couldn't read text in book row", "id", prefix+asin, "err", err)
+		return ""
+	}
+	return strings.TrimSpace(text)
+}
+
+// Fill in the details of the book missing from its metadata, eg if it
+// couldn't be fetched, from the text in its row
+func (c *Client) fillFromRow(subLog *slog.Logger, meta *Book) {
+	if meta.ASIN == "" {
+		return
+	}
+	if meta.Title == "" {
+		meta.Title = c.rowText(subLog, rowTitlePrefix, meta.ASIN)
+	}
+	if meta.Authors == "" {
+		meta.Authors = c.rowText(subLog, rowAuthorPrefix, meta.ASIN)
+	}
+	if meta.Acquired == "" {
+		meta.Acquired = c.rowText(subLog, rowDatePrefix, meta.ASIN)
+	}
+}
+
+// Find the elements inside row whose text matches, looking in the
+// accessibility tree if there aren't any spans with the text
+func (c *Client) findInRow(row *rod.Element, match *regexp.Regexp) (found rod.Elements, err error) {
+	elements, err := row.Elements("span")
+	if err != nil {
+		return nil, fmt.Errorf("error looking for %q in row: %w", match, err)
+	}
+	for _, el := range elements {
+		elText, err := el.Text()
+		if err != nil {
+			return nil, fmt.Errorf("error looking for %q in row: %w", match, err)
+		}
+		if match.MatchString(elText) {
+			found = append(found, el)
+		}
+	}
+	if len(found) > 0 {
+		return found, nil
+	}
+	return c.findByAXTree(row, match)
+}
+
+// Matches the id of the radio buttons in the device dialog, eg
+// download_and_transfer_list_B000JMLBHU_3, to read the ASIN
+var reDialogASIN = regexp.MustCompile(`^download_and_transfer_list_(.+)_\d+$`)
+
+// Check the device dialog whose kindle item is li belongs to the book
+// expected, from the ASIN in the ids of its radio buttons
+//
+// If the ASIN can't be read the dialog is assumed to be right.
+func (c *Client) checkDialogASIN(subLog *slog.Logger, li *rod.Element, meta *Book) error {
+	if meta.ASIN == "" {
+		return nil
+	}
+	radios, err := li.Elements("[id^='download_and_transfer_list_']")
+	if err != nil || len(radios) == 0 {
+		subLog.Debug("Couldn't find radio id to check ASIN in dialog", "err", err)
+		return nil
+	}
+	id, err := radios[0].Attribute("id")
+	if err != nil || id == nil {
+		subLog.Debug("Couldn't read radio id to check ASIN in dialog", "err", err)
+		return nil
+	}
+	match := reDialogASIN.FindStringSubmatch(*id)
+	if match == nil {
+		subLog.Debug("Couldn't find ASIN in radio id in dialog", "id", *id)
+		return nil
+	}
+	if !strings.EqualFold(match[1], meta.ASIN) {
+		subLog.Warn("Device dialog is for a different book - not downloading", "dialog_asin", match[1])
+		return fmt.Errorf("device dialog is for book %q not %q", match[1], meta.ASIN)
+	}
+	return nil
+}
+
+// Returns the metadata for the n-th book on the page whose row has
+// asin, if known
+func (c *Client) pageBook(n int, asin string) Book {
+	if asin != "" {
+		for _, b := range c.pageBooks {
+			if strings.EqualFold(b.ASIN, asin) {
+				return b
+			}
+		}
+		return Book{ASIN: asin, Marketplace: c.marketplace, Content: c.content}
+	}
+	if n < len(c.pageBooks) {
+		return c.pageBooks[n]
+	}
+	return Book{Marketplace: c.marketplace, Content: c.content}
+}
@@ -0,0 +1,98 @@
+package kindledl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RunsFile is the name of the file in the config directory with the
+// history of the runs
+const RunsFile = "runs.jsonl"
+
+// Reasons a run ended for RunRecord
+const (
+	RunFinished  = "finished"  // all the books were processed
+	RunFailed    = "failed"    // the run stopped with an error
+	RunBenchmark = "benchmark" // the sample of books for Options.Benchmark was done
+	RunMaxBooks  = "max-books" // Options.MaxBooks books were downloaded
+)
+
+// RunRecord summarises one run for the history in RunsFile
+type RunRecord struct {
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	FirstBook  int            `json:"first_book"`            // position in the library at the start
+	LastBook   int            `json:"last_book"`             // position in the library at the end
+	TotalBooks int            `json:"total_books,omitempty"` // books in the library, if known
+	Counts     map[string]int `json:"counts"`                // number of books with each status
+	Reason     string         `json:"reason"`                // why the run ended, eg RunFinished
+	Error      string         `json:"error,omitempty"`
+}
+
+// ConfigRoot returns the config directory from the options
+func ConfigRoot(opt *Options) (string, error) {
+	if opt.ConfigDir != "" {
+		return opt.ConfigDir, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("didn't find config directory: %w", err)
+	}
+	return filepath.Join(dir, Program), nil
+}
+
+// Append a record of the run which started at start from book
+// firstBook and ended with runErr to the history
+//
+// Failures are logged as they shouldn't stop the run.
+func (c *Client) recordRun(start time.Time, firstBook int, runErr error) {
+	r := RunRecord{
+		Start:     start,
+		End:       time.Now(),
+		FirstBook: firstBook,
+		LastBook:  c.book,
+		Counts:    c.counts,
+		Reason:    RunFinished,
+	}
+	if c.totalBooks >= 0 {
+		r.TotalBooks = c.totalBooks
+	}
+	if errors.Is(runErr, ErrBenchmarkDone) {
+		r.Reason = RunBenchmark
+	} else if errors.Is(runErr, ErrMaxBooks) {
+		r.Reason = RunMaxBooks
+	} else if runErr != nil && !errors.Is(runErr, ErrFinished) {
+		r.Reason = RunFailed
+		r.Error = runErr.Error()
+	}
+	err := appendJSONLine(filepath.Join(c.configRoot, RunsFile), r)
+	if err != nil {
+		slog.Error("Failed to record run history", "err", err)
+	}
+}
+
+// Append v as a line of JSON to the file at path
+func appendJSONLine(path string, v any) (err error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode: %w", err)
+	}
+	data = append(data, '\n')
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := out.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	_, err = out.Write(data)
+	return err
+}
@@ -0,0 +1,70 @@
+package kindledl
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Columns written to the samples CSV
+var samplesColumns = []string{
+	"asin",
+	"title",
+	"authors",
+	"acquired",
+	"marketplace",
+}
+
+// Sample returns whether the book is a free sample
+//
+// Samples can't be downloaded as they don't have a download link.
+func (b *Book) Sample() bool {
+	return strings.EqualFold(b.Origin, "Sample")
+}
+
+// WriteSamples writes the samples in the manifest to path as CSV so
+// they can be reviewed to decide which books to buy.
+func (c *Client) WriteSamples(path string) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	err := w.Write(samplesColumns)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, e := range c.manifest.Snapshot() {
+		if !e.Sample() {
+			continue
+		}
+		err = w.Write([]string{e.ASIN, e.Title, e.Authors, e.Acquired, e.Marketplace})
+		if err != nil {
+			return err
+		}
+		n++
+	}
+	w.Flush()
+	err = w.Error()
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(path, buf.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write samples: %w", err)
+	}
+	slog.Info("Wrote samples", "file", path, "samples", n)
+	return nil
+}
+
+// Write the samples at the end of the run
+func (c *Client) samplesHook(e Event) error {
+	if e.Type != EventPostRun {
+		return nil
+	}
+	err := c.WriteSamples(c.opt.Samples)
+	if err != nil {
+		slog.Error("Failed to write samples", "err", err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package kindledl
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-rod/rod"
+)
+
+// Names of the functions a selector script can provide, keyed by the
+// text regexp they replace
+//
+// The selector script is a JavaScript expression evaluating to an
+// object with some of these functions, each of which should return an
+// array or NodeList of the elements it finds, eg
+//
+//	({
+//		moreActions: () => document.querySelectorAll("[id^=dd_action_button]"),
+//		success: () => [document.getElementById("notification-success")],
+//	})
+//
+// The kindle function is passed the name of the kindle and the profile
+// function the name of the profile.
+func (c *Client) selectorNames() map[*regexp.Regexp]string {
+	return map[*regexp.Regexp]string{
+		c.reShowing:        "showing",
+		c.reMoreActions:    "moreActions",
+		c.reClearFurthest:  "clearFurthest",
+		c.reDownloadViaUSB: "downloadViaUSB",
+		c.reKindleName:     "kindle",
+		c.reDownloadButton: "downloadButton",
+		c.reSuccess:        "success",
+		c.reProfileMenu:    "profileMenu",
+		c.reProfile:        "profile",
+	}
+}
+
+// Returns whether selector is an XPath rather than a CSS selector
+func isXPath(selector string) bool {
+	return strings.HasPrefix(selector, "/") || strings.HasPrefix(selector, "(") || strings.HasPrefix(selector, "./")
+}
+
+// Work out which regexps Options.Selectors replaces
+func (c *Client) loadSelectors() error {
+	c.overrides = map[*regexp.Regexp]string{}
+	names := c.selectorNames()
+	for name, selector := range c.opt.Selectors {
+		found := false
+		for re, reName := range names {
+			if reName == name {
+				c.overrides[re] = selector
+				found = true
+			}
+		}
+		if !found {
+			var known []string
+			for _, reName := range names {
+				known = append(known, reName)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unknown selector %q - use one of %s", name, strings.Join(known, ", "))
+		}
+		slog.Debug("Using selector", "name", name, "selector", selector, "xpath", isXPath(selector))
+	}
+	return nil
+}
+
+// Find elements using a CSS selector or an XPath
+func (c *Client) findBySelector(selector string) (rod.Elements, error) {
+	var elements rod.Elements
+	var err error
+	if isXPath(selector) {
+		elements, err = c.page.ElementsX(selector)
+	} else {
+		elements, err = c.page.Elements(selector)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("selector %q failed: %w", selector, err)
+	}
+	return elements, nil
+}
+
+// Work out which functions the selector script provides
+func (c *Client) loadSelectorScript() error {
+	c.selectors = map[*regexp.Regexp]string{}
+	if c.opt.SelectorScript == "" {
+		return nil
+	}
+	for re, name := range c.selectorNames() {
+		res, err := c.page.Eval(`(name) => typeof (`+c.opt.SelectorScript+`)[name] === "function"`, name)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate selector script: %w", err)
+		}
+		if res.Value.Bool() {
+			slog.Debug("Using selector script", "name", name)
+			c.selectors[re] = name
+		}
+	}
+	if len(c.selectors) == 0 {
+		return fmt.Errorf("selector script doesn't provide any of the known functions")
+	}
+	return nil
+}
+
+// Find elements using the function name from the selector script
+func (c *Client) findByScript(name string) (rod.Elements, error) {
+	arg := c.kindleName()
+	if name == "profile" {
+		arg = c.opt.Profile
+	}
+	js := `(name, arg) => Array.from((` + c.opt.SelectorScript + `)[name](arg) || [])`
+	elements, err := c.page.ElementsByJS(rod.Eval(js, name, arg))
+	if err != nil {
+		return nil, fmt.Errorf("selector script %q failed: %w", name, err)
+	}
+	return elements, nil
+}
@@ -0,0 +1,166 @@
+package kindledl
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Functions available to sidecar templates as well as the text/template
+// builtins
+var sidecarFuncs = template.FuncMap{
+	// json marshals the value as indented JSON
+	"json": func(v any) (string, error) {
+		data, err := json.MarshalIndent(v, "", "  ")
+		return string(data), err
+	},
+	// xml escapes the string for use in XML, eg OPF files
+	"xml": func(s string) (string, error) {
+		var buf bytes.Buffer
+		err := xml.EscapeText(&buf, []byte(s))
+		return buf.String(), err
+	},
+	// quote quotes the string with double quotes, eg for YAML
+	"quote": func(s string) (string, error) {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		err := enc.Encode(s)
+		return strings.TrimSuffix(buf.String(), "\n"), err
+	},
+	// join joins the strings with the separator
+	"join": func(elems []string, sep string) string {
+		return strings.Join(elems, sep)
+	},
+}
+
+// Parse the Options.SidecarTemplate file
+//
+// The sidecar is rendered with the ManifestEntry for the book so can
+// use its fields, eg {{.Title}}, {{.ASIN}}, {{join .Tags ", "}} and
+// {{.File}}.
+func parseSidecar(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sidecar template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(sidecarFuncs).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sidecar template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// Returns the extension for sidecar files made from the template at
+// path, eg "book.opf.tmpl" makes ".opf" files.
+func sidecarExt(path string) string {
+	name := filepath.Base(path)
+	for _, suffix := range []string{".tmpl", ".tpl", ".gotmpl"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	ext := filepath.Ext(name)
+	if ext == "" {
+		ext = ".txt"
+	}
+	return ext
+}
+
+// Write the sidecars for the entry next to its file if
+// Options.SidecarTemplate or Options.JSONSidecar is set.
+func (c *Client) writeSidecar(e *ManifestEntry) error {
+	if e.File == "" {
+		return nil
+	}
+	if c.opt.JSONSidecar {
+		err := c.writeJSONSidecar(e)
+		if err != nil {
+			return err
+		}
+	}
+	if c.sidecar == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	err := c.sidecar.Execute(&buf, e)
+	if err != nil {
+		return fmt.Errorf("failed to render sidecar: %w", err)
+	}
+	bookPath := filepath.Join(c.downloadDir, filepath.FromSlash(e.File))
+	sidecarPath := strings.TrimSuffix(bookPath, filepath.Ext(bookPath)) + sidecarExt(c.opt.SidecarTemplate)
+	err = writeFileAtomic(sidecarPath, buf.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write sidecar: %w", err)
+	}
+	slog.Debug("Wrote sidecar", "file", sidecarPath)
+	return nil
+}
+
+// Suffix added to the name of a book for its Options.JSONSidecar
+const jsonSidecarSuffix = ".json"
+
+// Returns whether the file name is of a sidecar writeSidecar writes
+//
+// The sidecars from the template may have the extension of a book, eg
+// ".pdf", and have the ASIN of the book in their name, so need telling
+// apart from the books.
+func (c *Client) isSidecar(name string) bool {
+	if strings.HasSuffix(strings.ToLower(name), jsonSidecarSuffix) {
+		return true
+	}
+	return c.opt.SidecarTemplate != "" && strings.EqualFold(path.Ext(name), sidecarExt(c.opt.SidecarTemplate))
+}
+
+// jsonSidecar is what Options.JSONSidecar writes next to each book
+type jsonSidecar struct {
+	ASIN        string    `json:"asin"`
+	Title       string    `json:"title,omitempty"`
+	Authors     string    `json:"authors,omitempty"`
+	Acquired    string    `json:"acquired,omitempty"`   // purchase date as Amazon shows it
+	OrderID     string    `json:"order_id,omitempty"`   // order the book was bought in
+	OrderDate   string    `json:"order_date,omitempty"` // only set with -enrich-orders
+	Marketplace string    `json:"marketplace,omitempty"`
+	Kindle      string    `json:"kindle,omitempty"` // name of the kindle the book was downloaded for
+	Downloaded  time.Time `json:"downloaded"`
+	URL         string    `json:"url,omitempty"` // URL the browser downloaded the book from
+	File        string    `json:"file"`          // name of the book file next to the sidecar
+	Format      string    `json:"format,omitempty"`
+	SHA256      string    `json:"sha256,omitempty"`
+}
+
+// Write the JSON sidecar for the entry next to its file
+func (c *Client) writeJSONSidecar(e *ManifestEntry) error {
+	s := jsonSidecar{
+		ASIN:        e.ASIN,
+		Title:       e.Title,
+		Authors:     e.Authors,
+		Acquired:    e.Acquired,
+		OrderID:     e.OrderID,
+		OrderDate:   e.OrderDate,
+		Marketplace: e.Marketplace,
+		Kindle:      c.kindleOf(e.File),
+		Downloaded:  e.Time,
+		URL:         e.URL,
+		File:        path.Base(e.File),
+		Format:      e.Format,
+		SHA256:      e.SHA256,
+	}
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	sidecarPath := filepath.Join(c.downloadDir, filepath.FromSlash(e.File)) + jsonSidecarSuffix
+	err = writeFileAtomic(sidecarPath, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write JSON sidecar: %w", err)
+	}
+	slog.Debug("Wrote JSON sidecar", "file", sidecarPath)
+	return nil
+}
@@ -0,0 +1,200 @@
+package kindledl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Directory in the staging directory where downloads which fail the
+// checks are put, hidden so they aren't looked at again
+const rejectedDir = ".rejected"
+
+// Move the files which have finished downloading from the staging
+// directory into the output directory, checking them on the way.
+//
+// If wait is set then wait for files being downloaded to complete
+// first, giving up on any which stall as waitPartial does. Failures are
+// logged and files which can't be moved are tried again next time this
+// is called.
+func (c *Client) unstage(wait bool) {
+	var files []completedFile
+	var err error
+	if wait {
+		files, _, err = c.waitPartial(c.stagingDir)
+	} else {
+		files, _, err = listCompleted(c.stagingDir)
+	}
+	if err != nil {
+		slog.Error("Failed to list staging directory", "err", err)
+		return
+	}
+	for _, f := range files {
+		err = c.unstageFile(f)
+		if err != nil {
+			slog.Error("Failed to move download into output directory", "file", f.name, "err", err)
+		}
+	}
+}
+
+// Check the staged file f is a book then move it to the same place in
+// the output directory
+//
+// Files which fail the checks are moved into the rejectedDir of the
+// staging directory.
+func (c *Client) unstageFile(f completedFile) error {
+	src := filepath.Join(c.stagingDir, filepath.FromSlash(f.name))
+	err := checkDownload(src, f.size)
+	if err != nil {
+		slog.Error("Download failed checks - not moving it into the output directory", "file", f.name, "err", err)
+		return c.reject(src, f.name)
+	}
+	hash, err := fileSHA256(src)
+	if err != nil {
+		return err
+	}
+	dst, err := uniquePath(filepath.Join(c.downloadDir, filepath.FromSlash(f.name)))
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(dst), 0777)
+	if err != nil {
+		return fmt.Errorf("failed to make output directory: %w", err)
+	}
+	switch {
+	case c.opt.VerifyCopy:
+		err = moveVerified(src, dst, hash)
+	case c.copyStaged:
+		err = moveCopy(src, dst)
+	default:
+		err = os.Rename(src, dst)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to move download: %w", err)
+	}
+	name, err := filepath.Rel(c.downloadDir, dst)
+	if err != nil {
+		return err
+	}
+	name = filepath.ToSlash(name)
+	c.hashes[name] = hash
+	slog.Info("Moved download into output directory", "file", name, "sha256", hash)
+	return nil
+}
+
+// Check the file at path of size bytes is a complete book
+func checkDownload(path string, size int64) error {
+	if size == 0 {
+		return errors.New("file is empty")
+	}
+	format, err := detectFormat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if format == FormatUnknown {
+		return errors.New("file isn't a known book format")
+	}
+	// Check the size hasn't changed so the browser has finished
+	// writing it
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() != size {
+		return fmt.Errorf("file size changed from %d to %d while checking it", size, info.Size())
+	}
+	return nil
+}
+
+// Move the staged file at path with name relative to the staging
+// directory into the rejectedDir
+func (c *Client) reject(path, name string) error {
+	dst, err := uniquePath(filepath.Join(c.stagingDir, rejectedDir, filepath.FromSlash(name)))
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(dst), 0777)
+	if err == nil {
+		err = os.Rename(path, dst)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to move rejected download: %w", err)
+	}
+	slog.Warn("Moved rejected download", "file", dst)
+	return nil
+}
+
+// Return path, or if it exists already path with " (n)" added before
+// the extension as the browser does, so nothing is overwritten.
+func uniquePath(path string) (string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 1; ; n++ {
+		_, err := os.Lstat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return path, nil
+		} else if err != nil {
+			return "", err
+		}
+		path = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+}
+
+// Return the SHA-256 of the file at path as hex
+func fileSHA256(path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	h := sha256.New()
+	_, err = io.Copy(h, in)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %q: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Work out whether to copy the books from the staging directory to
+// the output directory rather than renaming them, according to
+// Options.StagingMove.
+func (c *Client) setupStagingMove() error {
+	switch c.opt.StagingMove {
+	case MoveAuto, "":
+		ok, err := canRename(c.stagingDir, c.downloadDir)
+		if err != nil {
+			return fmt.Errorf("failed to check staging directory: %w", err)
+		}
+		if !ok {
+			slog.Info("Staging and output directories are on different filesystems - copying books instead of moving them")
+		}
+		c.copyStaged = !ok
+	case MoveRename:
+		c.copyStaged = false
+	case MoveCopy:
+		c.copyStaged = true
+	default:
+		return fmt.Errorf("unknown staging move %q - use %s, %s or %s", c.opt.StagingMove, MoveAuto, MoveRename, MoveCopy)
+	}
+	return nil
+}
+
+// Move the downloads from the staging directory into the output
+// directory as each book completes.
+func (c *Client) stagingHook(e Event) error {
+	switch e.Type {
+	case EventPostBook:
+		c.unstage(false)
+	case EventPostRun:
+		c.unstage(true)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package kindledl
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// StatusPending is the status in the StateDB of a book which has been
+// seen in the library but not done yet
+const StatusPending = "pending"
+
+// BookState is the record of one book in a StateDB
+type BookState struct {
+	Marketplace string    // host of the marketplace, empty if only one
+	Content     string    // content type, empty if not set
+	ASIN        string    // identifies the book within the marketplace
+	Title       string    // title of the book, if known
+	Number      int       // position of the book in the library when last seen, 1 based
+	Status      string    // StatusPending, StatusDownloaded, StatusFailed or StatusSkipped
+	Error       string    // the error if the book failed
+	Attempts    int       // number of times the download has been tried
+	FirstSeen   time.Time // when the book was first recorded
+	Updated     time.Time // when the status last changed
+}
+
+// Returns the key of the book in the state
+func (s *BookState) key() string {
+	return s.Marketplace + "\x00" + s.Content + "\x00" + s.ASIN
+}
+
+// StateDB records the status of each book in the library so a run can
+// carry on with exactly the books which aren't done yet, rather than
+// from a position in the library which moves as books are bought and
+// returned.
+type StateDB interface {
+	// Load returns the state of every book recorded
+	Load() ([]BookState, error)
+	// Save inserts or replaces the state of the book
+	Save(s BookState) error
+	// Close the database
+	Close() error
+}
+
+// StateDBOpener opens the StateDB at path, eg a SQLite database
+type StateDBOpener func(path string) (StateDB, error)
+
+// Open the Options.StateDB if set and read the state of the books
+func (c *Client) openStateDB() error {
+	if c.opt.StateDB == "" {
+		return nil
+	}
+	if c.opt.StateDBOpener == nil {
+		return fmt.Errorf("can't open state database %q as no StateDBOpener is set", c.opt.StateDB)
+	}
+	db, err := c.opt.StateDBOpener(c.opt.StateDB)
+	if err != nil {
+		return fmt.Errorf("failed to open state database %q: %w", c.opt.StateDB, err)
+	}
+	states, err := db.Load()
+	if err != nil {
+		_ = db.Close()
+		return fmt.Errorf("failed to read state database %q: %w", c.opt.StateDB, err)
+	}
+	c.stateDB = db
+	c.states = make(map[string]*BookState, len(states))
+	counts := map[string]int{}
+	for i := range states {
+		s := &states[i]
+		c.states[s.key()] = s
+		counts[s.Status]++
+	}
+	slog.Info("Read state database", "path", c.opt.StateDB, "books", len(states),
+		"downloaded", counts[StatusDownloaded],
+		"skipped", counts[StatusSkipped],
+		"failed", counts[StatusFailed],
+		"pending", counts[StatusPending],
+	)
+	return nil
+}
+
+// Close the state database if open
+func (c *Client) closeStateDB() {
+	if c.stateDB == nil {
+		return
+	}
+	err := c.stateDB.Close()
+	if err != nil {
+		slog.Error("Failed to close state database", "err", err)
+	}
+	c.stateDB = nil
+}
+
+// Returns the state of the book, or nil if it isn't recorded
+func (c *Client) bookState(b *Book) *BookState {
+	if c.stateDB == nil || b.ASIN == "" {
+		return nil
+	}
+	s := BookState{Marketplace: b.Marketplace, Content: b.Content, ASIN: b.ASIN}
+	return c.states[s.key()]
+}
+
+// Returns whether the state database says the book has been done, ie
+// downloaded or skipped, so it needn't be done again
+func (c *Client) stateDone(b *Book) bool {
+	s := c.bookState(b)
+	return s != nil && (s.Status == StatusDownloaded || s.Status == StatusSkipped)
+}
+
+// Record the status of a book in the state database, if open
+//
+// Books without an ASIN can't be recorded as they can't be recognised
+// again.
+func (c *Client) recordState(b *Book, number int, status string, bookErr error) error {
+	if c.stateDB == nil || b.ASIN == "" {
+		return nil
+	}
+	now := time.Now()
+	s := c.bookState(b)
+	if s == nil {
+		s = &BookState{
+			Marketplace: b.Marketplace,
+			Content:     b.Content,
+			ASIN:        b.ASIN,
+			FirstSeen:   now,
+		}
+	} else if status == StatusPending && s.Status != StatusPending {
+		// Seeing a book again doesn't change its outcome
+		return nil
+	}
+	updated := *s
+	if b.Title != "" {
+		updated.Title = b.Title
+	}
+	updated.Number = number
+	updated.Status = status
+	updated.Error = ""
+	if bookErr != nil {
+		updated.Error = bookErr.Error()
+	}
+	if status == StatusDownloaded || status == StatusFailed {
+		updated.Attempts++
+	}
+	updated.Updated = now
+	err := c.stateDB.Save(updated)
+	if err != nil {
+		return fmt.Errorf("failed to record book in state database: %w", err)
+	}
+	c.states[updated.key()] = &updated
+	return nil
+}
+
+// Record the books on the current page which aren't in the state
+// database yet as pending
+func (c *Client) recordPending(subLog *slog.Logger, rows []pageRow) {
+	if c.stateDB == nil {
+		return
+	}
+	pageStart := (c.pageNumber - 1) * c.opt.BooksPerPage
+	for n, row := range rows {
+		meta := c.pageBook(n, row.asin)
+		if c.bookState(&meta) != nil {
+			continue
+		}
+		err := c.recordState(&meta, pageStart+n+1, StatusPending, nil)
+		if err != nil {
+			subLog.Error("Failed to record pending book", "asin", meta.ASIN, "err", err)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package kindledl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// BookSize is the size of a downloaded book
+type BookSize struct {
+	Title string
+	File  string // relative to the output directory
+	Size  int64
+}
+
+// Stats summarises the progress of the archive from the manifest and
+// the run history
+type Stats struct {
+	Books      int            // books in the manifest
+	Counts     map[string]int // books in the manifest with each status
+	Runs       int            // runs in the history
+	RunTime    time.Duration  // time spent in the runs
+	Processed  int            // books processed by the runs
+	Failed     int            // books which failed in the runs
+	TotalBooks int            // books in the library at the last run, 0 if unknown
+	Bytes      int64          // size of the downloaded files
+	Biggest    []BookSize     // the biggest books, biggest first
+}
+
+// ReadRuns reads the history of the runs from RunsFile in the config
+// directory, oldest first
+func ReadRuns(opt *Options) (runs []RunRecord, err error) {
+	dir, err := ConfigRoot(opt)
+	if err != nil {
+		return nil, err
+	}
+	in, err := os.Open(filepath.Join(dir, RunsFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open run history: %w", err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var r RunRecord
+		err = json.Unmarshal([]byte(line), &r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode run history: %w", err)
+		}
+		runs = append(runs, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read run history: %w", err)
+	}
+	return runs, nil
+}
+
+// ReadStats works out the Stats from the manifest, the run history and
+// the files in the output directory, keeping the biggest books.
+func ReadStats(opt *Options, biggest int) (*Stats, error) {
+	m, err := opt.ReadManifest()
+	if err != nil {
+		return nil, err
+	}
+	runs, err := ReadRuns(opt)
+	if err != nil {
+		return nil, err
+	}
+	s := &Stats{
+		Counts: map[string]int{},
+	}
+	for _, e := range m.Snapshot() {
+		s.Books++
+		s.Counts[e.Status]++
+		if e.File == "" {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(opt.Output, filepath.FromSlash(e.File)))
+		if err != nil {
+			continue
+		}
+		s.Bytes += info.Size()
+		s.Biggest = append(s.Biggest, BookSize{Title: e.Title, File: e.File, Size: info.Size()})
+	}
+	sort.SliceStable(s.Biggest, func(i, j int) bool {
+		return s.Biggest[i].Size > s.Biggest[j].Size
+	})
+	if len(s.Biggest) > biggest {
+		s.Biggest = s.Biggest[:biggest]
+	}
+	for _, r := range runs {
+		s.Runs++
+		s.RunTime += r.End.Sub(r.Start)
+		for _, n := range r.Counts {
+			s.Processed += n
+		}
+		s.Failed += r.Counts[StatusFailed]
+		if r.TotalBooks > 0 {
+			s.TotalBooks = r.TotalBooks
+		}
+	}
+	return s, nil
+}
+
+// FailureRate returns the fraction of the books processed by the runs
+// which failed
+func (s *Stats) FailureRate() float64 {
+	if s.Processed == 0 {
+		return 0
+	}
+	return float64(s.Failed) / float64(s.Processed)
+}
+
+// BooksPerHour returns how many books the runs processed per hour
+func (s *Stats) BooksPerHour() float64 {
+	if s.RunTime <= 0 {
+		return 0
+	}
+	return float64(s.Processed) / s.RunTime.Hours()
+}
+
+// Remaining returns the number of books in the library not done yet,
+// or -1 if the size of the library isn't known
+func (s *Stats) Remaining() int {
+	if s.TotalBooks <= 0 {
+		return -1
+	}
+	done := s.Counts[StatusDownloaded] + s.Counts[StatusSkipped] + s.Counts[StatusQueued]
+	return max(s.TotalBooks-done, 0)
+}
+
+// ETA returns how long the remaining books should take at the rate so
+// far, or 0 if not known
+func (s *Stats) ETA() time.Duration {
+	remaining, rate := s.Remaining(), s.BooksPerHour()
+	if remaining < 0 || rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(remaining) / rate * float64(time.Hour))
+}
+
+// Print writes the stats to w in a human readable form
+func (s *Stats) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Books in manifest:\t%d\n", s.Books)
+	statuses := make([]string, 0, len(s.Counts))
+	for status := range s.Counts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(tw, "  %s:\t%d\n", status, s.Counts[status])
+	}
+	fmt.Fprintf(tw, "Downloaded size:\t%s\n", formatSize(s.Bytes))
+	fmt.Fprintf(tw, "Runs:\t%d taking %v\n", s.Runs, s.RunTime.Round(time.Minute))
+	fmt.Fprintf(tw, "Books per hour:\t%.1f\n", s.BooksPerHour())
+	fmt.Fprintf(tw, "Failure rate:\t%.1f%%\n", 100*s.FailureRate())
+	if remaining := s.Remaining(); remaining >= 0 {
+		fmt.Fprintf(tw, "Books in library:\t%d\n", s.TotalBooks)
+		fmt.Fprintf(tw, "Remaining:\t%d", remaining)
+		if eta := s.ETA(); eta > 0 {
+			fmt.Fprintf(tw, " (about %v)", eta.Round(time.Minute))
+		}
+		fmt.Fprintln(tw)
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+	if len(s.Biggest) == 0 {
+		return nil
+	}
+	_, err = fmt.Fprintln(w, "Biggest books:")
+	for _, b := range s.Biggest {
+		if err == nil {
+			_, err = fmt.Fprintf(w, "  %10s  %s\n", formatSize(b.Size), b.Title)
+		}
+	}
+	return err
+}
+
+// Format size in bytes for people to read, eg 1.5 MiB
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
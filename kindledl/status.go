@@ -0,0 +1,88 @@
+package kindledl
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// States of the run
+const (
+	StateRunning  = "running"
+	StateBlocked  = "blocked"
+	StateFinished = "finished"
+	StateFailed   = "failed"
+)
+
+// State returns the state of the run after the event, or "" if the
+// event doesn't change it.
+func (e *Event) State() string {
+	switch e.Type {
+	case EventPreRun, EventPreBook:
+		return StateRunning
+	case EventAttention:
+		return StateBlocked
+	case EventPostRun:
+		if e.Err != nil {
+			return StateFailed
+		}
+		return StateFinished
+	}
+	return ""
+}
+
+// runStatus is written to the status file
+type runStatus struct {
+	State     string         `json:"state"`
+	Page      int            `json:"page"`
+	Book      int            `json:"book"`
+	ASIN      string         `json:"asin,omitempty"`
+	Title     string         `json:"title,omitempty"`
+	Counts    map[string]int `json:"counts"`
+	LastError string         `json:"last_error,omitempty"`
+	Started   time.Time      `json:"started"`
+	Updated   time.Time      `json:"updated"`
+}
+
+// Update the status file after each event
+func (c *Client) statusHook(e Event) error {
+	s := &c.status
+	// The post-processing workers may finish a book after the run has
+	// moved on to the next one
+	if e.Type == EventPostBook && e.Number < s.Book {
+		return nil
+	}
+	if e.Type == EventPreRun {
+		*s = runStatus{Started: e.Time}
+	}
+	if state := e.State(); state != "" {
+		s.State = state
+	}
+	s.Page = e.Page
+	s.Book = e.Number
+	if e.Book != nil {
+		s.ASIN = e.Book.ASIN
+		s.Title = e.Book.Title
+	}
+	s.Counts = e.Counts
+	if e.Err != nil {
+		s.LastError = e.Err.Error()
+	}
+	s.Updated = e.Time
+	err := c.writeStatus()
+	if err != nil {
+		slog.Error("Failed to write status file", "err", err)
+	}
+	return nil
+}
+
+// Write the status file
+func (c *Client) writeStatus() error {
+	data, err := json.MarshalIndent(&c.status, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode status: %w", err)
+	}
+	data = append(data, '\n')
+	return writeFileAtomic(c.opt.StatusFile, data, 0644)
+}
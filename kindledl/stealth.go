@@ -0,0 +1,103 @@
+package kindledl
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// This runs in every page before the page's own scripts to hide the
+// most obvious signs that the browser is automated.
+//
+// The canvas and WebGL are left alone, as adding noise to them makes
+// the fingerprint change from run to run which looks more suspicious
+// than a consistent one.
+const stealthJS = `(() => {
+	// navigator.webdriver is true in automated browsers
+	Object.defineProperty(Navigator.prototype, "webdriver", {
+		get: () => undefined,
+		configurable: true,
+	});
+	// Headless Chrome doesn't have window.chrome
+	if (!window.chrome) {
+		window.chrome = {
+			runtime: {},
+			app: { isInstalled: false },
+			csi: () => ({}),
+			loadTimes: () => ({}),
+		};
+	}
+	// Headless Chrome has no plugins
+	if (navigator.plugins.length === 0) {
+		const plugins = ["PDF Viewer", "Chrome PDF Viewer", "Chromium PDF Viewer"].map((name) => ({
+			name: name,
+			filename: "internal-pdf-viewer",
+			description: "Portable Document Format",
+		}));
+		Object.defineProperty(Navigator.prototype, "plugins", {
+			get: () => plugins,
+			configurable: true,
+		});
+	}
+	// Headless Chrome denies notifications without asking
+	const permissions = navigator.permissions;
+	if (permissions && permissions.query) {
+		const query = permissions.query.bind(permissions);
+		permissions.query = (p) => p && p.name === "notifications"
+			? Promise.resolve({ state: Notification.permission })
+			: query(p);
+	}
+})();`
+
+// Finds the Chrome version in a user agent
+var reChromeVersion = regexp.MustCompile(`Chrome/(\d+)([\d.]*)`)
+
+// Make user agent client hints which match the user agent so the
+// Sec-CH-UA headers and navigator.userAgentData agree with it,
+// returning nil if it isn't a Chrome user agent.
+func clientHints(userAgent string) *proto.EmulationUserAgentMetadata {
+	match := reChromeVersion.FindStringSubmatch(userAgent)
+	if match == nil {
+		return nil
+	}
+	major, full := match[1], match[1]+match[2]
+	platform := "Linux"
+	switch runtime.GOOS {
+	case "windows":
+		platform = "Windows"
+	case "darwin":
+		platform = "macOS"
+	}
+	architecture := "x86"
+	if strings.HasPrefix(runtime.GOARCH, "arm") {
+		architecture = "arm"
+	}
+	brands := func(version string) []*proto.EmulationUserAgentBrandVersion {
+		return []*proto.EmulationUserAgentBrandVersion{
+			{Brand: "Not)A;Brand", Version: "99"},
+			{Brand: "Google Chrome", Version: version},
+			{Brand: "Chromium", Version: version},
+		}
+	}
+	return &proto.EmulationUserAgentMetadata{
+		Brands:          brands(major),
+		FullVersionList: brands(full),
+		FullVersion:     full,
+		Platform:        platform,
+		Architecture:    architecture,
+		Bitness:         "64",
+	}
+}
+
+// Hide the signs of automation in the page
+func (c *Client) setStealth(page *rod.Page) error {
+	_, err := page.EvalOnNewDocument(stealthJS)
+	if err != nil {
+		return fmt.Errorf("failed to add stealth script: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package kindledl
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Store holds one piece of state, eg the checkpoint or the manifest
+//
+// Load returns an error wrapping fs.ErrNotExist if nothing has been
+// saved yet.
+type Store interface {
+	Load() ([]byte, error)
+	Save(data []byte) error
+}
+
+// BackupStore is a Store which keeps the previous generation of the
+// state to fall back on if the current one is lost or corrupt
+type BackupStore interface {
+	Store
+	LoadBackup() ([]byte, error)
+}
+
+// StoreOpener opens the Store for a location given as a URL, eg
+// sqlite:///var/lib/kindledl/state.db#checkpoint
+type StoreOpener func(location string) (Store, error)
+
+// fileStore keeps the state in a local file
+//
+// The previous generation is kept in the file with backupSuffix so a
+// file corrupted by a power cut can be recovered.
+type fileStore struct {
+	path string
+	perm os.FileMode
+}
+
+// Suffix for the previous generation of a fileStore
+const backupSuffix = ".bak"
+
+// Load reads the file
+func (s fileStore) Load() ([]byte, error) {
+	return os.ReadFile(s.path)
+}
+
+// LoadBackup reads the previous generation of the file
+func (s fileStore) LoadBackup() ([]byte, error) {
+	return os.ReadFile(s.path + backupSuffix)
+}
+
+// Save writes the file durably, keeping the old one as the backup
+func (s fileStore) Save(data []byte) error {
+	return writeFileDurable(s.path, s.path+backupSuffix, data, s.perm)
+}
+
+// Load the state from s and decode it, falling back to the backup if s
+// is a BackupStore and the state is missing or won't decode.
+//
+// Returns an error wrapping fs.ErrNotExist if there is no state.
+func loadState(s Store, what string, decode func(data []byte) error) error {
+	data, err := s.Load()
+	if err == nil {
+		err = decode(data)
+		if err == nil {
+			return nil
+		}
+	}
+	backup, ok := s.(BackupStore)
+	if !ok {
+		return err
+	}
+	backupData, backupErr := backup.LoadBackup()
+	if backupErr != nil {
+		if errors.Is(backupErr, fs.ErrNotExist) {
+			return err
+		}
+		return fmt.Errorf("%w (and failed to read backup: %v)", err, backupErr)
+	}
+	backupErr = decode(backupData)
+	if backupErr != nil {
+		return fmt.Errorf("%w (and backup is corrupt too: %v)", err, backupErr)
+	}
+	slog.Warn("Using backup as "+what+" is missing or corrupt", "err", err)
+	return nil
+}
+
+// Returns whether location is a URL for a Store rather than a file
+// path
+func isStoreURL(location string) bool {
+	scheme, _, found := strings.Cut(location, "://")
+	// Leave room for Windows drive letters
+	return found && len(scheme) > 1 && !strings.ContainsAny(scheme, `/\`)
+}
+
+// Open the Store for location which is either a file path, written
+// with perm, or a URL opened with Options.StoreOpener
+func (opt *Options) openStore(location string, perm os.FileMode) (Store, error) {
+	if !isStoreURL(location) {
+		return fileStore{path: location, perm: perm}, nil
+	}
+	if opt.StoreOpener == nil {
+		return nil, fmt.Errorf("can't open %q as no StoreOpener is set", location)
+	}
+	s, err := opt.StoreOpener(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store %q: %w", location, err)
+	}
+	return s, nil
+}
+
+// ReadManifest reads the manifest from Options.Manifest, which may be
+// a file or a URL for the Options.StoreOpener
+func (opt *Options) ReadManifest() (*Manifest, error) {
+	s, err := opt.openStore(opt.Manifest, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return LoadManifestFrom(s)
+}
+
+// WithSuffix returns the checkpoint or manifest location with
+// "-"+suffix added to the name before its extension.
+//
+// For a URL with a fragment, eg a key in a SQLite database, the suffix
+// is added to the fragment instead.
+func WithSuffix(location, suffix string) string {
+	if isStoreURL(location) {
+		u, err := url.Parse(location)
+		if err == nil && u.Fragment != "" {
+			u.Fragment += "-" + suffix
+			return u.String()
+		}
+		if err == nil {
+			ext := path.Ext(u.Path)
+			u.Path = strings.TrimSuffix(u.Path, ext) + "-" + suffix + ext
+			return u.String()
+		}
+	}
+	ext := filepath.Ext(location)
+	return strings.TrimSuffix(location, ext) + "-" + suffix + ext
+}
@@ -0,0 +1,58 @@
+package kindledl
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// ListSubscriptions returns an iterator over the active newspaper and
+// magazine subscriptions. Book.Renews says when each renews.
+func (c *Client) ListSubscriptions(ctx context.Context) *BookIter {
+	it := c.ListBooks(ctx)
+	it.filter = subscriptionItems
+	return it
+}
+
+// Record the subscriptions at the end of the run
+func (c *Client) subscriptionsHook(e Event) error {
+	if e.Type != EventPostRun {
+		return nil
+	}
+	err := c.RecordSubscriptions(context.Background())
+	if err != nil {
+		slog.Error("Failed to record subscriptions", "err", err)
+	}
+	return nil
+}
+
+// RecordSubscriptions lists the active newspaper and magazine
+// subscriptions in each marketplace and records them in the manifest
+// as StatusSubscription so it covers the whole account.
+//
+// Only the subscriptions are recorded, not the issues.
+func (c *Client) RecordSubscriptions(ctx context.Context) error {
+	defer func(i int) {
+		_ = c.useMarketplace(i)
+	}(c.marketplaceIndex)
+	var subs []Book
+	for i := 0; i < c.numMarketplaces(); i++ {
+		err := c.useMarketplace(i)
+		if err != nil {
+			return err
+		}
+		it := c.ListSubscriptions(ctx)
+		for it.Next() {
+			subs = append(subs, it.Book())
+		}
+		if err := it.Err(); err != nil {
+			return fmt.Errorf("failed to list subscriptions: %w", err)
+		}
+	}
+	added, err := c.manifest.recordInventory(subs, StatusSubscription)
+	if err != nil {
+		return err
+	}
+	slog.Info("Recorded subscriptions", "found", len(subs), "added", added)
+	return nil
+}
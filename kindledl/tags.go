@@ -0,0 +1,63 @@
+package kindledl
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ReadTags reads a CSV file of ASINs and tags for Options.Tags
+//
+// The first column of each row is the ASIN and the other columns are
+// tags, each of which may hold several tags separated by ";". A
+// header row starting with "asin" is ignored, eg
+//
+//	asin,tags,shelf
+//	B00ABC1234,sci-fi;favourites,Shelf 3
+func ReadTags(path string) (map[string][]string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tags file: %w", err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	tags := map[string][]string{}
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read tags file: %w", err)
+		}
+		asin := strings.ToUpper(strings.TrimSpace(record[0]))
+		if asin == "" || (line == 1 && asin == "ASIN") {
+			continue
+		}
+		for _, field := range record[1:] {
+			for _, tag := range strings.Split(field, ";") {
+				tag = strings.TrimSpace(tag)
+				if tag != "" && !hasTag(tags[asin], tag) {
+					tags[asin] = append(tags[asin], tag)
+				}
+			}
+		}
+	}
+	return tags, nil
+}
+
+// Returns whether tag is in tags
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
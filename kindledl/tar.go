@@ -0,0 +1,115 @@
+package kindledl
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// Write the books downloaded this run which aren't in the tar yet to
+// Options.Tar as each book finishes, each followed by its manifest
+// entry.
+//
+// This needs to go after formatHook which finds the files of the
+// books.
+func (c *Client) tarHook(e Event) error {
+	if e.Type != EventPostBook && e.Type != EventPostRun {
+		return nil
+	}
+	for _, entry := range c.manifest.Snapshot() {
+		if entry.File == "" || entry.Time.Before(c.runStart) || c.tarred[entry.File] {
+			continue
+		}
+		err := c.tarBook(&entry)
+		if err != nil {
+			slog.Error("Failed to write book to tar", "file", entry.File, "err", err)
+			continue
+		}
+		c.tarred[entry.File] = true
+	}
+	return nil
+}
+
+// Write the file of the book in e to the tar followed by e as JSON
+// in a file with .json on the end
+//
+// If Options.TarRemove is set the file is removed afterwards.
+func (c *Client) tarBook(e *ManifestEntry) error {
+	path := filepath.Join(c.downloadDir, filepath.FromSlash(e.File))
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	err = c.tar.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     e.File,
+		Size:     info.Size(),
+		Mode:     0644,
+		ModTime:  info.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(c.tar, in)
+	if err != nil {
+		return err
+	}
+
+	// The curl command has the session cookies in so leave it out
+	meta := *e
+	meta.Curl = ""
+	data, err := json.MarshalIndent(meta, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = c.tar.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     e.File + ".json",
+		Size:     int64(len(data)),
+		Mode:     0644,
+		ModTime:  e.Time,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.tar.Write(data)
+	if err != nil {
+		return err
+	}
+	err = c.tar.Flush()
+	if err != nil {
+		return err
+	}
+	slog.Info("Wrote book to tar", "file", e.File, "size", info.Size())
+
+	if c.opt.TarRemove {
+		err = os.Remove(path)
+		if err != nil {
+			return fmt.Errorf("failed to remove book written to tar: %w", err)
+		}
+	}
+	return nil
+}
+
+// Finish off the tar if in use
+func (c *Client) closeTar() {
+	if c.tar == nil {
+		return
+	}
+	err := c.tar.Close()
+	if err != nil {
+		slog.Error("Failed to finish tar", "err", err)
+	}
+	c.tar = nil
+}
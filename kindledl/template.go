@@ -0,0 +1,100 @@
+package kindledl
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Matches a field in Options.FilenameTemplate, eg {title}
+var reTemplateField = regexp.MustCompile(`\{(\w*)\}`)
+
+// Returns the values of the fields which can be used in
+// Options.FilenameTemplate for the book in e downloaded as a file with
+// extension ext, eg ".azw3", in format
+func templateValues(e *ManifestEntry, ext, format string) map[string]string {
+	series, number := seriesFromTitle(e.Title)
+	return map[string]string{
+		"title":    e.Title,
+		"bare":     bareTitle(e.Title),
+		"author":   e.Authors,
+		"asin":     e.ASIN,
+		"ext":      strings.TrimPrefix(ext, "."),
+		"format":   format,
+		"series":   series,
+		"number":   number,
+		"acquired": e.Acquired,
+		"content":  e.Content,
+	}
+}
+
+// Expand the fields in template with values, making each value safe to
+// use in a file name
+func expandTemplate(template string, values map[string]string) (string, error) {
+	if strings.ContainsAny(reTemplateField.ReplaceAllString(template, ""), "{}") {
+		return "", fmt.Errorf("unmatched { or } in filename template %q", template)
+	}
+	var err error
+	expanded := reTemplateField.ReplaceAllStringFunc(template, func(field string) string {
+		value, ok := values[field[1:len(field)-1]]
+		if !ok && err == nil {
+			names := make([]string, 0, len(values))
+			for name := range values {
+				names = append(names, "{"+name+"}")
+			}
+			sort.Strings(names)
+			err = fmt.Errorf("unknown field %s in filename template %q - use %s", field, template, strings.Join(names, ", "))
+		}
+		return safeName(value, "")
+	})
+	return expanded, err
+}
+
+// Check the filename template in the options can be used
+func (opt *Options) checkFilenameTemplate() error {
+	if opt.FilenameTemplate == "" {
+		return nil
+	}
+	if opt.OrganizePreset != "" {
+		return fmt.Errorf("can't use a filename template with the %s layout", opt.OrganizePreset)
+	}
+	_, err := expandTemplate(opt.FilenameTemplate, templateValues(&ManifestEntry{}, "", ""))
+	return err
+}
+
+// Return the file name the book in e should have from
+// Options.FilenameTemplate, / separated and relative to its content
+// directory
+//
+// The extension of name is added if the template doesn't have {ext}.
+// Any directories in the template are kept, except those which come
+// out empty, eg {series} for a book not in a series.
+func (c *Client) templatedName(e *ManifestEntry, name, format string) string {
+	ext := path.Ext(name)
+	expanded, err := expandTemplate(c.opt.FilenameTemplate, templateValues(e, ext, format))
+	if err != nil {
+		// checked in newClient so shouldn't happen
+		return path.Base(name)
+	}
+	if !strings.Contains(c.opt.FilenameTemplate, "{ext}") {
+		expanded += ext
+	}
+	unknown := strings.TrimSuffix(path.Base(name), ext)
+	parts := strings.Split(expanded, "/")
+	file := parts[len(parts)-1]
+	if ext != "" && strings.HasSuffix(file, ext) {
+		// Keep the dot of the extension which safeName would trim
+		file = safeName(strings.TrimSuffix(file, ext), unknown) + ext
+	} else {
+		file = safeName(file, unknown)
+	}
+	var dirs []string
+	for _, dir := range parts[:len(parts)-1] {
+		if dir = safeName(dir, ""); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return path.Join(append(dirs, file)...)
+}
@@ -0,0 +1,76 @@
+package kindledl
+
+import (
+	"log/slog"
+	"time"
+)
+
+// stepTiming is the accumulated time for one step
+type stepTiming struct {
+	count int
+	total time.Duration
+	min   time.Duration
+	max   time.Duration
+}
+
+// stepTimings accumulates how long each step of downloading a book takes
+type stepTimings struct {
+	names []string // step names in the order first seen
+	steps map[string]*stepTiming
+}
+
+// Add a timing for the named step
+func (t *stepTimings) add(name string, d time.Duration) {
+	if t.steps == nil {
+		t.steps = map[string]*stepTiming{}
+	}
+	s, ok := t.steps[name]
+	if !ok {
+		s = &stepTiming{min: d, max: d}
+		t.steps[name] = s
+		t.names = append(t.names, name)
+	}
+	s.count++
+	s.total += d
+	s.min = min(s.min, d)
+	s.max = max(s.max, d)
+}
+
+// Log a summary of the step timings
+func (t *stepTimings) log() {
+	for _, name := range t.names {
+		s := t.steps[name]
+		slog.Info("Step timing",
+			"step", name,
+			"count", s.count,
+			"avg", (s.total / time.Duration(s.count)).Round(time.Millisecond),
+			"min", s.min.Round(time.Millisecond),
+			"max", s.max.Round(time.Millisecond),
+			"total", s.total.Round(time.Second),
+		)
+	}
+}
+
+// bookTimer times the steps of downloading a single book
+type bookTimer struct {
+	t     *stepTimings
+	last  time.Time
+	attrs []any // the timings of this book for logging
+}
+
+// Start timing the steps of a book
+func (t *stepTimings) newBook() *bookTimer {
+	return &bookTimer{
+		t:    t,
+		last: time.Now(),
+	}
+}
+
+// Mark the end of the named step
+func (b *bookTimer) step(name string) {
+	now := time.Now()
+	d := now.Sub(b.last)
+	b.last = now
+	b.t.add(name, d)
+	b.attrs = append(b.attrs, name, d.Round(time.Millisecond))
+}
@@ -0,0 +1,96 @@
+package kindledl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Uploader copies the downloaded books to remote storage
+//
+// Set Options.Uploaders to upload each book as it completes. The
+// upload package has implementations.
+type Uploader interface {
+	// Name describes the remote for the logs
+	Name() string
+	// Exists returns whether name already exists on the remote with this size
+	Exists(ctx context.Context, name string, size int64) (bool, error)
+	// Upload uploads size bytes from in to name on the remote
+	Upload(ctx context.Context, name string, in io.Reader, size int64) error
+}
+
+// Upload any completed files when each book finishes and at the end
+// of the run
+func (c *Client) uploadHook(e Event) error {
+	switch e.Type {
+	case EventPostBook:
+		c.uploadCompleted(context.Background(), false)
+	case EventPostRun:
+		c.uploadCompleted(context.Background(), true)
+	}
+	return nil
+}
+
+// Upload the completed files in the download directory which haven't
+// been uploaded yet.
+//
+// If wait is set then wait for files being downloaded to complete
+// first.
+//
+// Failures are logged and retried next time this is called.
+func (c *Client) uploadCompleted(ctx context.Context, wait bool) {
+	files, partial, err := c.waitCompletedFiles(wait)
+	if err != nil {
+		slog.Error("Failed to find files to upload", "err", err)
+		return
+	}
+	if partial && wait {
+		slog.Warn("Some files didn't finish downloading so weren't uploaded")
+	}
+	for _, f := range files {
+		if done, ok := c.uploaded[f.name]; ok && done.size == f.size && done.modTime.Equal(f.modTime) {
+			continue
+		}
+		ok := true
+		for _, u := range c.opt.Uploaders {
+			err := c.uploadFile(ctx, u, f)
+			if err != nil {
+				slog.Error("Failed to upload", "remote", u.Name(), "file", f.name, "err", err)
+				ok = false
+			}
+		}
+		if ok {
+			c.uploaded[f.name] = f
+		}
+	}
+}
+
+// Upload a single file to u if it isn't there already
+func (c *Client) uploadFile(ctx context.Context, u Uploader, f completedFile) error {
+	exists, err := u.Exists(ctx, f.name, f.size)
+	if err != nil {
+		return err
+	}
+	if exists {
+		slog.Debug("Already uploaded", "remote", u.Name(), "file", f.name)
+		return nil
+	}
+	in, err := os.Open(filepath.Join(c.downloadDir, filepath.FromSlash(f.name)))
+	if err != nil {
+		return fmt.Errorf("failed to open file to upload: %w", err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	start := time.Now()
+	err = u.Upload(ctx, f.name, in, f.size)
+	if err != nil {
+		return err
+	}
+	slog.Info("Uploaded", "remote", u.Name(), "file", f.name, "size", f.size, "duration", time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,158 @@
+package kindledl
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Subdirectories of Options.Views for each view
+const (
+	viewByAuthor = "by-author"
+	viewBySeries = "by-series"
+)
+
+// Finds the series in a title, eg "Guards! Guards! (Discworld Book 8)"
+// or "Leviathan Wakes (The Expanse, Book 1)"
+var reSeries = regexp.MustCompile(`\(([^()]+?),?\s+(?:Book|Volume|Vol\.|Part|#)\s*(\d+(?:\.\d+)?)\)\s*$`)
+
+// Return the series of the book and its number in the series from the
+// title, or "" if the title doesn't say
+//
+// The number is padded to 2 digits so the books sort in order.
+func seriesFromTitle(title string) (series, number string) {
+	match := reSeries.FindStringSubmatch(title)
+	if match == nil {
+		return "", ""
+	}
+	number = match[2]
+	if i := strings.IndexByte(number, '.'); i == 1 || (i < 0 && len(number) == 1) {
+		number = "0" + number
+	}
+	return strings.TrimSpace(match[1]), number
+}
+
+// Make name safe to use as a file name on all platforms, or return
+// unknown if there is nothing left
+func safeName(name, unknown string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	runes := []rune(name)
+	if len(runes) > 100 {
+		name = string(runes[:100])
+	}
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return unknown
+	}
+	return name
+}
+
+// WriteViews makes trees of symlinks in dir to the downloaded files of
+// the books in the manifest, one organised by author and one by
+// series, so the books can be browsed different ways without copying
+// them.
+//
+// The trees are made from scratch each time.
+func (c *Client) WriteViews(dir string) error {
+	for _, view := range []string{viewByAuthor, viewBySeries} {
+		err := removeLinkTree(filepath.Join(dir, view))
+		if err != nil {
+			return err
+		}
+	}
+	links := 0
+	for _, e := range c.manifest.Snapshot() {
+		if e.File == "" {
+			continue
+		}
+		target := filepath.Join(c.downloadDir, filepath.FromSlash(e.File))
+		if _, err := os.Stat(target); err != nil {
+			continue
+		}
+		base := filepath.Base(target)
+		author := safeName(e.Authors, "Unknown Author")
+		err := makeLink(target, filepath.Join(dir, viewByAuthor, author, base))
+		if err != nil {
+			return err
+		}
+		links++
+		series, number := seriesFromTitle(e.Title)
+		if series == "" {
+			continue
+		}
+		err = makeLink(target, filepath.Join(dir, viewBySeries, safeName(series, "Unknown Series"), number+" - "+base))
+		if err != nil {
+			return err
+		}
+		links++
+	}
+	slog.Debug("Made views", "dir", dir, "links", links)
+	return nil
+}
+
+// Remove a tree made by WriteViews, checking it only has directories
+// and symlinks in first so nothing else is lost.
+func removeLinkTree(root string) error {
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && d.Type()&fs.ModeSymlink == 0 {
+			return fmt.Errorf("not removing view %q as it has files in which %s didn't make, eg %q", root, Program, path)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return os.RemoveAll(root)
+}
+
+// Make a relative symlink at link pointing to target, making the
+// directories needed
+func makeLink(target, link string) error {
+	err := os.MkdirAll(filepath.Dir(link), 0777)
+	if err != nil {
+		return fmt.Errorf("failed to make view directory: %w", err)
+	}
+	rel, err := filepath.Rel(filepath.Dir(link), target)
+	if err != nil {
+		return err
+	}
+	link, err = uniquePath(link)
+	if err != nil {
+		return err
+	}
+	err = os.Symlink(rel, link)
+	if err != nil {
+		return fmt.Errorf("failed to make link in view: %w", err)
+	}
+	return nil
+}
+
+// Make the views at the end of the run
+func (c *Client) viewsHook(e Event) error {
+	if e.Type != EventPostRun {
+		return nil
+	}
+	err := c.WriteViews(c.opt.Views)
+	if err != nil {
+		slog.Error("Failed to make views", "err", err)
+	} else {
+		slog.Info("Made views", "dir", c.opt.Views)
+	}
+	return nil
+}
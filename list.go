@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/ncw/kindledl/kindledl"
+)
+
+// Format for the list command
+var listFormat = flag.String("list-format", kindledl.ListCSV, "Format for the list command to write the library in: csv or json")
+
+func init() {
+	commands["list"] = command{
+		help: "write every book in the library to stdout as CSV or JSON without downloading anything",
+		run:  runList,
+	}
+}
+
+// List the library to stdout
+func runList() error {
+	return kindledl.ListLibrary(context.Background(), opt, os.Stdout, *listFormat)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/ncw/kindledl/kindledl"
+)
+
+// Flags for locales
+var (
+	locale      = flag.String("locale", "", "Set the -msg-* flags for the language of the Amazon pages from this locale, eg de - see -list-locales (default "+kindledl.DefaultLocale+")")
+	listLocales = flag.Bool("list-locales", false, "set to list the locales which can be used with -locale and where they come from then exit")
+)
+
+// Set the -msg-* flags from the -locale
+//
+// Flags set explicitly on the command line take precedence.
+func applyLocale() error {
+	if *locale == "" {
+		return nil
+	}
+	l, err := kindledl.LoadLocale(opt, *locale)
+	if err != nil {
+		return err
+	}
+	for name, value := range l.Messages {
+		name = "msg-" + name
+		if isFlagSet(name) {
+			continue
+		}
+		err := flag.Set(name, value)
+		if err != nil {
+			return fmt.Errorf("failed to apply -locale %q: %w", *locale, err)
+		}
+	}
+	slog.Debug("Applied locale", "locale", l.Name, "sources", l.Sources)
+	return nil
+}
+
+// Print the locales which can be used with -locale
+func printLocales() error {
+	locales, err := kindledl.ListLocales(opt)
+	if err != nil {
+		return err
+	}
+	for _, l := range locales {
+		fmt.Fprintf(os.Stdout, "%-8s %s (%s)\n", l.Name, l.Description, strings.Join(l.Sources, ", "))
+	}
+	return nil
+}
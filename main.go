@@ -2,84 +2,182 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
-	"github.com/go-rod/rod"
-	"github.com/go-rod/rod/lib/launcher"
-	"github.com/go-rod/rod/lib/proto"
+	"github.com/ncw/kindledl/aria2"
+	"github.com/ncw/kindledl/kindledl"
+	"github.com/ncw/kindledl/store"
 )
 
 const (
-	program = "kindledl"
+	program = kindledl.Program
 )
 
-// Flags
+// Options set by the flags
+var opt = kindledl.DefaultOptions()
+
+// Flags which don't set options
+var (
+	login          = flag.Bool("login", false, "set to launch login browser")
+	useJSON        = flag.Bool("json", false, "log in JSON format")
+	exportFile     = flag.String("export", "", "If set, export the manifest to this file at the end of the run, as CSV if it ends in .csv, Markdown if it ends in .md, otherwise JSON")
+	exportJobs     = flag.String("export-downloads", "", "If set, don't download the books but write what is needed to download each one to this file as JSON lines")
+	aria2URL       = flag.String("aria2", "", "If set, download the books with aria2c using the JSON-RPC interface at this URL, eg "+aria2.DefaultURL)
+	aria2Dir       = flag.String("aria2-dir", "", "Directory for aria2c to download the books to (default the -output directory)")
+	bookRange      = flag.String("book-range", "", "Only download this range of books, eg 250-600")
+	windowSize     = flag.String("window-size", "", "Size of the browser window, eg 1920x1080 (default the browser's)")
+	selectorScript = flag.String("selector-script", "", "File of JavaScript to find elements on the page if the -msg-* flags don't work")
+	dumpStrings    = flag.Bool("dump-strings", false, "set to print the text of every span and div on the books page and which -msg-* flags match it then exit, to diagnose text not being found")
+	speed          = flag.String("speed", "", "Preset for the -time-* and -post-workers flags: cautious, normal or fast")
+	tagsFile       = flag.String("tags", "", "CSV file of ASINs and your own tags for each book to add to the metadata")
+	since          = flag.String("since", "", "If set, only download books acquired on or after this date, eg 2020-01-01")
+	until          = flag.String("until", "", "If set, only download books acquired on or before this date, eg 2023-12-31")
+	asinFile       = flag.String("asin-file", "", "File of ASINs, one per line, to download just those books from the library")
+	includeSamples = flag.Bool("include-samples", false, "set to open the menus of samples like other books instead of skipping them (same as -skip-samples=false)")
+)
+
+// Flags to control -export
 var (
-	debug              = flag.Bool("debug", false, "set to see debug messages")
-	login              = flag.Bool("login", false, "set to launch login browser")
-	show               = flag.Bool("show", false, "set to show the browser (not headless)")
-	booksPerPage       = flag.Int("books-per-page", 25, "Books shown on each page")
-	book               = flag.Int("book", 0, "Book to start downloading from")
-	output             = flag.String("output", "Books", "directory to store the downloaded books")
-	checkpoint         = flag.String("checkpoint", program+"-checkpoint.txt", "File noting where the download has got to, ignored if -book is set")
-	kindleName         = flag.String("kindle", "", "Name of the kindle to download for")
-	useJSON            = flag.Bool("json", false, "log in JSON format")
-	booksURL           = flag.String("books-url", "https://www.amazon.co.uk/hz/mycd/digital-console/contentlist/booksPurchases/dateAsc/", "URL to show purchased kindle books in date order, oldest first")
-	msgMoreActions     = flag.String("msg-more-actions", "More actions", "Text to look for to find the more actions button")
-	msgDownloadViaUSB  = flag.String("msg-download-usb", "Download & transfer via USB", "Text to look for in more actions menu")
-	msgClearFurthest   = flag.String("msg-clear-furthest", "Clear Furthest Page Read", "Text to look for in more actions menu to check it is OK")
-	msgDownloadButton  = flag.String("msg-download-button", "Download", "Text to look for to find the download button")
-	msgSuccess         = flag.String("msg-success", "Success", "Text to look for in the title of the success popup")
-	msgShowing         = flag.String("msg-showing", `Showing.*\s+(\d+)\s+to\s+(\d+)\s+of\s+(\d+)\s+items`, "What books the page is showing")
-	timeActionInterval = flag.Duration("time-action-interval", time.Second, "Minimum time between browser actions")
-	timeRetrySleep     = flag.Duration("time-retry-sleep", time.Second, "Time to wait between retry of finding something on the page")
-	timeScrollPause    = flag.Duration("time-scroll-pause", 500*time.Millisecond, "Time to wait after scrolling the page")
+	exportDownloaded = flag.Bool("export-downloaded", false, "set to only export the books which were downloaded")
+	exportByAuthor   = flag.Bool("export-by-author", false, "set to export Markdown with a file per author into the -export directory, eg for Obsidian")
 )
 
 // Global variables
 var (
-	configRoot       string      // top level config dir, typically "~/.config/"+program
-	browserConfig    string      // work directory for browser instance
-	browserPath      string      // path to the browser binary
-	downloadDir      string      // directory for downloads
-	browserPrefs     string      // JSON config for the browser
-	version          = "DEV"     // set by goreleaser
-	commit           = "NONE"    // set by goreleaser
-	date             = "UNKNOWN" // set by goreleaser
-	reMoreActions    *regexp.Regexp
-	reDownloadViaUSB *regexp.Regexp
-	reClearFurthest  *regexp.Regexp
-	reDownloadButton *regexp.Regexp
-	reSuccess        *regexp.Regexp
-	reShowing        *regexp.Regexp
-	reKindleName     *regexp.Regexp
-	errFinished      = errors.New("downloads finished")
+	version = "DEV"     // set by goreleaser
+	commit  = "NONE"    // set by goreleaser
+	date    = "UNKNOWN" // set by goreleaser
 )
 
-// Set up the global variables from the flags
-func config() (err error) {
+// Opens the checkpoint and manifest if they are URLs
+var stores *store.Opener
+
+func init() {
+	flag.BoolVar(&opt.Debug, "debug", opt.Debug, "set to see debug messages")
+	flag.BoolVar(&opt.Show, "show", opt.Show, "set to show the browser (not headless)")
+	flag.BoolVar(&opt.Container, "container", opt.Container, "set when running in a container to use browser flags which work there and store things in the /downloads and /config volumes")
+	flag.BoolVar(&opt.LowMemory, "low-memory", opt.LowMemory, "set to make the browser use as little memory as possible, eg on a Raspberry Pi or NAS")
+	flag.IntVar(&opt.RecycleBooks, "recycle-books", opt.RecycleBooks, fmt.Sprintf("Restart the browser after this many books to free memory, 0 for never (default %d with -low-memory)", kindledl.LowMemoryRecycleBooks))
+	flag.Float64Var(&opt.DeviceScale, "device-scale", opt.DeviceScale, "Device scale factor of the browser, eg 2 for a high DPI screen (default the browser's)")
+	flag.StringVar(&opt.UserAgent, "user-agent", opt.UserAgent, "User agent for the browser to send, eg the one from your normal browser (default the browser's)")
+	flag.StringVar(&opt.AcceptLanguage, "accept-language", opt.AcceptLanguage, "Languages for the browser to accept, eg en-GB,en;q=0.9 (default the browser's)")
+	flag.StringVar(&opt.Timezone, "timezone", opt.Timezone, "Timezone for the browser to use, eg Europe/London (default the system's)")
+	flag.BoolVar(&opt.Stealth, "stealth", opt.Stealth, "set to hide the signs that the browser is automated if Amazon keeps challenging it")
+	flag.StringVar(&opt.ConfigDir, "config-dir", opt.ConfigDir, "Directory for the browser profile (default the user config directory)")
+	flag.IntVar(&opt.BooksPerPage, "books-per-page", opt.BooksPerPage, "Books shown on each page")
+	flag.IntVar(&opt.Book, "book", opt.Book, "Book to start downloading from")
+	flag.StringVar(&opt.Output, "output", opt.Output, "directory to store the downloaded books, - to write them as a tar to stdout instead")
+	flag.BoolVar(&opt.Dedupe, "dedupe", opt.Dedupe, "set to remove extra copies of books in the -output directory at the end of the run, keeping the newest good one")
+	flag.StringVar(&opt.Staging, "staging", opt.Staging, "If set, download into this directory and move each book into -output once it is complete and checked")
+	flag.StringVar(&opt.StagingMove, "staging-move", kindledl.MoveAuto, "How to move books from -staging to -output: auto to rename unless they are on different filesystems then copy, rename or copy")
+	flag.BoolVar(&opt.VerifyCopy, "verify-copy", opt.VerifyCopy, "set to copy each book from -staging and read it back to check it, copying again if it is wrong, eg for NFS or SMB")
+	flag.StringVar(&opt.OrganizePreset, "organize-preset", opt.OrganizePreset, "Lay the books out in -output as a self-hosted reader expects so it can be used as a library root: kavita or komga, or by author: author")
+	flag.StringVar(&opt.OrganizePreset, "organize", opt.OrganizePreset, "Same as -organize-preset, eg -organize author")
+	flag.StringVar(&opt.FilenameTemplate, "filename-template", opt.FilenameTemplate, "If set, rename each book once downloaded using this template, eg \"{author} - {title} ({asin}).{ext}\"")
+	flag.BoolVar(&opt.FormatDirs, "format-dirs", opt.FormatDirs, "set to sort the books into a subdirectory of -output for each format, eg azw3, kfx")
+	flag.StringVar(&opt.Checkpoint, "checkpoint", opt.Checkpoint, "File noting where the download has got to, ignored if -book is set - may be a sqlite://, http(s):// or s3:// URL")
+	flag.StringVar(&opt.StateDB, "state-db", opt.StateDB, "SQLite database `file` recording the status of every book - if set, each run does the books not yet downloaded or skipped instead of using -checkpoint")
+	flag.BoolVar(&opt.EnrichOrders, "enrich-orders", opt.EnrichOrders, "set to read the purchase price and date of each book from its order")
+	flag.StringVar(&opt.OrderURL, "order-url", opt.OrderURL, "URL to show a digital order, %s is replaced with the order ID")
+	flag.StringVar(&opt.Order, "order", opt.Order, "Order to download the books in: dateAsc (oldest first), dateDsc (newest first), titleAsc or titleDsc (default the order in -books-url)")
+	flag.IntVar(&opt.MaxBooks, "max-books", opt.MaxBooks, "If set, stop the run cleanly after downloading this many books, saving the checkpoint so the next run carries on")
+	flag.StringVar(&opt.StartASIN, "start-asin", opt.StartASIN, "ASIN of the book to start downloading from, ignored if -book is set")
+	flag.StringVar(&opt.Search, "search", opt.Search, "If set, only download books found by searching for this")
+	flag.StringVar(&opt.Profile, "profile", opt.Profile, "Name of the profile to download the books of, eg a child's Amazon Kids profile, instead of the account holder's")
+	flag.BoolVar(&opt.SkipSamples, "skip-samples", opt.SkipSamples, "set to skip samples without opening their menus as they can't be downloaded")
+	flag.BoolVar(&opt.SkipFree, "skip-free", opt.SkipFree, "set to skip books which cost nothing, eg promotional freebies - this reads the price from each order like -enrich-orders")
+	flag.BoolVar(&opt.SkipOnDisk, "skip-existing", opt.SkipOnDisk, "set to skip books which already have a file in -output, matched by ASIN or title, without opening their menus")
+	flag.BoolVar(&opt.SkipRentals, "skip-rentals", opt.SkipRentals, "set to skip rented books such as eTextbooks instead of trying to download them")
+	flag.Var((*stringsFlag)(&opt.Collections), "collection", "Only download books in this collection - can be repeated")
+	flag.StringVar(&opt.Author, "author", opt.Author, "If set, only download books whose authors match this regexp, ignoring case, eg \"pratchett\"")
+	flag.StringVar(&opt.Title, "title", opt.Title, "If set, only download books whose titles match this regexp, ignoring case, eg \"discworld\"")
+	flag.StringVar(&opt.Manifest, "manifest", opt.Manifest, "File recording the details and outcome of each book processed - may be a sqlite://, http(s):// or s3:// URL")
+	flag.BoolVar(&opt.Archived, "include-archived", opt.Archived, "set to record archived books and expired loans in the manifest as unavailable at the end of the run")
+	flag.BoolVar(&opt.Periodicals, "subscriptions", opt.Periodicals, "set to record the active newspaper and magazine subscriptions in the manifest at the end of the run")
+	flag.BoolVar(&opt.Audit, "audit", opt.Audit, "set to check every book in the library was attempted and every downloaded book has a file at the end of the run")
+	flag.BoolVar(&opt.RecordCurl, "record-curl", opt.RecordCurl, "set to record a curl command to download each book again in the manifest")
+	flag.BoolVar(&opt.JSONSidecar, "json-sidecar", opt.JSONSidecar, "set to write a JSON file of the details of each book, eg its ASIN, title, authors, kindle and where it was downloaded from, next to it")
+	flag.StringVar(&opt.SidecarTemplate, "sidecar-template", opt.SidecarTemplate, "Go template `file` to write a sidecar file of metadata next to each book, eg book.opf.tmpl")
+	flag.StringVar(&opt.Views, "views", opt.Views, "If set, make trees of symlinks to the books by author and by series in this directory at the end of each run, eg Books/views")
+	flag.StringVar(&opt.Gallery, "gallery", opt.Gallery, "If set, write an HTML index of the books to this file at the end of each run, eg Books/index.html")
+	flag.StringVar(&opt.StatusFile, "status-file", opt.StatusFile, "If set, keep the status of the run up to date in this JSON file, eg status.json")
+	flag.StringVar(&opt.Samples, "samples", opt.Samples, "If set, write a CSV of the samples in the library to this file at the end of each run, eg samples.csv")
+	flag.StringVar(&opt.Feed, "feed", opt.Feed, "If set, write an Atom feed of the most recently downloaded books to this file at the end of each run")
+	flag.Var((*stringsFlag)(&opt.Kindles), "kindle", "Name of the kindle to download for - repeat or give a comma separated list to download each book for several kindles into a subdirectory of -output for each")
+	flag.StringVar(&opt.BooksURL, "books-url", opt.BooksURL, "URL to show purchased kindle books in date order, oldest first")
+	flag.Var((*stringsFlag)(&opt.ContentTypes), "content", "Download this type of content ("+strings.Join(kindledl.ContentTypeNames(), ", ")+") into its own subdirectory of -output with its own checkpoint - can be repeated to do several in turn")
+	flag.Var((*mapFlag)(&opt.ContentDirs), "content-dir", "Subdirectory of -output for a type of content as type=dir, eg docs=Documents (default the name of the type) - can be repeated")
+	flag.Var((*mapFlag)(&opt.Selectors), "selector", "CSS selector, or XPath if it starts with / or (, to find an element instead of its -msg-* text as name=selector, eg downloadButton=//div[@role='dialog']//span[text()='Download'] - can be repeated")
+	flag.Var((*stringsFlag)(&opt.Marketplaces), "marketplace", "Download from this Amazon marketplace, eg www.amazon.com, using -books-url with the host replaced - can be repeated to do several in turn")
+	flag.StringVar(&opt.MsgMoreActions, "msg-more-actions", opt.MsgMoreActions, "Text to look for to find the more actions button")
+	flag.StringVar(&opt.MsgDownloadViaUSB, "msg-download-usb", opt.MsgDownloadViaUSB, "Text to look for in more actions menu")
+	flag.StringVar(&opt.MsgClearFurthest, "msg-clear-furthest", opt.MsgClearFurthest, "Text to look for in more actions menu to check it is OK")
+	flag.StringVar(&opt.MsgDownloadButton, "msg-download-button", opt.MsgDownloadButton, "Text to look for to find the download button")
+	flag.StringVar(&opt.MsgOrderTotal, "msg-order-total", opt.MsgOrderTotal, "Text to look for on the order page to find the price paid")
+	flag.StringVar(&opt.MsgOrderDate, "msg-order-date", opt.MsgOrderDate, "Text to look for on the order page to find the order date")
+	flag.StringVar(&opt.MsgSuccess, "msg-success", opt.MsgSuccess, "Text to look for in the title of the success popup")
+	flag.StringVar(&opt.MsgShowing, "msg-showing", opt.MsgShowing, "What books the page is showing")
+	flag.StringVar(&opt.MsgProfileMenu, "msg-profile-menu", opt.MsgProfileMenu, "Text to look for to find the menu to switch profiles")
+	flag.DurationVar(&opt.TimeActionInterval, "time-action-interval", opt.TimeActionInterval, "Time to wait before each click or navigation in the browser")
+	flag.DurationVar(&opt.TimeRetrySleep, "time-retry-sleep", opt.TimeRetrySleep, "Time to wait between retry of finding something on the page")
+	flag.DurationVar(&opt.StatusInterval, "status-interval", opt.StatusInterval, "How often to log the progress, 0 to disable")
+	flag.DurationVar(&opt.TimeJitter, "time-jitter", opt.TimeJitter, "Maximum random extra time to wait between books")
+	flag.IntVar(&opt.PostWorkers, "post-workers", opt.PostWorkers, "If set, process each book after it downloads, eg checking, uploading and -hook-post-book, in this many background workers so the browser doesn't wait")
+	flag.BoolVar(&opt.Adaptive, "adaptive", opt.Adaptive, "set to adjust the time between browser actions according to how well things are going")
+	flag.BoolVar(&opt.Benchmark, "benchmark", opt.Benchmark, "set to download one page of books then print how long each step took with suggestions for the -time-* flags")
+	flag.DurationVar(&opt.TimeScrollPause, "time-scroll-pause", opt.TimeScrollPause, "Time to wait after scrolling the page")
+	flag.BoolVar(&opt.VerifyDownloads, "verify-downloads", opt.VerifyDownloads, "set to wait for the browser to finish downloading each book before going on to the next, failing it if the download doesn't complete")
+	flag.DurationVar(&opt.TimeDownloadStall, "time-download-stall", opt.TimeDownloadStall, "How long a download can go without progress before the book fails")
+	flag.DurationVar(&opt.TimeOfflineWait, "time-offline-wait", opt.TimeOfflineWait, "How long to wait for the network to come back if it goes down during a run, 0 to fail straight away")
+}
+
+// command is a sub command of kindledl
+type command struct {
+	help string
+	run  func() error
+}
+
+// Commands which can be given as the first argument
+//
+// With no command kindledl downloads books.
+var commands = map[string]command{}
+
+// Set up the options from the flags in args
+func config(args []string) (err error) {
 	version := fmt.Sprintf("%s version %s, commit %s, built at %s", program, version, commit, date)
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage of %s: [command] [flags]\n\nCommands:\n", os.Args[0])
+		var names []string
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].help)
+		}
+		fmt.Fprintf(os.Stderr, "\nWith no command, download books.\n\nFlags:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\n%s\n", version)
 	}
-	flag.Parse()
+	err = flag.CommandLine.Parse(args)
+	if err != nil {
+		return err
+	}
 
 	// Set up the logger
 	level := slog.LevelInfo
-	if *debug {
+	if opt.Debug {
 		level = slog.LevelDebug
 	}
 	if *useJSON {
@@ -90,573 +188,430 @@ func config() (err error) {
 	}
 	slog.Debug(version)
 
-	configRoot, err = os.UserConfigDir()
-	if err != nil {
-		return fmt.Errorf("didn't find config directory: %w", err)
-	}
-	configRoot = filepath.Join(configRoot, program)
-	browserConfig = filepath.Join(configRoot, "browser")
-	err = os.MkdirAll(browserConfig, 0700)
-	if err != nil {
-		return fmt.Errorf("config directory creation: %w", err)
-	}
-	slog.Debug("Configured config", "config_root", configRoot, "browser_config", browserConfig)
-
-	downloadDir, err = filepath.Abs(*output)
-	if err != nil {
-		return fmt.Errorf("download directory absolute path: %w", err)
-	}
-	err = os.MkdirAll(downloadDir, 0777)
-	if err != nil {
-		return fmt.Errorf("download directory creation: %w", err)
-	}
-	slog.Info("Created download directory", "download_directory", downloadDir)
-
-	// Find the browser
-	var ok bool
-	browserPath, ok = launcher.LookPath()
-	if !ok {
-		return errors.New("browser not found")
-	}
-	slog.Debug("Found browser", "browser_path", browserPath)
-
-	// Browser preferences
-	pref := map[string]any{
-		"download": map[string]any{
-			"default_directory": downloadDir,
-		},
-	}
-	prefJSON, err := json.Marshal(pref)
-	if err != nil {
-		return fmt.Errorf("failed to make preferences: %w", err)
-	}
-	browserPrefs = string(prefJSON)
-	slog.Debug("made browser preferences", "prefs", browserPrefs)
-
-	// Compile regexps from messages
-	for _, msg := range []struct {
-		re  **regexp.Regexp
-		txt *string
-	}{
-		{&reMoreActions, msgMoreActions},
-		{&reDownloadViaUSB, msgDownloadViaUSB},
-		{&reClearFurthest, msgClearFurthest},
-		{&reDownloadButton, msgDownloadButton},
-		{&reSuccess, msgSuccess},
-		{&reShowing, msgShowing},
-		{&reKindleName, kindleName},
-	} {
-		*msg.re, err = regexp.Compile(`(?i)^\s*` + *msg.txt + `\s*$`)
-		if err != nil {
-			return fmt.Errorf("failed to compile match string %q as regexp: %w", *msg.txt, err)
+	// Only use Kindles if there are several to download for
+	var kindles []string
+	for _, names := range opt.Kindles {
+		for _, name := range strings.Split(names, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				kindles = append(kindles, name)
+			}
 		}
 	}
-
-	return nil
-}
-
-// logger makes an io.Writer from slog.Debug
-type logger struct{}
-
-// Write writes len(p) bytes from p to the underlying data stream.
-func (logger) Write(p []byte) (n int, err error) {
-	s := string(p)
-	s = strings.TrimSpace(s)
-	slog.Debug(s)
-	return len(p), nil
-}
-
-// Println is called to log text
-func (logger) Println(vs ...any) {
-	s := fmt.Sprint(vs...)
-	s = strings.TrimSpace(s)
-	slog.Debug(s)
-}
-
-// Kindle is a single page browser for Amazon Books
-type Kindle struct {
-	browser    *rod.Browser
-	page       *rod.Page
-	book       int // current book we are downloading
-	pageNumber int // page number we are looking at
-	offset     int // current offset
-	totalBooks int // total number of books to download
-}
-
-// New creates a new browser on the books main page to check we are logged in
-func New() (*Kindle, error) {
-	k := &Kindle{
-		book:       1,
-		totalBooks: -1,
-	}
-	err := k.startBrowser()
-	if err != nil {
-		return nil, err
+	opt.Kindles = nil
+	if len(kindles) > 0 {
+		opt.KindleName = kindles[0]
 	}
-	// Work out where we are starting from
-	if *book > 0 {
-		k.book = *book
-	} else {
-		err = k.loadCheckpoint()
-		if err != nil {
-			return nil, err
-		}
+	if len(kindles) > 1 {
+		opt.Kindles = kindles
 	}
-	// k.page and k.pageNumber are 1 based
-	// k.offset is 0 based
-	k.pageNumber = (k.book-1) / *booksPerPage + 1
-	k.offset = (k.book - 1) % *booksPerPage
-	slog.Info("Starting downloads", "book", k.book)
-	return k, nil
-}
 
-// loadCheckpoint loads the current book position from the checkpoint file
-func (k *Kindle) loadCheckpoint() error {
-	data, err := os.ReadFile(*checkpoint)
-	if os.IsNotExist(err) {
-		k.book = 1
-		return nil
-	} else if err != nil {
-		return fmt.Errorf("failed to read checkpoint file %q: %w", *checkpoint, err)
-	}
-	book, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	err = applySpeed()
 	if err != nil {
-		return fmt.Errorf("failed to convert checkpoint file content to integer: %w", err)
+		return err
 	}
-	k.book = book
-	return nil
-}
 
-// saveCheckpoint saves the current book position to the checkpoint file
-func (k *Kindle) saveCheckpoint() error {
-	data := []byte(strconv.Itoa(k.book))
-	err := os.WriteFile(*checkpoint, data, 0644)
+	err = addUploaders()
 	if err != nil {
-		return fmt.Errorf("failed to write checkpoint file %q: %w", *checkpoint, err)
+		return err
 	}
-	return nil
-}
-
-// Returns the URL for the current page number
-func (k *Kindle) pageURL() string {
-	return fmt.Sprintf("%s?pageNumber=%d", *booksURL, k.pageNumber)
-}
-
-// start the browser off and check it is authenticated
-func (k *Kindle) startBrowser() error {
-	// We use the default profile in our new data directory
-	l := launcher.New().
-		Bin(browserPath).
-		Headless(!*show).
-		UserDataDir(browserConfig).
-		Preferences(browserPrefs).
-		Set("disable-gpu").
-		Set("disable-audio-output").
-		Logger(logger{})
-
-	url, err := l.Launch()
+	stores = store.NewOpener(store.Options{S3: s3Opt})
+	opt.StoreOpener = stores.Open
+	opt.StateDBOpener = store.OpenStateDB
+	addCommandHooks()
+	err = addNotifiers()
 	if err != nil {
-		return fmt.Errorf("browser launch: %w", err)
+		return err
 	}
-
-	k.browser = rod.New().
-		ControlURL(url).
-		NoDefaultDevice().
-		Trace(true).
-		SlowMotion(*timeActionInterval).
-		Logger(logger{})
-
-	err = k.browser.Connect()
+	err = addRefresh()
 	if err != nil {
-		return fmt.Errorf("failed to connect to browser: %w", err)
+		return err
 	}
-
-	k.page, err = k.browser.Page(proto.TargetCreateTarget{})
+	err = addSystemdNotify()
 	if err != nil {
-		return fmt.Errorf("failed to open new browser page: %w", err)
+		return err
 	}
-	return nil
-}
 
-// Opens the current page with 25 books on
-func (k *Kindle) openPage() (err error) {
-	url := k.pageURL()
-	err = k.page.Navigate(url)
-	if err != nil {
-		return fmt.Errorf("couldn't open books URL %q: %w", url, err)
+	if *selectorScript != "" {
+		script, err := os.ReadFile(*selectorScript)
+		if err != nil {
+			return fmt.Errorf("failed to read selector script: %w", err)
+		}
+		opt.SelectorScript = string(script)
 	}
 
-	eventCallback := func(e *proto.PageLifecycleEvent) {
-		slog.Debug("Event", "Name", e.Name, "Dump", e)
+	if *tagsFile != "" {
+		opt.Tags, err = kindledl.ReadTags(*tagsFile)
+		if err != nil {
+			return err
+		}
+		slog.Debug("Read tags", "books", len(opt.Tags))
 	}
-	k.page.EachEvent(eventCallback)
 
-	err = k.page.WaitLoad()
-	if err != nil {
-		return fmt.Errorf("books page load: %w", err)
-	}
-
-	authenticated := false
-	for try := 0; try < 60; try++ {
-		time.Sleep(*timeRetrySleep)
-		info := k.page.MustInfo()
-		slog.Debug("URL", "url", info.URL)
-		// When not authenticated Amazon redirects away from the Books URL
-		if info.URL == url {
-			authenticated = true
-			slog.Debug("Authenticated")
-			break
+	if *since != "" {
+		opt.Since, err = time.Parse(time.DateOnly, *since)
+		if err != nil {
+			return fmt.Errorf("invalid -since date, use YYYY-MM-DD: %w", err)
 		}
-		// However if we select beyond the end, then we get redirected back to a previous page
-		if strings.HasPrefix(info.URL, *booksURL) {
-			return errFinished
+	}
+	if *until != "" {
+		opt.Until, err = time.Parse(time.DateOnly, *until)
+		if err != nil {
+			return fmt.Errorf("invalid -until date, use YYYY-MM-DD: %w", err)
 		}
-		slog.Info("Please log in, or re-run with -login flag")
 	}
-	if !authenticated {
-		return errors.New("browser is not logged in - rerun with the -login flag")
+	if !opt.Since.IsZero() && !opt.Until.IsZero() && opt.Until.Before(opt.Since) {
+		return errors.New("-until must not be before -since")
 	}
-	return nil
-}
 
-// Find the elements of type with the text
-func (k *Kindle) findElementWithText(subLog *slog.Logger, elementName string, match *regexp.Regexp) (found rod.Elements, err error) {
-	subLog = subLog.With(
-		"elementName", elementName,
-		"text", match.String(),
-	)
-	for i := 0; i < 5; i++ {
-		subLog.Debug("Looking for element with text", "try", i)
-		elements, err := k.page.Elements(elementName)
+	// Only a few books are wanted so keep a separate checkpoint for
+	// the ASIN file unless the user has chosen one.
+	if *asinFile != "" {
+		opt.ASINs, err = kindledl.ReadASINs(*asinFile)
 		if err != nil {
-			return nil, fmt.Errorf("error looking for %q with %q on page: %w", elementName, match, err)
-		}
-		for _, el := range elements {
-			elText, err := el.Text()
-			if err != nil {
-				return nil, fmt.Errorf("error looking for %q with %q in span: %w", elementName, match, err)
-			}
-			if match.MatchString(elText) {
-				found = append(found, el)
-			}
+			return err
 		}
-		if len(found) > 0 {
-			break
+		if !isFlagSet("checkpoint") {
+			name := strings.TrimSuffix(filepath.Base(*asinFile), filepath.Ext(*asinFile))
+			opt.Checkpoint = kindledl.WithSuffix(opt.Checkpoint, sanitizeFileName(name))
 		}
-		time.Sleep(*timeRetrySleep)
+		slog.Debug("Read ASIN file", "books", len(opt.ASINs), "checkpoint", opt.Checkpoint)
 	}
-	return found, nil
-}
 
-var errNoneFound = errors.New("none found")
-
-// As findOneElementWithText but returns only one
-func (k *Kindle) findOneElementWithText(subLog *slog.Logger, elementName string, match *regexp.Regexp) (el *rod.Element, err error) {
-	found, err := k.findElementWithText(subLog, elementName, match)
-	if err != nil {
-		return nil, err
-	}
-	if len(found) == 0 {
-		return nil, fmt.Errorf("no %q containing %q found: %w", elementName, match, errNoneFound)
-	} else if len(found) != 1 {
-		return nil, fmt.Errorf("expecting 1 %q containing %q but found %d", elementName, match, len(found))
+	if *includeSamples {
+		if isFlagSet("skip-samples") && opt.SkipSamples {
+			return errors.New("can't use -include-samples with -skip-samples")
+		}
+		opt.SkipSamples = false
 	}
-	return found[0], err
-}
-
-// Download the n-th book with the menu passed in
-func (k *Kindle) downloadOneBook(subLog *slog.Logger, n int, action *rod.Element) error {
-	subLog = subLog.With(
-		"book", k.book,
-		"book_number", n+1,
-	)
 
-	err := action.ScrollIntoView()
-	if err != nil {
-		return fmt.Errorf("error scrolling button into view: %w", err)
+	// Parse the book range
+	if *bookRange != "" {
+		if opt.Book > 0 || opt.StartASIN != "" {
+			return errors.New("can't use -book-range with -book or -start-asin")
+		}
+		opt.FirstBook, opt.LastBook, err = parseBookRange(*bookRange)
+		if err != nil {
+			return err
+		}
+		if !isFlagSet("checkpoint") {
+			opt.Checkpoint = kindledl.WithSuffix(opt.Checkpoint, fmt.Sprintf("%d-%d", opt.FirstBook, opt.LastBook))
+			slog.Debug("Using checkpoint for book range", "checkpoint", opt.Checkpoint)
+		}
 	}
 
-	// Small pause to let things settle
-	time.Sleep(*timeScrollPause)
+	// The book numbers of a search are positions in the search
+	// results so keep a separate checkpoint for each search unless
+	// the user has chosen one.
+	if opt.Search != "" && !isFlagSet("checkpoint") {
+		opt.Checkpoint = kindledl.WithSuffix(opt.Checkpoint, sanitizeFileName(opt.Search))
+		slog.Debug("Using checkpoint for search", "checkpoint", opt.Checkpoint)
+	}
 
-	subLog.Debug("Opening more actions menu")
-	err = action.Click(proto.InputMouseButtonLeft, 1)
-	if err != nil {
-		return fmt.Errorf("error clicking on more actions: %w", err)
+	// Likewise the book numbers are positions in the collections
+	// when the content list filters by them.
+	if len(opt.Collections) > 0 && !isFlagSet("checkpoint") {
+		opt.Checkpoint = kindledl.WithSuffix(opt.Checkpoint, sanitizeFileName(strings.Join(opt.Collections, "-")))
+		slog.Debug("Using checkpoint for collections", "checkpoint", opt.Checkpoint)
 	}
 
-	// Check the menu exists
-	clearFurthest, err := k.findOneElementWithText(subLog, "span", reClearFurthest)
-	if err != nil {
-		return fmt.Errorf("couldn't find popup menu (-msg-clear-furthest=%q): %w", *msgClearFurthest, err)
+	// setupTar replaces -output - with a temporary directory so note
+	// it before anything else changes the output
+	outputTar = opt.Output == "-"
+	if outputTar && *aria2URL != "" {
+		return errors.New("can't use -aria2 with -output - as aria2c doesn't download the books into the tar")
 	}
 
-	// ... as some books (eg SAMPLES) don't have a download link
-	menu, err := k.findOneElementWithText(subLog, "span", reDownloadViaUSB)
-	if errors.Is(err, errNoneFound) {
-		slog.Error(fmt.Sprintf("Book has no (-msg-download-usb=%q) link - skipping", *msgDownloadViaUSB))
+	// This goes before the profile so the profile's books go in a
+	// directory of the container's output.
+	applyContainer()
 
-		// Get the element's position
-		shape, err := clearFurthest.Shape()
-		if err != nil {
-			return fmt.Errorf("failed to get shape to dismiss popup: %w", err)
+	// Each profile has its own library so keep its books, checkpoint
+	// and manifest separate.
+	if opt.Profile != "" {
+		name := sanitizeFileName(opt.Profile)
+		if !outputTar {
+			opt.Output = filepath.Join(opt.Output, name)
 		}
-
-		// Click a bit off the side of the box to dismiss it
-		x := shape.Box().X - 50
-		y := shape.Box().Y
-
-		// Move mouse to the new coordinates and click to dismiss the box
-		err = k.page.Mouse.MoveTo(proto.Point{X: x, Y: y})
-		if err != nil {
-			return fmt.Errorf("failed to move mouse to dismiss popup: %w", err)
+		if !isFlagSet("checkpoint") {
+			opt.Checkpoint = kindledl.WithSuffix(opt.Checkpoint, name)
 		}
-		err = k.page.Mouse.Click(proto.InputMouseButtonLeft, 1)
-		if err != nil {
-			return fmt.Errorf("failed to click mouse to dismiss popup: %w", err)
+		if !isFlagSet("manifest") {
+			opt.Manifest = kindledl.WithSuffix(opt.Manifest, name)
+		}
+		if opt.StateDB != "" {
+			opt.StateDB = kindledl.WithSuffix(opt.StateDB, name)
 		}
-		return nil
-	} else if err != nil {
-		return fmt.Errorf("couldn't find popup menu (-msg-download-usb=%q): %w", *msgDownloadViaUSB, err)
+		slog.Debug("Using profile", "profile", opt.Profile, "output", opt.Output, "checkpoint", opt.Checkpoint, "manifest", opt.Manifest, "state_db", opt.StateDB)
 	}
 
-	subLog.Debug("Opening download menu")
-	err = menu.Click(proto.InputMouseButtonLeft, 1)
+	err = applyLocale()
 	if err != nil {
-		return fmt.Errorf("error clicking on Download & transfer via USB button: %w", err)
-	}
-
-	// Choose kindle popup
-	_ = `
-<li class="ActionList-module_action_list_item__LoNyc">
-  <div style="width: 20px;">
-    <label class="RadioButton-module_radio_container__3ni_P">
-      <input type="radio" name="actionListRadioButton">
-      <span id="download_and_transfer_list_B000JMLBHU_3" class="RadioButton-module_radio__1k8O3" tabindex="0">
-      </span>
-    </label>
-  </div>
-  <div class="ActionList-module_action_list_value__ijMh2">
-    Nick's Paperwhite Kindle
-  </div>
-</li>
-`
-
-	kindle, err := k.findOneElementWithText(subLog, "li div", reKindleName)
-	if err != nil {
-		return fmt.Errorf("couldn't find kindle name in menu (-kindle=%q): %w", *kindleName, err)
+		return err
 	}
 
-	li, err := kindle.Parent()
-	if err != nil {
-		return fmt.Errorf("couldn't find li parent of kindle: %w", err)
+	if *exportJobs != "" && *aria2URL != "" {
+		return errors.New("can't use -export-downloads with -aria2")
 	}
-
-	input, err := li.Element("input[type='radio']")
-	if err != nil {
-		return fmt.Errorf("couldn't find radio in kindle menu: %w", err)
+	if *exportJobs != "" {
+		opt.Downloader = kindledl.NewJobFile(*exportJobs)
 	}
-
-	subLog.Debug("Selecting desired kindle")
-	err = input.Click(proto.InputMouseButtonLeft, 1)
-	if err != nil {
-		return fmt.Errorf("error clicking on selected kindle: %w", err)
+	if *aria2URL != "" {
+		opt.Downloader, err = newAria2()
+		if err != nil {
+			return err
+		}
 	}
 
-	downloadButton, err := k.findOneElementWithText(subLog, "span", reDownloadButton)
-	if err != nil {
-		return fmt.Errorf("couldn't find download button (-msg-download-button=%q): %w", *msgDownloadButton, err)
+	if *windowSize != "" {
+		opt.WindowWidth, opt.WindowHeight, err = parseWindowSize(*windowSize)
+		if err != nil {
+			return err
+		}
 	}
 
-	subLog.Debug("Downloading book")
-	err = downloadButton.Click(proto.InputMouseButtonLeft, 1)
-	if err != nil {
-		return fmt.Errorf("error clicking on download button: %w", err)
-	}
-
-	// Success popup
-	_ = `
-<div id="notification-success" class="Notification-module_message_container__1I59M">
-  <div class="Notification-module_message_wrapper__1KMgj Notification-module_message_wrapper_success__2RUp8">
-    <span id="notification-close" class="Notification-module_close__2N_IB" tabindex="0">
-    </span>
-    <div class="Notification-module_message_heading__2vO83 Notification-module_message_heading_success__1rCJl">
-      <i aria-hidden="true" class="fa fa-check">
-      </i>
-      <div class="Notification-module_message_heading_container_success__zVMaH">
-        <span>Success</span>
-      </div>
-    </div>
-    <div id="success_d0" class="Notification-module_message_heading_container__2R3WZ">
-      <span>Download your Kindle content to your computer via Your Media Library.</span>
-    </div>
-  </div>
-</div>
-`
-	success, err := k.findOneElementWithText(subLog, "span", reSuccess)
-	if err != nil {
-		return fmt.Errorf("couldn't find success popup (-msg-success=%q): %w", *msgSuccess, err)
+	if opt.LowMemory && !isFlagSet("recycle-books") {
+		opt.RecycleBooks = kindledl.LowMemoryRecycleBooks
 	}
 
-	successDiv, err := success.Parent()
-	if err != nil {
-		return fmt.Errorf("couldn't find div parent of success: %w", err)
-	}
+	return nil
+}
 
-	successDivDiv, err := successDiv.Parent()
-	if err != nil {
-		return fmt.Errorf("couldn't find div div parent of success: %w", err)
+// Parse a book range like "250-600"
+func parseBookRange(s string) (first, last int, err error) {
+	firstStr, lastStr, ok := strings.Cut(s, "-")
+	if ok {
+		first, err = strconv.Atoi(strings.TrimSpace(firstStr))
 	}
-
-	successDivDivDiv, err := successDivDiv.Parent()
-	if err != nil {
-		return fmt.Errorf("couldn't find div div div parent of success: %w", err)
+	if ok && err == nil {
+		last, err = strconv.Atoi(strings.TrimSpace(lastStr))
 	}
-
-	close, err := successDivDivDiv.Element("span")
-	if err != nil {
-		return fmt.Errorf("success close box: %w", err)
+	if !ok || err != nil || first < 1 || last < first {
+		return 0, 0, fmt.Errorf("invalid -book-range %q - expecting something like 250-600", s)
 	}
+	return first, last, nil
+}
 
-	// Click in the close box to make it go away
-	err = close.Click(proto.InputMouseButtonLeft, 1)
+// Make an aria2 downloader from the flags, checking aria2c is running
+//
+// The RPC secret is read from the ARIA2_SECRET environment variable.
+func newAria2() (*aria2.Client, error) {
+	dir := *aria2Dir
+	if dir == "" {
+		var err error
+		dir, err = filepath.Abs(opt.Output)
+		if err != nil {
+			return nil, err
+		}
+	}
+	a := &aria2.Client{
+		URL:    *aria2URL,
+		Secret: os.Getenv("ARIA2_SECRET"),
+		Dir:    dir,
+	}
+	version, err := a.Check(context.Background())
 	if err != nil {
-		return fmt.Errorf("error clicking on success popup: %w", err)
+		return nil, fmt.Errorf("failed to connect to aria2c: %w", err)
 	}
-
-	subLog.Info("Downloaded book")
-	return nil
+	slog.Info("Downloading with aria2c", "version", version, "dir", dir)
+	return a, nil
 }
 
-// Download all the books on the given page
-func (k *Kindle) downloadAllOnPage() error {
-	err := k.openPage()
-	if err != nil {
-		return err
+// In a container put things in the volumes unless the user has chosen
+// somewhere else
+func applyContainer() {
+	if !opt.Container {
+		return
 	}
-
-	subLog := slog.Default().With(
-		"url", k.pageURL(),
-		"page", k.pageNumber,
-	)
-
-	// Find out how many books on this page
-	showing, err := k.findOneElementWithText(subLog, "span", reShowing)
-	if err != nil {
-		return fmt.Errorf("couldn't find showing text (-msg-showing=%q): %w", *msgShowing, err)
+	if !isFlagSet("output") {
+		opt.Output = kindledl.ContainerOutput
 	}
-	showingTxt, err := showing.Text()
-	if err != nil {
-		return fmt.Errorf("couldn't get showing text (-msg-showing=%q): %w", *msgShowing, err)
+	if !isFlagSet("config-dir") {
+		opt.ConfigDir = kindledl.ContainerConfigDir
 	}
-	match := reShowing.FindStringSubmatch(showingTxt)
-	if len(match) != 4 {
-		return fmt.Errorf("showing text regexp didn't match (-msg-showing=%q): %w", *msgShowing, err)
+	if !isFlagSet("checkpoint") {
+		opt.Checkpoint = filepath.Join(kindledl.ContainerConfigDir, opt.Checkpoint)
 	}
-	startBook, _ := strconv.Atoi(match[1])
-	endBook, _ := strconv.Atoi(match[2])
-	totalBooks, _ := strconv.Atoi(match[3])
-	slog.Info("Opened new page", "startBook", startBook, "endBook", endBook, "totalBooks", totalBooks)
-	k.totalBooks = totalBooks
+	if !isFlagSet("manifest") {
+		opt.Manifest = filepath.Join(kindledl.ContainerConfigDir, opt.Manifest)
+	}
+	slog.Debug("Running in a container", "output", opt.Output, "config_dir", opt.ConfigDir, "checkpoint", opt.Checkpoint, "manifest", opt.Manifest)
+}
 
-	// Find all the spans with text "More actions"
-	// Each of these is a book
-	actions, err := k.findElementWithText(subLog, "span", reMoreActions)
-	if err != nil {
-		return fmt.Errorf("couldn't find books (-msg-more-actions=%q): %w", *msgMoreActions, err)
+// Parse a window size like "1920x1080"
+func parseWindowSize(s string) (width, height int, err error) {
+	widthStr, heightStr, ok := strings.Cut(strings.ToLower(s), "x")
+	if ok {
+		width, err = strconv.Atoi(strings.TrimSpace(widthStr))
 	}
-	subLog.Debug("Found in page", "books", len(actions))
-	if len(actions) == 0 {
-		return fmt.Errorf("no books found on page")
+	if ok && err == nil {
+		height, err = strconv.Atoi(strings.TrimSpace(heightStr))
 	}
+	if !ok || err != nil || width < 1 || height < 1 {
+		return 0, 0, fmt.Errorf("invalid -window-size %q - expecting something like 1920x1080", s)
+	}
+	return width, height, nil
+}
 
-	for n, action := range actions {
-		if n < k.offset {
-			subLog.Debug("skip offset", "offset", n)
-			continue
-		}
-		err = k.downloadOneBook(subLog, n, action)
-		if err != nil {
-			return err
+// Returns whether the flag called name was set on the command line
+func isFlagSet(name string) (found bool) {
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
 		}
-		k.book++
-		err = k.saveCheckpoint()
-		if err != nil {
-			return err
+	})
+	return found
+}
+
+// Replace characters which might cause problems in file names with _
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.' {
+			return r
 		}
-	}
-	k.offset = 0
+		return '_'
+	}, name)
+}
+
+// stringsFlag is a flag which can be repeated to make a list of strings
+type stringsFlag []string
 
+// String returns the value of the flag as a string
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set adds a value to the flag
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
 	return nil
 }
 
-// Close the browser
-func (k *Kindle) Close() {
-	err := k.browser.Close()
-	if err == nil {
-		slog.Debug("Closed browser")
-	} else {
-		slog.Error("Failed to close browser", "err", err)
+// mapFlag is a flag which can be repeated to make a map from
+// key=value pairs
+type mapFlag map[string]string
+
+// String returns the value of the flag as a string
+func (m *mapFlag) String() string {
+	var pairs []string
+	for k, v := range *m {
+		pairs = append(pairs, k+"="+v)
 	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
 }
 
-// Log the browser in
-func doLogin() error {
-	slog.Info("Log in to amazon with the browser that pops up, close it, then re-run this without the -login flag")
-	cmd := exec.Command(browserPath, "--user-data-dir="+browserConfig, *booksURL)
-	err := cmd.Start()
-	if err != nil {
-		return fmt.Errorf("failed to start browser: %w", err)
+// Set adds a key=value pair to the flag
+func (m *mapFlag) Set(value string) error {
+	k, v, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("need key=value not %q", value)
 	}
-	slog.Info("Waiting for browser to be closed")
-	err = cmd.Wait()
-	if err != nil {
-		return fmt.Errorf("browser run failed: %w", err)
+	if *m == nil {
+		*m = mapFlag{}
 	}
-	slog.Info("Now restart this program without -login")
+	(*m)[k] = v
 	return nil
 }
 
-// Run the downloader returning an error if needed
+// Run the command returning an error if needed
 func run() error {
-	err := config()
+	args := os.Args[1:]
+	var cmd *command
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		c, ok := commands[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown command %q - see -h for help", args[0])
+		}
+		cmd = &c
+		args = args[1:]
+	}
+
+	err := config(args)
+	if stores != nil {
+		defer func() {
+			_ = stores.Close()
+		}()
+	}
 	if err != nil {
 		return err
 	}
 
+	if *listLocales {
+		return printLocales()
+	}
+
 	// If login is required, run the browser standalone
 	if *login {
-		return doLogin()
+		return kindledl.Login(opt)
+	}
+
+	if cmd != nil {
+		return cmd.run()
 	}
+	return download()
+}
 
-	if *kindleName == "" {
+// Download the books
+func download() error {
+	if opt.KindleName == "" && !*dumpStrings {
 		return fmt.Errorf(`need name of kindle, add something like -kindle "My Kindle"`)
 	}
 
-	k, err := New()
+	finishTar, err := setupTar()
 	if err != nil {
 		return err
 	}
-	defer k.Close()
+	defer finishTar()
 
-	for {
-		err = k.downloadAllOnPage()
-		if err != nil {
-			return err
-		}
-		k.pageNumber++
-		if k.book > k.totalBooks {
-			return errFinished
-		}
+	k, err := kindledl.New(opt)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	defer k.Summary()
+	if *dumpStrings {
+		return k.DumpStrings(os.Stdout)
+	}
+	if opt.Benchmark {
+		defer func() {
+			reportErr := k.BenchmarkReport(os.Stdout)
+			if reportErr != nil {
+				slog.Error("Failed to write benchmark report", "err", reportErr)
+			}
+		}()
+	}
+	if *exportFile != "" {
+		defer func() {
+			exportErr := k.Manifest().ExportWith(*exportFile, kindledl.ExportOptions{
+				DownloadedOnly: *exportDownloaded,
+				ByAuthor:       *exportByAuthor,
+				Output:         opt.Output,
+			})
+			if exportErr != nil {
+				slog.Error("Failed to export manifest", "err", exportErr)
+			} else {
+				slog.Info("Exported manifest", "file", *exportFile)
+			}
+		}()
 	}
+
+	return k.Run()
 }
 
 func main() {
 	err := run()
-	if errors.Is(err, errFinished) {
+	if errors.Is(err, kindledl.ErrFinished) || errors.Is(err, kindledl.ErrBenchmarkDone) || errors.Is(err, kindledl.ErrMaxBooks) {
 		slog.Info(err.Error())
 		err = nil
 	}
+	if errors.Is(err, kindledl.ErrNotLoggedIn) {
+		slog.Error(err.Error())
+		os.Exit(exitNotLoggedIn)
+	}
+	if errors.Is(err, kindledl.ErrOffline) {
+		slog.Error(err.Error())
+		os.Exit(exitOffline)
+	}
 	if err != nil {
 		slog.Error(err.Error())
 		os.Exit(2)
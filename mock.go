@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/ncw/kindledl/kindledl"
+	"github.com/ncw/kindledl/mock"
+)
+
+// Flags for the mock command
+var (
+	mockListen = flag.String("mock-listen", "localhost:7880", "Address for the mock command to serve the mock library on")
+	mockBooks  = flag.Int("mock-books", 60, "Number of books in the mock library")
+	mockRun    = flag.Bool("mock-run", false, "set to make the mock command download the whole mock library into a temporary directory and check the result instead of serving it")
+)
+
+func init() {
+	commands["mock"] = command{
+		help: "serve a mock Amazon library to test kindledl against, or test against it with -mock-run",
+		run:  runMock,
+	}
+}
+
+// Serve the mock library, or run a download against it and check it
+// with -mock-run
+func runMock() error {
+	s := mock.New(*mockBooks)
+	addr := *mockListen
+	if *mockRun {
+		addr = "localhost:0"
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	booksURL := s.BooksURL("http://" + lis.Addr().String())
+	if !*mockRun {
+		slog.Info("Serving mock library", "books_url", booksURL, "kindle", mock.KindleName, "books", len(s.Books))
+		return http.Serve(lis, s)
+	}
+	go func() {
+		_ = http.Serve(lis, s)
+	}()
+	return mockDownload(s, booksURL)
+}
+
+// Download the whole mock library at booksURL and check everything
+// ended up where it should
+//
+// Everything goes in a temporary directory unless set with the flags.
+func mockDownload(s *mock.Server, booksURL string) error {
+	dir, err := os.MkdirTemp("", program+"-mock-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	opt.BooksURL = booksURL
+	opt.KindleName = mock.KindleName
+	opt.Kindles = nil
+	opt.BooksPerPage = mock.PerPage
+	opt.Marketplaces = nil
+	opt.ContentTypes = nil
+	if !isFlagSet("output") {
+		opt.Output = filepath.Join(dir, "Books")
+	}
+	if !isFlagSet("config-dir") {
+		opt.ConfigDir = filepath.Join(dir, "config")
+	}
+	if !isFlagSet("checkpoint") {
+		opt.Checkpoint = filepath.Join(dir, program+"-checkpoint.txt")
+	}
+	if !isFlagSet("manifest") {
+		opt.Manifest = filepath.Join(dir, program+"-manifest.json")
+	}
+	// No need to be gentle with the mock
+	for name, value := range speedPresets["fast"] {
+		if isFlagSet(name) || isFlagSet("speed") {
+			continue
+		}
+		err = flag.Set(name, value)
+		if err != nil {
+			return err
+		}
+	}
+	slog.Info("Downloading mock library", "books_url", booksURL, "output", opt.Output)
+	err = download()
+	if err != nil && !errors.Is(err, kindledl.ErrFinished) {
+		return fmt.Errorf("mock download failed: %w", err)
+	}
+	return mockCheck(s)
+}
+
+// Check the manifest and the files match what the mock library
+// should have produced
+func mockCheck(s *mock.Server) error {
+	m, err := opt.ReadManifest()
+	if err != nil {
+		return err
+	}
+	entries := map[string]kindledl.ManifestEntry{}
+	for _, e := range m.Snapshot() {
+		entries[e.ASIN] = e
+	}
+	downloads := s.Downloaded()
+	var problems []error
+	for _, b := range s.Books {
+		e, ok := entries[b.ASIN]
+		want := kindledl.StatusDownloaded
+		if b.Sample {
+			want = kindledl.StatusSkipped
+		} else if b.Refuse {
+			want = kindledl.StatusFailed
+		}
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Errorf("%s: not in manifest", b.ASIN))
+		case e.Status != want:
+			problems = append(problems, fmt.Errorf("%s: status %q, want %q", b.ASIN, e.Status, want))
+		case want == kindledl.StatusDownloaded && e.File == "":
+			problems = append(problems, fmt.Errorf("%s: no file recorded", b.ASIN))
+		case want == kindledl.StatusDownloaded && downloads[b.ASIN] != 1:
+			problems = append(problems, fmt.Errorf("%s: downloaded %d times", b.ASIN, downloads[b.ASIN]))
+		case e.File != "":
+			_, err := os.Stat(filepath.Join(opt.Output, filepath.FromSlash(e.File)))
+			if err != nil {
+				problems = append(problems, fmt.Errorf("%s: %w", b.ASIN, err))
+			}
+		}
+	}
+	downloaded, samples, refused := s.Expected()
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			slog.Error("Mock check failed", "err", problem)
+		}
+		return fmt.Errorf("mock check found %d problems", len(problems))
+	}
+	slog.Info("Mock check passed", "downloaded", downloaded, "samples", samples, "refused", refused)
+	return nil
+}
@@ -0,0 +1,323 @@
+// Package mock serves a replica of the Amazon content list pages and
+// dialogs so the whole of kindledl can be tested without Amazon
+package mock
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Paths served
+const (
+	BooksPath    = "/hz/mycd/digital-console/contentlist/booksPurchases/dateAsc/"
+	listPrefix   = "/hz/mycd/digital-console/contentlist/"
+	ajaxPath     = "/hz/mycd/digital-console/ajax"
+	downloadPath = "/mock/download/"
+)
+
+// Defaults for the library
+const (
+	KindleName = "Mock Kindle Paperwhite" // name of the kindle to download for
+	PerPage    = 25                       // books shown on each page
+	csrfToken  = "mock-csrf-token"
+)
+
+// The replica of the content list page
+//
+//go:embed page.html
+var pageHTML string
+
+var pageTemplate = template.Must(template.New("page").Parse(pageHTML))
+
+// Book is a book in the mock library
+type Book struct {
+	ASIN    string
+	Title   string
+	Authors string
+	Sample  bool // a sample which has no download link
+	Refuse  bool // Amazon shows a failure notification when it is downloaded
+}
+
+// Server serves the mock library
+//
+// It is an http.Handler. Use BooksURL to find the -books-url to use.
+type Server struct {
+	Books   []Book
+	Devices []string // names of the kindles in the device dialog
+	Promo   bool     // set to show a Kindle Unlimited promotion over the second page the first time it is served
+
+	mu         sync.Mutex
+	downloaded map[string]int // number of times each ASIN was downloaded
+}
+
+// New makes a mock library with n books
+//
+// Every tenth book is a sample and one in twenty is refused.
+func New(n int) *Server {
+	s := &Server{
+		Devices:    []string{"Mock Kindle Oasis", KindleName, "Mock Fire HD"},
+		Promo:      true,
+		downloaded: map[string]int{},
+	}
+	for i := 1; i <= n; i++ {
+		s.Books = append(s.Books, Book{
+			ASIN:    fmt.Sprintf("B%09d", i),
+			Title:   fmt.Sprintf("Mock Book %d (Mock Series, Book %d)", i, (i-1)%5+1),
+			Authors: fmt.Sprintf("Author %c", 'A'+rune((i-1)%7)),
+			Sample:  i%10 == 0,
+			Refuse:  i%20 == 7,
+		})
+	}
+	return s
+}
+
+// BooksURL returns the URL of the books page of the server at base,
+// eg http://localhost:7880
+func (s *Server) BooksURL(base string) string {
+	return strings.TrimSuffix(base, "/") + BooksPath
+}
+
+// Expected returns the number of books which should be downloaded,
+// skipped as samples and refused
+func (s *Server) Expected() (downloaded, samples, refused int) {
+	for _, b := range s.Books {
+		switch {
+		case b.Sample:
+			samples++
+		case b.Refuse:
+			refused++
+		default:
+			downloaded++
+		}
+	}
+	return downloaded, samples, refused
+}
+
+// Downloaded returns the number of times each ASIN was downloaded
+func (s *Server) Downloaded() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	downloaded := make(map[string]int, len(s.downloaded))
+	for k, v := range s.downloaded {
+		downloaded[k] = v
+	}
+	return downloaded
+}
+
+// ServeHTTP serves the mock library
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("Mock request", "method", r.Method, "url", r.URL.String())
+	switch {
+	case r.URL.Path == ajaxPath && r.Method == http.MethodPost:
+		s.serveAJAX(w, r)
+	case strings.HasPrefix(r.URL.Path, downloadPath):
+		s.serveDownload(w, r)
+	case strings.HasPrefix(r.URL.Path, listPrefix):
+		s.servePage(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Number of pages in the library
+func (s *Server) pages() int {
+	return max((len(s.Books)+PerPage-1)/PerPage, 1)
+}
+
+// Serve a page of the content list
+//
+// Like Amazon, asking for a page beyond the end redirects to the last
+// page.
+func (s *Server) servePage(w http.ResponseWriter, r *http.Request) {
+	page := 1
+	if p := r.URL.Query().Get("pageNumber"); p != "" {
+		var err error
+		page, err = strconv.Atoi(p)
+		if err != nil || page < 1 {
+			http.Error(w, "bad page number", http.StatusBadRequest)
+			return
+		}
+	}
+	if page > s.pages() {
+		q := r.URL.Query()
+		q.Set("pageNumber", strconv.Itoa(s.pages()))
+		http.Redirect(w, r, r.URL.Path+"?"+q.Encode(), http.StatusFound)
+		return
+	}
+	first := (page - 1) * PerPage
+	last := min(first+PerPage, len(s.Books))
+	s.mu.Lock()
+	promo := s.Promo && page == min(2, s.pages())
+	if promo {
+		s.Promo = false
+	}
+	s.mu.Unlock()
+	data := struct {
+		CSRFToken    string
+		First        int
+		Last         int
+		Total        int
+		Books        []Book
+		Devices      []string
+		Promo        bool
+		DownloadPath string
+	}{
+		CSRFToken:    csrfToken,
+		First:        first + 1,
+		Last:         last,
+		Total:        len(s.Books),
+		Books:        s.Books[first:last],
+		Devices:      s.Devices,
+		Promo:        promo,
+		DownloadPath: downloadPath,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := pageTemplate.Execute(w, data)
+	if err != nil {
+		slog.Error("Failed to render mock page", "err", err)
+	}
+}
+
+// The parts of the content list AJAX request the mock uses
+type ownershipRequest struct {
+	ContentType    string   `json:"contentType"`
+	ItemStatusList []string `json:"itemStatusList"`
+	FetchCriteria  struct {
+		StartIndex int `json:"startIndex"`
+		BatchSize  int `json:"batchSize"`
+	} `json:"fetchCriteria"`
+}
+
+// An item in the content list AJAX response
+type ownershipItem struct {
+	ASIN         string `json:"asin"`
+	Title        string `json:"title"`
+	Authors      string `json:"authors"`
+	AcquiredDate string `json:"acquiredDate"`
+	OrderID      string `json:"orderId"`
+	ItemStatus   string `json:"itemStatus"`
+	ReadStatus   string `json:"readStatus"`
+	OriginType   string `json:"originType"`
+}
+
+// Serve the content list AJAX call kindledl reads the metadata with
+//
+// Only the active books are returned, so asking for archived books
+// or subscriptions returns nothing.
+func (s *Server) serveAJAX(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("csrfToken") != csrfToken {
+		http.Error(w, "bad CSRF token", http.StatusForbidden)
+		return
+	}
+	var req ownershipRequest
+	err := json.Unmarshal([]byte(r.FormValue("activityInput")), &req)
+	if err != nil {
+		http.Error(w, "bad activityInput", http.StatusBadRequest)
+		return
+	}
+	var books []Book
+	active := false
+	for _, status := range req.ItemStatusList {
+		active = active || status == "Active"
+	}
+	if req.ContentType == "Ebook" && active {
+		books = s.Books
+	}
+	start := min(max(req.FetchCriteria.StartIndex, 0), len(books))
+	end := min(start+max(req.FetchCriteria.BatchSize, 0), len(books))
+	items := []ownershipItem{}
+	for i, b := range books[start:end] {
+		origin := "Purchase"
+		if b.Sample {
+			origin = "Sample"
+		}
+		items = append(items, ownershipItem{
+			ASIN:         b.ASIN,
+			Title:        b.Title,
+			Authors:      b.Authors,
+			AcquiredDate: fmt.Sprintf("%d January 2020", (start+i)%28+1),
+			OrderID:      fmt.Sprintf("D01-%07d-%07d", start+i, start+i),
+			ItemStatus:   "Active",
+			ReadStatus:   "UNREAD",
+			OriginType:   origin,
+		})
+	}
+	var resp struct {
+		Success bool `json:"success"`
+		Data    struct {
+			Success       bool            `json:"success"`
+			NumberOfItems int             `json:"numberOfItems"`
+			HasMoreItems  bool            `json:"hasMoreItems"`
+			Items         []ownershipItem `json:"items"`
+		} `json:"GetContentOwnershipData"`
+	}
+	resp.Success = true
+	resp.Data.Success = true
+	resp.Data.NumberOfItems = len(books)
+	resp.Data.HasMoreItems = end < len(books)
+	resp.Data.Items = items
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		slog.Error("Failed to write mock AJAX response", "err", err)
+	}
+}
+
+// Serve a dummy book file as an attachment, as Amazon does
+func (s *Server) serveDownload(w http.ResponseWriter, r *http.Request) {
+	asin := strings.TrimPrefix(r.URL.Path, downloadPath)
+	var book *Book
+	for i := range s.Books {
+		if s.Books[i].ASIN == asin {
+			book = &s.Books[i]
+		}
+	}
+	if book == nil || book.Sample || book.Refuse {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	s.downloaded[asin]++
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", asin+"_EBOK.azw3"))
+	_, err := w.Write(dummyAZW3(book))
+	if err != nil {
+		slog.Error("Failed to write mock book", "asin", asin, "err", err)
+	}
+}
+
+// Make a dummy book with just enough of a MOBI header for kindledl to
+// recognise it as AZW3
+func dummyAZW3(b *Book) []byte {
+	const (
+		pdbHeaderSize = 78
+		record0Offset = pdbHeaderSize + 8
+		mobiHeaderLen = 232
+	)
+	var buf bytes.Buffer
+	header := make([]byte, pdbHeaderSize)
+	copy(header, b.ASIN)
+	copy(header[60:68], "BOOKMOBI")
+	binary.BigEndian.PutUint16(header[76:78], 1) // number of records
+	buf.Write(header)
+	var recordList [8]byte
+	binary.BigEndian.PutUint32(recordList[0:4], record0Offset)
+	buf.Write(recordList[:])
+	record0 := make([]byte, 16+mobiHeaderLen)
+	copy(record0[16:20], "MOBI")
+	binary.BigEndian.PutUint32(record0[20:24], mobiHeaderLen)
+	binary.BigEndian.PutUint32(record0[36:40], 8) // KF8
+	buf.Write(record0)
+	fmt.Fprintf(&buf, "%s by %s\n", b.Title, b.Authors)
+	return buf.Bytes()
+}
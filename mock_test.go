@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/ncw/kindledl/mock"
+)
+
+// Download the whole mock library and check the result, as
+// kindledl mock -mock-run does
+func TestMockDownload(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping mock download in short mode")
+	}
+	if _, ok := launcher.LookPath(); !ok {
+		t.Skip("skipping mock download as no browser was found")
+	}
+	err := config(nil)
+	if stores != nil {
+		defer func() {
+			_ = stores.Close()
+		}()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := mock.New(*mockBooks)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	err = mockDownload(s, s.BooksURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
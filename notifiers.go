@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/ncw/kindledl/notify"
+)
+
+// Flags for notifications
+var (
+	ntfyURL   = flag.String("ntfy-url", "https://ntfy.sh", "URL of the ntfy server")
+	ntfyTopic = flag.String("ntfy-topic", "", "If set, publish notifications when the run starts, finishes or needs attention to this ntfy topic")
+	pushover  notify.Pushover
+	mqttOpt   = notify.MQTTOptions{
+		Prefix: program,
+	}
+)
+
+func init() {
+	flag.StringVar(&pushover.Token, "pushover-token", "", "Pushover application API token, set this and -pushover-user to send notifications with Pushover (default $PUSHOVER_TOKEN)")
+	flag.StringVar(&pushover.User, "pushover-user", "", "Pushover user key to send notifications to (default $PUSHOVER_USER)")
+	flag.StringVar(&mqttOpt.Broker, "mqtt-broker", "", "If set, publish every event to this MQTT broker, eg tcp://localhost:1883")
+	flag.StringVar(&mqttOpt.Prefix, "mqtt-prefix", mqttOpt.Prefix, "Prefix for the MQTT topics")
+	flag.StringVar(&mqttOpt.User, "mqtt-user", "", "User name for the MQTT broker, the password is read from $MQTT_PASSWORD")
+}
+
+// Add the notifiers configured by the flags to the options
+func addNotifiers() error {
+	if *ntfyTopic != "" {
+		opt.Hooks = append(opt.Hooks, notify.Hook(notify.NewNtfy(*ntfyURL, *ntfyTopic)))
+	}
+	if pushover.Token == "" {
+		pushover.Token = os.Getenv("PUSHOVER_TOKEN")
+	}
+	if pushover.User == "" {
+		pushover.User = os.Getenv("PUSHOVER_USER")
+	}
+	if pushover.Token != "" && pushover.User != "" {
+		opt.Hooks = append(opt.Hooks, notify.Hook(&pushover))
+	}
+	if mqttOpt.Broker != "" {
+		m, err := notify.NewMQTT(mqttOpt)
+		if err != nil {
+			return err
+		}
+		opt.Hooks = append(opt.Hooks, m.Hook)
+	}
+	return nil
+}
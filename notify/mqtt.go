@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ncw/kindledl/kindledl"
+)
+
+// MQTTOptions configure the MQTT publisher
+type MQTTOptions struct {
+	Broker   string // URL of the broker, eg tcp://localhost:1883
+	Prefix   string // prefix for the topics, eg kindledl
+	ClientID string // client ID, "" for kindledl
+	User     string // user name, "" for no authentication
+	QoS      byte   // quality of service to publish with
+}
+
+// MQTT publishes every event to an MQTT broker
+//
+// Each event is published as JSON to <prefix>/<event type>, eg
+// kindledl/post-book. The state of the run (running, blocked,
+// finished or failed) is published retained to <prefix>/state.
+type MQTT struct {
+	opt    MQTTOptions
+	client mqtt.Client
+}
+
+// mqttEvent is the JSON published for each event
+type mqttEvent struct {
+	Type    string         `json:"type"`
+	Time    time.Time      `json:"time"`
+	Page    int            `json:"page"`
+	Book    int            `json:"book"`
+	ASIN    string         `json:"asin,omitempty"`
+	Title   string         `json:"title,omitempty"`
+	Authors string         `json:"authors,omitempty"`
+	Status  string         `json:"status,omitempty"`
+	Error   string         `json:"error,omitempty"`
+	Counts  map[string]int `json:"counts"`
+}
+
+// NewMQTT connects to the MQTT broker
+//
+// If User is set then the password is read from the MQTT_PASSWORD
+// environment variable.
+func NewMQTT(opt MQTTOptions) (*MQTT, error) {
+	if opt.ClientID == "" {
+		opt.ClientID = kindledl.Program
+	}
+	opt.Prefix = strings.TrimSuffix(opt.Prefix, "/")
+	clientOpt := mqtt.NewClientOptions().
+		AddBroker(opt.Broker).
+		SetClientID(opt.ClientID).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(opt.Prefix+"/state", "offline", opt.QoS, true)
+	if opt.User != "" {
+		clientOpt.SetUsername(opt.User)
+		clientOpt.SetPassword(os.Getenv("MQTT_PASSWORD"))
+	}
+	client := mqtt.NewClient(clientOpt)
+	token := client.Connect()
+	if !token.WaitTimeout(sendTimeout) {
+		client.Disconnect(0)
+		return nil, fmt.Errorf("timed out connecting to MQTT broker %q", opt.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT broker %q: %w", opt.Broker, err)
+	}
+	slog.Debug("Connected to MQTT broker", "broker", opt.Broker)
+	return &MQTT{
+		opt:    opt,
+		client: client,
+	}, nil
+}
+
+// Publish payload to the topic under the prefix
+func (m *MQTT) publish(topic string, retained bool, payload []byte) error {
+	topic = m.opt.Prefix + "/" + topic
+	token := m.client.Publish(topic, m.opt.QoS, retained, payload)
+	if !token.WaitTimeout(sendTimeout) {
+		return fmt.Errorf("timed out publishing to MQTT topic %q", topic)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to publish to MQTT topic %q: %w", topic, err)
+	}
+	return nil
+}
+
+// Hook publishes the event
+//
+// Failures are logged and don't stop the run.
+func (m *MQTT) Hook(e kindledl.Event) error {
+	ev := mqttEvent{
+		Type:   string(e.Type),
+		Time:   e.Time,
+		Page:   e.Page,
+		Book:   e.Number,
+		Status: e.Status,
+		Counts: e.Counts,
+	}
+	if e.Book != nil {
+		ev.ASIN = e.Book.ASIN
+		ev.Title = e.Book.Title
+		ev.Authors = e.Book.Authors
+	}
+	if e.Err != nil {
+		ev.Error = e.Err.Error()
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to encode MQTT event: %w", err)
+	}
+	err = m.publish(string(e.Type), false, payload)
+	if err == nil {
+		if state := e.State(); state != "" {
+			err = m.publish("state", true, []byte(state))
+		}
+	}
+	if err != nil {
+		slog.Error("Failed to publish event", "err", err)
+	}
+	return nil
+}
+
+// Close disconnects from the broker
+func (m *MQTT) Close() {
+	m.client.Disconnect(250)
+}
@@ -0,0 +1,112 @@
+// Package notify sends notifications about kindledl runs to
+// notification services
+//
+// Use Hook to make a kindledl.Hook from a notifier to add to
+// kindledl.Options.Hooks.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ncw/kindledl/kindledl"
+)
+
+// How long to wait for a notification to be sent
+const sendTimeout = 30 * time.Second
+
+// Sender sends messages to a notification service
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Hook makes a kindledl.Hook which sends a message with s for the
+// events worth notifying, see NewMessage.
+//
+// Failures are logged and don't stop the run.
+func Hook(s Sender) kindledl.Hook {
+	return func(e kindledl.Event) error {
+		m, ok := NewMessage(e)
+		if !ok {
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		err := s.Send(ctx, m)
+		if err != nil {
+			slog.Error("Failed to send notification", "err", err)
+		}
+		return nil
+	}
+}
+
+// Priority of a message
+type Priority int
+
+// Message priorities
+const (
+	PriorityLow    Priority = iota // run started
+	PriorityNormal                 // run finished
+	PriorityHigh                   // run failed or blocked
+)
+
+// Message is a notification about the run
+type Message struct {
+	Title    string
+	Body     string
+	Priority Priority
+	Event    kindledl.EventType
+}
+
+// Summarise the counts like "10 downloaded, 2 failed"
+func countsText(counts map[string]int) string {
+	var statuses []string
+	for status := range counts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	var parts []string
+	for _, status := range statuses {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[status], status))
+	}
+	if len(parts) == 0 {
+		return "no books processed"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// NewMessage makes the message for the event, returning false if the
+// event isn't worth notifying.
+//
+// Notifications are sent when the run starts, finishes and when it is
+// blocked waiting for the user.
+func NewMessage(e kindledl.Event) (Message, bool) {
+	m := Message{Event: e.Type}
+	switch e.Type {
+	case kindledl.EventPreRun:
+		m.Title = "kindledl started"
+		m.Body = fmt.Sprintf("Starting downloads from book %d", e.Number)
+		m.Priority = PriorityLow
+	case kindledl.EventPostRun:
+		if e.Err != nil {
+			m.Title = "kindledl failed"
+			m.Body = fmt.Sprintf("%v at book %d: %s", e.Err, e.Number, countsText(e.Counts))
+			m.Priority = PriorityHigh
+		} else {
+			m.Title = "kindledl finished"
+			m.Body = countsText(e.Counts)
+			m.Priority = PriorityNormal
+		}
+	case kindledl.EventAttention:
+		m.Title = "kindledl is blocked"
+		m.Body = fmt.Sprintf("%v - the run is waiting at book %d", e.Err, e.Number)
+		m.Priority = PriorityHigh
+	default:
+		return m, false
+	}
+	return m, true
+}
@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Ntfy publishes notifications to an ntfy server such as ntfy.sh
+type Ntfy struct {
+	URL   string // URL of the server, eg https://ntfy.sh
+	Topic string // topic to publish to
+	Token string // access token, if needed
+}
+
+// NewNtfy makes a new ntfy publisher
+//
+// The access token is read from the NTFY_TOKEN environment variable if set.
+func NewNtfy(url, topic string) *Ntfy {
+	return &Ntfy{
+		URL:   strings.TrimSuffix(url, "/"),
+		Topic: topic,
+		Token: os.Getenv("NTFY_TOKEN"),
+	}
+}
+
+// ntfy priorities by Priority
+var ntfyPriorities = map[Priority]string{
+	PriorityLow:    "low",
+	PriorityNormal: "default",
+	PriorityHigh:   "high",
+}
+
+// Send publishes the message
+func (n *Ntfy) Send(ctx context.Context, m Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL+"/"+n.Topic, strings.NewReader(m.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", m.Title)
+	req.Header.Set("Priority", ntfyPriorities[m.Priority])
+	req.Header.Set("Tags", string(m.Event))
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ntfy publish failed: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("ntfy publish failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
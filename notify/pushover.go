@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// URL of the Pushover messages API
+const pushoverURL = "https://api.pushover.net/1/messages.json"
+
+// Pushover sends notifications with Pushover
+type Pushover struct {
+	Token string // application API token
+	User  string // user or group key to send to
+}
+
+// Pushover priorities by Priority
+//
+// High priority messages bypass the user's quiet hours.
+var pushoverPriorities = map[Priority]int{
+	PriorityLow:    -1,
+	PriorityNormal: 0,
+	PriorityHigh:   1,
+}
+
+// pushoverResponse is the response from the messages API
+type pushoverResponse struct {
+	Status int      `json:"status"`
+	Errors []string `json:"errors"`
+}
+
+// Send sends the message
+func (p *Pushover) Send(ctx context.Context, m Message) error {
+	form := url.Values{
+		"token":    {p.Token},
+		"user":     {p.User},
+		"title":    {m.Title},
+		"message":  {m.Body},
+		"priority": {strconv.Itoa(pushoverPriorities[m.Priority])},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pushoverURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("pushover send failed: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	var result pushoverResponse
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return fmt.Errorf("pushover send failed: %s: %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || result.Status != 1 {
+		return fmt.Errorf("pushover send failed: %s: %s", resp.Status, strings.Join(result.Errors, ", "))
+	}
+	return nil
+}
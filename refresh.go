@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ncw/kindledl/kindledl"
+)
+
+// How long to wait for the library to answer the refresh request
+const refreshTimeout = time.Minute
+
+// Flags for refreshing the library after the run
+var (
+	refreshURL     = flag.String("refresh-url", "", "If set, POST to this URL at the end of a run which downloaded books so a library such as Kavita or Komga rescans, eg http://kavita:5000/api/Library/scan?libraryId=1")
+	refreshCommand = flag.String("refresh-command", "", "If set, run this command at the end of a run which downloaded books so a library such as Calibre rescans")
+	refreshHeaders []string
+)
+
+func init() {
+	flag.Var((*stringsFlag)(&refreshHeaders), "refresh-header", "Header to send with -refresh-url, eg \"Authorization: Bearer token\" - can be repeated")
+}
+
+// Add the library refresh to the options if configured
+func addRefresh() error {
+	if *refreshURL == "" && *refreshCommand == "" {
+		return nil
+	}
+	for _, header := range refreshHeaders {
+		if !strings.Contains(header, ":") {
+			return fmt.Errorf("-refresh-header %q should be \"Name: value\"", header)
+		}
+	}
+	opt.Hooks = append(opt.Hooks, refreshHook)
+	return nil
+}
+
+// Refresh the library at the end of a run if any books were
+// downloaded
+//
+// Failures are logged and ignored.
+func refreshHook(e kindledl.Event) error {
+	if e.Type != kindledl.EventPostRun {
+		return nil
+	}
+	downloaded := e.Counts[kindledl.StatusDownloaded]
+	if downloaded == 0 {
+		slog.Debug("No books downloaded - not refreshing library")
+		return nil
+	}
+	if *refreshURL != "" {
+		err := refreshLibrary(*refreshURL)
+		if err != nil {
+			slog.Error("Failed to refresh library", "err", err)
+		} else {
+			slog.Info("Asked library to refresh", "downloaded", downloaded)
+		}
+	}
+	if *refreshCommand != "" {
+		cmd := shellCommand(*refreshCommand)
+		cmd.Env = append(os.Environ(), "KINDLEDL_DOWNLOADED="+strconv.Itoa(downloaded))
+		err := cmd.Run()
+		if err != nil {
+			slog.Error("Refresh command failed", "command", *refreshCommand, "err", err)
+		}
+	}
+	return nil
+}
+
+// POST to the refresh URL with the -refresh-header headers
+func refreshLibrary(url string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	for _, header := range refreshHeaders {
+		name, value, _ := strings.Cut(header, ":")
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("refresh URL returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+
+	"github.com/ncw/kindledl/server"
+)
+
+// Flags for the server command
+var (
+	listen     = flag.String("listen", "localhost:7878", "Address for the server command to listen on")
+	listenHTTP = flag.String("listen-http", "localhost:7879", "Address for the server command to serve the REST API on, empty to disable")
+)
+
+func init() {
+	commands["server"] = command{
+		help: "run a gRPC server so runs can be controlled remotely",
+		run:  runServer,
+	}
+}
+
+// Run the gRPC server
+func runServer() error {
+	lis, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	s := server.New(opt)
+	errs := make(chan error, 2)
+	if *listenHTTP != "" {
+		httpLis, err := net.Listen("tcp", *listenHTTP)
+		if err != nil {
+			return fmt.Errorf("failed to listen for REST API: %w", err)
+		}
+		go func() {
+			errs <- s.ServeREST(httpLis)
+		}()
+	}
+	go func() {
+		errs <- s.Serve(lis)
+	}()
+	systemd.notify("READY=1\nSTATUS=Waiting for requests")
+	return <-errs
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// codecName is the gRPC content subtype of the messages
+//
+// Clients should call with grpc.CallContentSubtype(codecName) or send
+// the content type "application/grpc+json".
+const codecName = "json"
+
+// jsonCodec encodes the gRPC messages as JSON so the service doesn't
+// need any generated protobuf code
+type jsonCodec struct{}
+
+// Marshal returns the wire format of v
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal parses the wire format into v
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Name returns the name of the codec
+func (jsonCodec) Name() string {
+	return codecName
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/ncw/kindledl/kindledl"
+)
+
+// Commands for DaemonRequest
+const (
+	DaemonSync = "sync" // download any new books
+	DaemonQuit = "quit" // close the browser and stop the daemon
+)
+
+// DaemonRequest is sent to the daemon as a line of JSON
+type DaemonRequest struct {
+	Command string `json:"command"`
+}
+
+// DaemonResult says how a request went
+type DaemonResult struct {
+	Counts map[string]int `json:"counts,omitempty"` // number of books with each status
+	Error  string         `json:"error,omitempty"`
+}
+
+// DaemonReply is sent back for a DaemonRequest as lines of JSON
+//
+// There is a reply with an Event for each event of the run followed
+// by one with the Result.
+type DaemonReply struct {
+	Event  *Event        `json:"event,omitempty"`
+	Result *DaemonResult `json:"result,omitempty"`
+}
+
+// Daemon keeps an authenticated browser open and runs download jobs
+// sent to it over a local socket, so frequent syncs don't pay for
+// starting the browser and checking the login each time.
+type Daemon struct {
+	opt    *kindledl.Options
+	mu     sync.Mutex // held while a job is running
+	client *kindledl.Client
+	runs   int // number of runs done with client
+	outMu  sync.Mutex
+	out    *json.Encoder // replies for the current job, nil if none
+	counts map[string]int
+	lis    net.Listener
+}
+
+// NewDaemon makes a daemon which runs jobs with opt
+func NewDaemon(opt *kindledl.Options) *Daemon {
+	return &Daemon{opt: opt}
+}
+
+// Serve starts the browser and runs jobs sent on lis until it is told
+// to quit or fails
+func (d *Daemon) Serve(lis net.Listener) error {
+	d.lis = lis
+	err := d.start()
+	if err != nil {
+		return err
+	}
+	defer d.client.Close()
+	slog.Info("Daemon waiting for jobs", "addr", lis.Addr())
+	for {
+		conn, err := lis.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("daemon accept failed: %w", err)
+		}
+		go d.handle(conn)
+	}
+}
+
+// Start the browser, checking it is logged in
+//
+// Call with the lock held or before serving
+func (d *Daemon) start() error {
+	c, err := kindledl.New(d.opt)
+	if err != nil {
+		return err
+	}
+	c.AddHook(d.hook)
+	d.client = c
+	d.runs = 0
+	return nil
+}
+
+// Handle the requests on conn
+func (d *Daemon) handle(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	enc := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var req DaemonRequest
+		result := &DaemonResult{}
+		err := json.Unmarshal(scanner.Bytes(), &req)
+		if err == nil {
+			switch req.Command {
+			case DaemonSync:
+				result, err = d.sync(enc)
+			case DaemonQuit:
+				err = d.quit()
+			default:
+				err = fmt.Errorf("unknown daemon command %q", req.Command)
+			}
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		err = enc.Encode(DaemonReply{Result: result})
+		if err != nil {
+			slog.Debug("Failed to send daemon reply", "err", err)
+			return
+		}
+	}
+}
+
+// Stop serving once any job has finished
+func (d *Daemon) quit() error {
+	if !d.mu.TryLock() {
+		return errBusy
+	}
+	defer d.mu.Unlock()
+	slog.Info("Daemon told to quit")
+	return d.lis.Close()
+}
+
+// Run a sync with the browser, sending the events to enc
+func (d *Daemon) sync(enc *json.Encoder) (*DaemonResult, error) {
+	if !d.mu.TryLock() {
+		return &DaemonResult{}, errBusy
+	}
+	defer d.mu.Unlock()
+	// Get the browser ready, starting a new one if it has gone wrong
+	if d.runs > 0 {
+		err := d.client.Reset()
+		if err != nil {
+			slog.Warn("Failed to reuse browser - starting a new one", "err", err)
+			d.client.Close()
+			err = d.start()
+			if err != nil {
+				return &DaemonResult{}, err
+			}
+		}
+	}
+	d.outMu.Lock()
+	d.out = enc
+	d.counts = map[string]int{}
+	d.outMu.Unlock()
+	err := d.client.Run()
+	d.client.Summary()
+	d.runs++
+	d.outMu.Lock()
+	result := &DaemonResult{Counts: d.counts}
+	d.out = nil
+	d.outMu.Unlock()
+	if errors.Is(err, kindledl.ErrFinished) || errors.Is(err, kindledl.ErrMaxBooks) {
+		err = nil
+	}
+	return result, err
+}
+
+// Called for each event in the run to send it to the current job
+func (d *Daemon) hook(e kindledl.Event) error {
+	ev := newEvent(e)
+	d.outMu.Lock()
+	defer d.outMu.Unlock()
+	if e.Type == kindledl.EventPostBook || e.Type == kindledl.EventFailure {
+		d.counts[e.Status]++
+	}
+	if d.out != nil {
+		err := d.out.Encode(DaemonReply{Event: &ev})
+		if err != nil {
+			slog.Debug("Failed to send event to daemon client", "err", err)
+		}
+	}
+	return nil
+}
+
+// SendDaemon sends the request to the daemon on conn, calling
+// onEvent for each event of the run, and returns the result.
+func SendDaemon(conn net.Conn, req DaemonRequest, onEvent func(Event)) (*DaemonResult, error) {
+	err := json.NewEncoder(conn).Encode(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to daemon: %w", err)
+	}
+	dec := json.NewDecoder(conn)
+	for {
+		var reply DaemonReply
+		err = dec.Decode(&reply)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read reply from daemon: %w", err)
+		}
+		if reply.Event != nil && onEvent != nil {
+			onEvent(*reply.Event)
+		}
+		if reply.Result != nil {
+			return reply.Result, nil
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ncw/kindledl/kindledl"
+)
+
+// LibraryBook is a book in the library inventory along with what
+// happened to it according to the manifest
+type LibraryBook struct {
+	kindledl.Book
+	Number int    `json:"number"`           // position of the book in the library, 1 based
+	Status string `json:"status,omitempty"` // status from the manifest, "" if not processed yet
+}
+
+// Library is the inventory of the books in the library
+type Library struct {
+	Time  time.Time     `json:"time"` // when the library was read
+	Books []LibraryBook `json:"books"`
+}
+
+// ServeREST serves the REST API on lis until it fails
+//
+// The endpoints are
+//
+//	GET /api/status
+//	GET /api/manifest?status=failed&author=name
+//	GET /api/library?status=failed&author=name&refresh=true
+//
+// status matches the status exactly and author matches part of the
+// authors, both case insensitively.
+func (s *Server) ServeREST(lis net.Listener) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/status", s.handleStatus)
+	mux.HandleFunc("GET /api/manifest", s.handleManifest)
+	mux.HandleFunc("GET /api/library", s.handleLibrary)
+	slog.Info("Serving REST API", "url", "http://"+lis.Addr().String()+"/api/")
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return srv.Serve(lis)
+}
+
+// Write v as JSON to w
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	err := enc.Encode(v)
+	if err != nil {
+		slog.Debug("Failed to write response", "err", err)
+	}
+}
+
+// Write an error as JSON to w
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// filter selects books using the query parameters of a request
+type filter struct {
+	status string
+	author string
+}
+
+// Make a filter from the query parameters of r
+func newFilter(r *http.Request) filter {
+	q := r.URL.Query()
+	return filter{
+		status: q.Get("status"),
+		author: strings.ToLower(q.Get("author")),
+	}
+}
+
+// Returns whether the book with status matches the filter
+func (f filter) match(b *kindledl.Book, status string) bool {
+	if f.status != "" && !strings.EqualFold(status, f.status) {
+		return false
+	}
+	if f.author != "" && !strings.Contains(strings.ToLower(b.Authors), f.author) {
+		return false
+	}
+	return true
+}
+
+// GET /api/status
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	st, _ := s.Status(r.Context(), &Empty{})
+	writeJSON(w, http.StatusOK, st)
+}
+
+// GET /api/manifest
+func (s *Server) handleManifest(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.manifest()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	f := newFilter(r)
+	m := Manifest{Entries: []kindledl.ManifestEntry{}}
+	for i := range entries {
+		e := &entries[i]
+		if f.match(&e.Book, e.Status) {
+			m.Entries = append(m.Entries, *e)
+		}
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+// GET /api/library
+//
+// Reading the library needs the browser, so it is read once and
+// cached. It can only be read or refreshed when there isn't a run in
+// progress.
+func (s *Server) handleLibrary(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	books := s.library
+	s.mu.Unlock()
+	if books == nil || r.URL.Query().Get("refresh") == "true" {
+		var err error
+		books, err = s.readLibrary(r.Context())
+		if errors.Is(err, errBusy) {
+			writeError(w, http.StatusConflict, err)
+			return
+		} else if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	entries, err := s.manifest()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	statuses := make(map[string]string, len(entries))
+	for _, e := range entries {
+		statuses[e.ASIN] = e.Status
+	}
+	f := newFilter(r)
+	lib := Library{Time: books.Time, Books: []LibraryBook{}}
+	for _, b := range books.Books {
+		b.Status = statuses[b.ASIN]
+		if f.match(&b.Book, b.Status) {
+			lib.Books = append(lib.Books, b)
+		}
+	}
+	writeJSON(w, http.StatusOK, lib)
+}
+
+// Read the library with the browser and cache it
+func (s *Server) readLibrary(ctx context.Context) (*Library, error) {
+	s.mu.Lock()
+	if s.status.State != StateIdle {
+		s.mu.Unlock()
+		return nil, errBusy
+	}
+	s.status.State = StateListing
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.status.State = StateIdle
+		s.mu.Unlock()
+	}()
+
+	c, err := kindledl.New(s.opt)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	lib := &Library{Time: time.Now()}
+	it := c.ListBooks(ctx)
+	for it.Next() {
+		lib.Books = append(lib.Books, LibraryBook{
+			Book:   it.Book(),
+			Number: it.Number(),
+		})
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	slog.Info("Read library", "books", len(lib.Books))
+	s.mu.Lock()
+	s.library = lib
+	s.mu.Unlock()
+	return lib, nil
+}
@@ -0,0 +1,294 @@
+// Package server implements a gRPC service to control kindledl runs
+//
+// The service is called kindledl.Kindledl and has these methods
+//
+//	StartRun(Empty) returns (Status)
+//	Pause(Empty) returns (Status)
+//	Resume(Empty) returns (Status)
+//	Status(Empty) returns (Status)
+//	Events(Empty) returns (stream Event)
+//	Manifest(Empty) returns (Manifest)
+//
+// The messages are encoded as JSON rather than protobuf so clients
+// need to use the "json" content subtype.
+//
+// The server can also serve a read only REST API, see ServeREST.
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ncw/kindledl/kindledl"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Run states
+const (
+	StateIdle     = "idle"
+	StateStarting = "starting"
+	StateRunning  = "running"
+	StatePaused   = "paused"
+	StateListing  = "listing" // reading the library for the REST API
+)
+
+// errBusy is returned if the browser is in use by something else
+var errBusy = errors.New("busy - wait for the current run to finish")
+
+// How many events to buffer for each Events stream before dropping them
+const eventBuffer = 100
+
+// Empty is the request for methods with no parameters
+type Empty struct{}
+
+// Status is the state of the server and the current run
+type Status struct {
+	State     string         `json:"state"`
+	Page      int            `json:"page,omitempty"`
+	Book      int            `json:"book,omitempty"`
+	ASIN      string         `json:"asin,omitempty"`
+	Title     string         `json:"title,omitempty"`
+	Counts    map[string]int `json:"counts,omitempty"`
+	LastError string         `json:"last_error,omitempty"`
+}
+
+// Event is a progress event from the run
+type Event struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Page   int       `json:"page,omitempty"`
+	Book   int       `json:"book,omitempty"`
+	ASIN   string    `json:"asin,omitempty"`
+	Title  string    `json:"title,omitempty"`
+	Status string    `json:"status,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Manifest is the record of the books processed
+type Manifest struct {
+	Entries []kindledl.ManifestEntry `json:"entries"`
+}
+
+// Server controls runs of kindledl
+type Server struct {
+	opt     *kindledl.Options
+	mu      sync.Mutex
+	client  *kindledl.Client // current run or nil
+	status  Status
+	subs    map[chan Event]struct{} // Events streams
+	library *Library                // cached library inventory or nil
+}
+
+// New makes a server which starts runs with opt
+func New(opt *kindledl.Options) *Server {
+	return &Server{
+		opt:    opt,
+		status: Status{State: StateIdle},
+		subs:   map[chan Event]struct{}{},
+	}
+}
+
+// Serve serves gRPC requests on lis until it fails
+func (s *Server) Serve(lis net.Listener) error {
+	gs := grpc.NewServer()
+	gs.RegisterService(&serviceDesc, s)
+	slog.Info("Serving gRPC", "addr", lis.Addr())
+	return gs.Serve(lis)
+}
+
+// Return a copy of the status
+//
+// Call with the lock held
+func (s *Server) statusCopy() *Status {
+	st := s.status
+	st.Counts = make(map[string]int, len(s.status.Counts))
+	for k, v := range s.status.Counts {
+		st.Counts[k] = v
+	}
+	return &st
+}
+
+// StartRun starts a download run in the background
+func (s *Server) StartRun(ctx context.Context, _ *Empty) (*Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status.State != StateIdle {
+		return nil, status.Errorf(codes.FailedPrecondition, "can't start run: state is %s", s.status.State)
+	}
+	s.status = Status{
+		State:  StateStarting,
+		Counts: map[string]int{},
+	}
+	go s.run()
+	return s.statusCopy(), nil
+}
+
+// Do a run, updating the status as it goes
+func (s *Server) run() {
+	c, err := kindledl.New(s.opt)
+	if err != nil {
+		s.finished(err)
+		return
+	}
+	c.AddHook(s.hook)
+	s.mu.Lock()
+	s.client = c
+	s.status.State = StateRunning
+	s.mu.Unlock()
+	err = c.Run()
+	c.Summary()
+	c.Close()
+	s.finished(err)
+}
+
+// Note that a run has finished
+func (s *Server) finished(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.client = nil
+	s.status.State = StateIdle
+	if err != nil && !errors.Is(err, kindledl.ErrFinished) && !errors.Is(err, kindledl.ErrMaxBooks) {
+		slog.Error("Run failed", "err", err)
+		s.status.LastError = err.Error()
+	}
+}
+
+// Make an Event from a kindledl.Event
+func newEvent(e kindledl.Event) Event {
+	ev := Event{
+		Type:   string(e.Type),
+		Time:   e.Time,
+		Page:   e.Page,
+		Book:   e.Number,
+		Status: e.Status,
+	}
+	if e.Book != nil {
+		ev.ASIN = e.Book.ASIN
+		ev.Title = e.Book.Title
+	}
+	if e.Err != nil {
+		ev.Error = e.Err.Error()
+	}
+	return ev
+}
+
+// Called for each event in the run
+func (s *Server) hook(e kindledl.Event) error {
+	ev := newEvent(e)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Page = ev.Page
+	s.status.Book = ev.Book
+	if e.Book != nil {
+		s.status.ASIN = ev.ASIN
+		s.status.Title = ev.Title
+	}
+	if e.Type == kindledl.EventPostBook || e.Type == kindledl.EventFailure {
+		s.status.Counts[e.Status]++
+	}
+	if ev.Error != "" {
+		s.status.LastError = ev.Error
+	}
+	for sub := range s.subs {
+		select {
+		case sub <- ev:
+		default:
+			slog.Debug("Dropping event for slow client", "type", ev.Type)
+		}
+	}
+	return nil
+}
+
+// Pause pauses the current run before the next book
+func (s *Server) Pause(ctx context.Context, _ *Empty) (*Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "no run in progress")
+	}
+	s.client.Pause()
+	s.status.State = StatePaused
+	return s.statusCopy(), nil
+}
+
+// Resume resumes a paused run
+func (s *Server) Resume(ctx context.Context, _ *Empty) (*Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "no run in progress")
+	}
+	s.client.Resume()
+	s.status.State = StateRunning
+	return s.statusCopy(), nil
+}
+
+// Status returns the current status
+func (s *Server) Status(ctx context.Context, _ *Empty) (*Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statusCopy(), nil
+}
+
+// Events streams the progress events until the client goes away
+func (s *Server) Events(_ *Empty, stream grpc.ServerStream) error {
+	sub := make(chan Event, eventBuffer)
+	s.mu.Lock()
+	s.subs[sub] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subs, sub)
+		s.mu.Unlock()
+	}()
+	for {
+		select {
+		case ev := <-sub:
+			err := stream.SendMsg(&ev)
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// Manifest returns the record of the books processed
+func (s *Server) Manifest(ctx context.Context, _ *Empty) (*Manifest, error) {
+	entries, err := s.manifest()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+	return &Manifest{Entries: entries}, nil
+}
+
+// Read the manifest entries from the current run or from disk if
+// there isn't one.
+//
+// The curl commands have the session cookies in so they are left out.
+func (s *Server) manifest() ([]kindledl.ManifestEntry, error) {
+	s.mu.Lock()
+	c := s.client
+	s.mu.Unlock()
+	var entries []kindledl.ManifestEntry
+	if c != nil {
+		entries = c.Manifest().Snapshot()
+	} else {
+		m, err := s.opt.ReadManifest()
+		if err != nil {
+			return nil, err
+		}
+		entries = m.Snapshot()
+	}
+	for i := range entries {
+		entries[i].Curl = ""
+	}
+	return entries, nil
+}
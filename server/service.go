@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// service is the interface the gRPC service implements
+type service interface {
+	StartRun(context.Context, *Empty) (*Status, error)
+	Pause(context.Context, *Empty) (*Status, error)
+	Resume(context.Context, *Empty) (*Status, error)
+	Status(context.Context, *Empty) (*Status, error)
+	Events(*Empty, grpc.ServerStream) error
+	Manifest(context.Context, *Empty) (*Manifest, error)
+}
+
+// Make a gRPC handler for a unary method
+func unaryHandler[Resp any](name string, method func(service, context.Context, *Empty) (*Resp, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			in := new(Empty)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return method(srv.(service), ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/" + serviceName + "/" + name,
+			}
+			return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+				return method(srv.(service), ctx, req.(*Empty))
+			})
+		},
+	}
+}
+
+// Name of the gRPC service
+const serviceName = "kindledl.Kindledl"
+
+// Description of the gRPC service for registration
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*service)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryHandler("StartRun", service.StartRun),
+		unaryHandler("Pause", service.Pause),
+		unaryHandler("Resume", service.Resume),
+		unaryHandler("Status", service.Status),
+		unaryHandler("Manifest", service.Manifest),
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Events",
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				in := new(Empty)
+				if err := stream.RecvMsg(in); err != nil {
+					return err
+				}
+				return srv.(service).Events(in, stream)
+			},
+			ServerStreams: true,
+		},
+	},
+	Metadata: "kindledl",
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// Settings of the timing and concurrency flags for each -speed preset
+var speedPresets = map[string]map[string]string{
+	"cautious": {
+		"time-action-interval": "2s",
+		"time-retry-sleep":     "2s",
+		"time-scroll-pause":    "1s",
+		"time-jitter":          "10s",
+		"post-workers":         "0",
+	},
+	"normal": {
+		"time-action-interval": "1s",
+		"time-retry-sleep":     "1s",
+		"time-scroll-pause":    "500ms",
+		"time-jitter":          "0s",
+		"post-workers":         "0",
+	},
+	"fast": {
+		"time-action-interval": "250ms",
+		"time-retry-sleep":     "500ms",
+		"time-scroll-pause":    "200ms",
+		"time-jitter":          "0s",
+		"post-workers":         "4",
+	},
+}
+
+// Set the timing and concurrency flags from the -speed preset
+//
+// Flags set explicitly on the command line take precedence.
+func applySpeed() error {
+	if *speed == "" {
+		return nil
+	}
+	preset, ok := speedPresets[*speed]
+	if !ok {
+		var names []string
+		for name := range speedPresets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown -speed %q - use one of %s", *speed, strings.Join(names, ", "))
+	}
+	for name, value := range preset {
+		if isFlagSet(name) {
+			continue
+		}
+		err := flag.Set(name, value)
+		if err != nil {
+			return fmt.Errorf("failed to apply -speed %q: %w", *speed, err)
+		}
+	}
+	slog.Debug("Applied speed preset", "speed", *speed)
+	return nil
+}
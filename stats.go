@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+
+	"github.com/ncw/kindledl/kindledl"
+)
+
+// Number of the biggest books to show in the stats
+const statsBiggest = 10
+
+func init() {
+	commands["stats"] = command{
+		help: "print totals, rates and estimates from the manifest and run history",
+		run:  printStats,
+	}
+}
+
+// Print the stats of the archive
+func printStats() error {
+	s, err := kindledl.ReadStats(opt, statsBiggest)
+	if err != nil {
+		return err
+	}
+	return s.Print(os.Stdout)
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// httpStore is a file on a web server read with GET and written with
+// PUT, eg a WebDAV server
+//
+// A user name and password in the URL are used for basic
+// authentication.
+type httpStore struct {
+	url    string
+	client *http.Client
+}
+
+// Make an HTTP store for u
+func newHTTP(u *url.URL, timeout time.Duration) httpStore {
+	return httpStore{
+		url:    u.String(),
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Returns the URL without any password for messages
+func (s httpStore) String() string {
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	return u.Redacted()
+}
+
+// Load reads the file
+func (s httpStore) Load() ([]byte, error) {
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", s, fs.ErrNotExist)
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read %s: %s", s, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s, err)
+	}
+	return data, nil
+}
+
+// Save writes the file
+func (s httpStore) Save(data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, s.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to make request for %s: %w", s, err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", s, err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to write %s: %s", s, resp.Status)
+	}
+	return nil
+}
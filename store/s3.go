@@ -0,0 +1,54 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ncw/kindledl/upload"
+)
+
+// s3Store is an object in S3 compatible storage
+type s3Store struct {
+	s3      *upload.S3
+	key     string
+	timeout time.Duration
+}
+
+// Make an S3 store for u using the endpoint and credentials in
+// opt.S3
+func newS3(u *url.URL, opt Options) (s3Store, error) {
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return s3Store{}, errors.New("need an S3 URL like s3://bucket/kindledl-checkpoint.txt")
+	}
+	s3Opt := opt.S3
+	s3Opt.Bucket = u.Host
+	s3Opt.Prefix = ""
+	s3, err := upload.NewS3(s3Opt)
+	if err != nil {
+		return s3Store{}, err
+	}
+	return s3Store{
+		s3:      s3,
+		key:     key,
+		timeout: opt.Timeout,
+	}, nil
+}
+
+// Load reads the object
+func (s s3Store) Load() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.s3.Download(ctx, s.key)
+}
+
+// Save writes the object
+func (s s3Store) Save(data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.s3.Upload(ctx, s.key, bytes.NewReader(data), int64(len(data)))
+}
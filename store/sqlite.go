@@ -0,0 +1,88 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+
+	"github.com/ncw/kindledl/kindledl"
+	_ "modernc.org/sqlite" // pure Go so works without cgo
+)
+
+// sqliteDB is a database of named pieces of state
+type sqliteDB struct {
+	*sql.DB
+	path string
+}
+
+// sqliteStore is one named row in a sqliteDB
+type sqliteStore struct {
+	db   *sqliteDB
+	name string
+}
+
+// Open the SQLite store for u, opening the database if necessary
+func (o *Opener) openSQLite(u *url.URL) (kindledl.Store, error) {
+	path := u.Path
+	if u.Host != "" {
+		// sqlite://state.db is relative
+		path = u.Host + u.Path
+	}
+	if path == "" || u.Fragment == "" {
+		return nil, errors.New("need a SQLite URL like sqlite:///path/to/state.db#checkpoint")
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	db, ok := o.dbs[path]
+	if !ok {
+		var err error
+		db, err = openSQLiteDB(path)
+		if err != nil {
+			return nil, err
+		}
+		o.dbs[path] = db
+	}
+	return sqliteStore{db: db, name: u.Fragment}, nil
+}
+
+// Open the database at path, making the table if necessary
+func openSQLiteDB(path string) (*sqliteDB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database %q: %w", path, err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS state (
+		name TEXT PRIMARY KEY,
+		data BLOB NOT NULL,
+		updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to make table in SQLite database %q: %w", path, err)
+	}
+	return &sqliteDB{DB: db, path: path}, nil
+}
+
+// Load reads the row
+func (s sqliteStore) Load() ([]byte, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM state WHERE name = ?`, s.name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%q not found in %q: %w", s.name, s.db.path, fs.ErrNotExist)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read %q from %q: %w", s.name, s.db.path, err)
+	}
+	return data, nil
+}
+
+// Save writes the row in a transaction
+func (s sqliteStore) Save(data []byte) error {
+	_, err := s.db.Exec(`INSERT INTO state (name, data, updated) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(name) DO UPDATE SET data = excluded.data, updated = excluded.updated`, s.name, data)
+	if err != nil {
+		return fmt.Errorf("failed to write %q to %q: %w", s.name, s.db.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/ncw/kindledl/kindledl"
+)
+
+// stateDB is a kindledl.StateDB in a SQLite database
+type stateDB struct {
+	db   *sql.DB
+	path string
+}
+
+// OpenStateDB opens the SQLite state database at path, making it if
+// necessary
+//
+// It can be used as Options.StateDBOpener.
+func OpenStateDB(path string) (kindledl.StateDB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database %q: %w", path, err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS books (
+		marketplace TEXT NOT NULL,
+		content TEXT NOT NULL,
+		asin TEXT NOT NULL,
+		title TEXT NOT NULL,
+		number INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT NOT NULL,
+		attempts INTEGER NOT NULL,
+		first_seen TIMESTAMP NOT NULL,
+		updated TIMESTAMP NOT NULL,
+		PRIMARY KEY (marketplace, content, asin)
+	)`)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to make table in SQLite database %q: %w", path, err)
+	}
+	return &stateDB{db: db, path: path}, nil
+}
+
+// Load reads every book
+func (s *stateDB) Load() ([]kindledl.BookState, error) {
+	rows, err := s.db.Query(`SELECT marketplace, content, asin, title, number, status, error, attempts, first_seen, updated FROM books`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read books from %q: %w", s.path, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var states []kindledl.BookState
+	for rows.Next() {
+		var b kindledl.BookState
+		err = rows.Scan(&b.Marketplace, &b.Content, &b.ASIN, &b.Title, &b.Number, &b.Status, &b.Error, &b.Attempts, &b.FirstSeen, &b.Updated)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read book from %q: %w", s.path, err)
+		}
+		states = append(states, b)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read books from %q: %w", s.path, err)
+	}
+	return states, nil
+}
+
+// Save inserts or replaces the book
+func (s *stateDB) Save(b kindledl.BookState) error {
+	_, err := s.db.Exec(`INSERT INTO books (marketplace, content, asin, title, number, status, error, attempts, first_seen, updated)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(marketplace, content, asin) DO UPDATE SET
+			title = excluded.title, number = excluded.number, status = excluded.status,
+			error = excluded.error, attempts = excluded.attempts, updated = excluded.updated`,
+		b.Marketplace, b.Content, b.ASIN, b.Title, b.Number, b.Status, b.Error, b.Attempts, b.FirstSeen.UTC(), b.Updated.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to write book %q to %q: %w", b.ASIN, s.path, err)
+	}
+	return nil
+}
+
+// Close the database
+func (s *stateDB) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,76 @@
+// Package store implements kindledl.Store for SQLite, HTTP and S3 so
+// the checkpoint and manifest can be kept somewhere more durable than
+// a local file
+package store
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ncw/kindledl/kindledl"
+	"github.com/ncw/kindledl/upload"
+)
+
+// Options configure the stores
+type Options struct {
+	S3      upload.S3Options // for s3:// locations, the bucket and prefix come from the URL
+	Timeout time.Duration    // for each HTTP or S3 request
+}
+
+// Opener opens stores selected by the scheme of their location
+type Opener struct {
+	opt Options
+	mu  sync.Mutex
+	dbs map[string]*sqliteDB // open databases by path
+}
+
+// NewOpener makes an Opener for the stores
+func NewOpener(opt Options) *Opener {
+	if opt.Timeout <= 0 {
+		opt.Timeout = time.Minute
+	}
+	return &Opener{
+		opt: opt,
+		dbs: map[string]*sqliteDB{},
+	}
+}
+
+// Open returns the store for location, which is one of
+//
+//	sqlite:///path/to/state.db#name - the row called name in a SQLite database
+//	http://host/path, https://host/path - a file read with GET and written with PUT
+//	s3://bucket/path - an object in S3 compatible storage
+//
+// It can be used as Options.StoreOpener.
+func (o *Opener) Open(location string) (kindledl.Store, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid store URL: %w", err)
+	}
+	switch u.Scheme {
+	case "sqlite":
+		return o.openSQLite(u)
+	case "http", "https":
+		return newHTTP(u, o.opt.Timeout), nil
+	case "s3":
+		return newS3(u, o.opt)
+	}
+	return nil, fmt.Errorf("unknown store type %q - use sqlite, http, https or s3", u.Scheme)
+}
+
+// Close closes any open databases
+func (o *Opener) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var firstErr error
+	for path, db := range o.dbs {
+		err := db.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(o.dbs, path)
+	}
+	return firstErr
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ncw/kindledl/kindledl"
+)
+
+// Sends notifications to systemd when running as a Type=notify
+// service, or nil if not
+var systemd *systemdNotifier
+
+// systemdNotifier implements the sd_notify protocol
+type systemdNotifier struct {
+	conn net.Conn
+}
+
+// Set up the systemd notifier if systemd has asked for
+// notifications, adding a hook to keep the service status up to date
+// and starting the watchdog if enabled.
+func addSystemdNotify() error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// Sockets starting with @ are in the abstract namespace
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		return fmt.Errorf("failed to connect to systemd notify socket: %w", err)
+	}
+	systemd = &systemdNotifier{conn: conn}
+	opt.Hooks = append(opt.Hooks, systemd.hook)
+	slog.Debug("Sending notifications to systemd", "socket", os.Getenv("NOTIFY_SOCKET"))
+
+	// Ping the watchdog at half the interval systemd wants
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err == nil && usec > 0 {
+		pid := os.Getenv("WATCHDOG_PID")
+		if pid == "" || pid == strconv.Itoa(os.Getpid()) {
+			go systemd.watchdog(time.Duration(usec) * time.Microsecond / 2)
+		}
+	}
+	return nil
+}
+
+// Send state to systemd, eg "READY=1", if running under systemd
+func (s *systemdNotifier) notify(state string) {
+	if s == nil {
+		return
+	}
+	_, err := s.conn.Write([]byte(state))
+	if err != nil {
+		slog.Debug("Failed to notify systemd", "state", state, "err", err)
+	}
+}
+
+// Ping the watchdog every interval
+func (s *systemdNotifier) watchdog(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.notify("WATCHDOG=1")
+	}
+}
+
+// Tell systemd we are ready when the run starts and keep the status
+// shown by systemctl status up to date.
+func (s *systemdNotifier) hook(e kindledl.Event) error {
+	var status string
+	switch e.Type {
+	case kindledl.EventPreRun:
+		s.notify("READY=1")
+		status = fmt.Sprintf("Starting at book %d", e.Number)
+	case kindledl.EventPreBook:
+		status = fmt.Sprintf("Downloading book %d on page %d", e.Number, e.Page)
+		if e.Book != nil && e.Book.Title != "" {
+			status += fmt.Sprintf(": %q", e.Book.Title)
+		}
+	case kindledl.EventAttention:
+		status = fmt.Sprintf("Blocked at book %d: %v", e.Number, e.Err)
+	case kindledl.EventPostRun:
+		if e.Err != nil {
+			status = fmt.Sprintf("Failed at book %d: %v", e.Number, e.Err)
+		} else {
+			status = fmt.Sprintf("Finished at book %d", e.Number)
+		}
+	default:
+		return nil
+	}
+	s.notify("STATUS=" + status)
+	return nil
+}
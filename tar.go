@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+)
+
+// Flags for tar output
+var (
+	tarFile = flag.String("tar", "", "If set, write each book as it completes with its manifest entry to this tar `file`, - for stdout")
+)
+
+// Set by config if the output is -, so the books are written as a tar
+// to stdout
+var outputTar bool
+
+// Set up the tar output for -tar or -output -, returning a function to
+// tidy up once the client is closed
+//
+// With -output - the books are downloaded into a temporary directory
+// and removed once they are in the tar on stdout.
+func setupTar() (finish func(), err error) {
+	finish = func() {}
+	if outputTar {
+		if *tarFile != "" {
+			return finish, errors.New("can't use -tar with -output -")
+		}
+		if opt.Benchmark {
+			return finish, errors.New("can't use -benchmark with -output - as both write to stdout")
+		}
+		dir, err := os.MkdirTemp("", program+"-output-*")
+		if err != nil {
+			return finish, err
+		}
+		opt.Output = dir
+		opt.Tar = os.Stdout
+		opt.TarRemove = true
+		return func() {
+			_ = os.RemoveAll(dir)
+		}, nil
+	}
+	switch *tarFile {
+	case "":
+	case "-":
+		opt.Tar = os.Stdout
+	default:
+		out, err := os.Create(*tarFile)
+		if err != nil {
+			return finish, err
+		}
+		opt.Tar = out
+		finish = func() {
+			err := out.Close()
+			if err != nil {
+				slog.Error("Failed to close tar file", "err", err)
+			}
+		}
+	}
+	return finish, nil
+}
@@ -0,0 +1,152 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Options configure the S3 uploader
+type S3Options struct {
+	Endpoint    string // eg s3.amazonaws.com or https://s3.eu-central-003.backblazeb2.com
+	Region      string // region of the bucket, "" to discover it
+	Bucket      string // bucket to upload to
+	Prefix      string // prefix for the object names, eg "kindle/"
+	AccessKeyID string // access key ID, "" to read the credentials from the environment
+}
+
+// S3 uploads to S3 compatible object storage such as AWS S3,
+// Backblaze B2 or MinIO
+type S3 struct {
+	opt    S3Options
+	client *minio.Client
+}
+
+// Return the keyring user for the secret for accessKeyID
+func s3KeyringUser(accessKeyID string) string {
+	return "s3:" + accessKeyID
+}
+
+// SetS3Secret stores the secret access key for accessKeyID in the keyring
+func SetS3Secret(accessKeyID, secretAccessKey string) error {
+	return SetSecret(s3KeyringUser(accessKeyID), secretAccessKey)
+}
+
+// NewS3 makes a new S3 uploader
+//
+// If AccessKeyID is set then the secret access key is read from the
+// AWS_SECRET_ACCESS_KEY environment variable or from the keyring
+// (see SetS3Secret). Otherwise the credentials are read from the
+// usual AWS and MinIO environment variables or ~/.aws/credentials.
+func NewS3(opt S3Options) (*S3, error) {
+	if opt.Bucket == "" {
+		return nil, fmt.Errorf("S3 bucket not set")
+	}
+	endpoint := opt.Endpoint
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	secure := true
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 endpoint %q: %w", endpoint, err)
+		}
+		secure = u.Scheme != "http"
+		endpoint = u.Host
+	}
+	var creds *credentials.Credentials
+	if opt.AccessKeyID != "" {
+		secretAccessKey, err := secret(s3KeyringUser(opt.AccessKeyID), "AWS_SECRET_ACCESS_KEY")
+		if err != nil {
+			return nil, err
+		}
+		if secretAccessKey == "" {
+			return nil, fmt.Errorf("no secret access key found for S3 access key ID %q - set AWS_SECRET_ACCESS_KEY or store it in the keyring", opt.AccessKeyID)
+		}
+		creds = credentials.NewStaticV4(opt.AccessKeyID, secretAccessKey, "")
+	} else {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+		})
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: secure,
+		Region: opt.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to make S3 client: %w", err)
+	}
+	return &S3{
+		opt:    opt,
+		client: client,
+	}, nil
+}
+
+// Name describes the remote for the logs
+func (s *S3) Name() string {
+	return "s3://" + path.Join(s.opt.Bucket, s.opt.Prefix)
+}
+
+// Return the object key for name
+func (s *S3) key(name string) string {
+	return s.opt.Prefix + name
+}
+
+// Exists returns whether name already exists on the remote with this size
+func (s *S3) Exists(ctx context.Context, name string, size int64) (bool, error) {
+	info, err := s.client.StatObject(ctx, s.opt.Bucket, s.key(name), minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read S3 object %q: %w", s.key(name), err)
+	}
+	return info.Size == size, nil
+}
+
+// Upload uploads size bytes from in to name on the remote
+func (s *S3) Upload(ctx context.Context, name string, in io.Reader, size int64) error {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	_, err := s.client.PutObject(ctx, s.opt.Bucket, s.key(name), in, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload S3 object %q: %w", s.key(name), err)
+	}
+	return nil
+}
+
+// Download reads name from the remote, returning an error wrapping
+// fs.ErrNotExist if it isn't there
+func (s *S3) Download(ctx context.Context, name string) ([]byte, error) {
+	obj, err := s.client.GetObject(ctx, s.opt.Bucket, s.key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read S3 object %q: %w", s.key(name), err)
+	}
+	defer func() {
+		_ = obj.Close()
+	}()
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("S3 object %q: %w", s.key(name), fs.ErrNotExist)
+		}
+		return nil, fmt.Errorf("failed to read S3 object %q: %w", s.key(name), err)
+	}
+	return data, nil
+}
@@ -0,0 +1,43 @@
+// Package upload implements kindledl.Uploader for remote storage
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ncw/kindledl/kindledl"
+	"github.com/zalando/go-keyring"
+)
+
+// Look up a secret, first in the environment variables given, then in
+// the keyring under the kindledl service with the user given.
+//
+// Returns "" if not found.
+func secret(user string, envs ...string) (string, error) {
+	for _, env := range envs {
+		if value := os.Getenv(env); value != "" {
+			return value, nil
+		}
+	}
+	if user == "" {
+		return "", nil
+	}
+	value, err := keyring.Get(kindledl.Program, user)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to read keyring: %w", err)
+	}
+	return value, nil
+}
+
+// SetSecret stores a secret in the keyring under the kindledl service
+// for user
+func SetSecret(user, value string) error {
+	err := keyring.Set(kindledl.Program, user, value)
+	if err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Suffix for files being uploaded to WebDAV before they are moved
+// into place
+const webDAVTempSuffix = ".kindledl-upload"
+
+// WebDAVOptions configure the WebDAV uploader
+type WebDAVOptions struct {
+	URL        string        // URL of the directory to upload to, eg https://cloud.example.com/remote.php/dav/files/user/Books
+	User       string        // user name, "" for no authentication
+	Retries    int           // number of times to try each request
+	RetrySleep time.Duration // time to wait before the first retry, doubling each time
+}
+
+// WebDAV uploads to a WebDAV server such as Nextcloud
+//
+// Files are uploaded to a temporary name and moved into place when
+// complete so an interrupted upload never looks like a complete file.
+type WebDAV struct {
+	opt      WebDAVOptions
+	base     *url.URL
+	password string
+	client   *http.Client
+	mu       sync.Mutex
+	dirs     map[string]bool // directories known to exist
+}
+
+// Return the keyring user for the WebDAV password for user
+func webDAVKeyringUser(user string) string {
+	return "webdav:" + user
+}
+
+// SetWebDAVPassword stores the password for the WebDAV user in the keyring
+func SetWebDAVPassword(user, password string) error {
+	return SetSecret(webDAVKeyringUser(user), password)
+}
+
+// NewWebDAV makes a new WebDAV uploader
+//
+// If User is set then the password is read from the
+// KINDLEDL_WEBDAV_PASSWORD environment variable or from the keyring
+// (see SetWebDAVPassword).
+func NewWebDAV(opt WebDAVOptions) (*WebDAV, error) {
+	base, err := url.Parse(strings.TrimSuffix(opt.URL, "/") + "/")
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("invalid WebDAV URL %q", opt.URL)
+	}
+	if opt.Retries < 1 {
+		opt.Retries = 1
+	}
+	w := &WebDAV{
+		opt:    opt,
+		base:   base,
+		client: &http.Client{},
+		dirs:   map[string]bool{"": true},
+	}
+	if opt.User != "" {
+		w.password, err = secret(webDAVKeyringUser(opt.User), "KINDLEDL_WEBDAV_PASSWORD")
+		if err != nil {
+			return nil, err
+		}
+		if w.password == "" {
+			return nil, fmt.Errorf("no password found for WebDAV user %q - set KINDLEDL_WEBDAV_PASSWORD or store it in the keyring", opt.User)
+		}
+	}
+	return w, nil
+}
+
+// Name describes the remote for the logs
+func (w *WebDAV) Name() string {
+	return w.base.Redacted()
+}
+
+// Return the URL for name
+func (w *WebDAV) url(name string) string {
+	u := w.base.JoinPath(strings.Split(name, "/")...)
+	return u.String()
+}
+
+// errRetry marks errors which are worth retrying
+type errRetry struct {
+	err error
+}
+
+func (e errRetry) Error() string { return e.err.Error() }
+func (e errRetry) Unwrap() error { return e.err }
+
+// Do a request returning the response if the status is one of ok
+//
+// body is called to make the request body for each try.
+func (w *WebDAV) do(ctx context.Context, method, u string, header http.Header, body func() (io.Reader, error), ok ...int) (*http.Response, error) {
+	sleep := w.opt.RetrySleep
+	var err error
+	for try := 1; try <= w.opt.Retries; try++ {
+		if try > 1 {
+			slog.Debug("Retrying WebDAV request", "method", method, "url", u, "try", try, "err", err)
+			select {
+			case <-time.After(sleep):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			sleep *= 2
+		}
+		var resp *http.Response
+		resp, err = w.try(ctx, method, u, header, body, ok)
+		if err == nil {
+			return resp, nil
+		}
+		var retry errRetry
+		if !errors.As(err, &retry) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// Do a single try of a request
+func (w *WebDAV) try(ctx context.Context, method, u string, header http.Header, body func() (io.Reader, error), ok []int) (*http.Response, error) {
+	var in io.Reader
+	if body != nil {
+		var err error
+		in, err = body()
+		if err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, in)
+	if err != nil {
+		return nil, err
+	}
+	// Send the length of uploads as not all servers can cope with
+	// chunked encoding
+	if lr, ok := in.(*io.LimitedReader); ok {
+		req.ContentLength = lr.N
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if w.opt.User != "" {
+		req.SetBasicAuth(w.opt.User, w.password)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, errRetry{fmt.Errorf("WebDAV %s failed: %w", method, err)}
+	}
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	err = fmt.Errorf("WebDAV %s %q failed: %s", method, u, resp.Status)
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout {
+		return nil, errRetry{err}
+	}
+	return nil, err
+}
+
+// Do a request discarding the response
+func (w *WebDAV) call(ctx context.Context, method, u string, header http.Header, body func() (io.Reader, error), ok ...int) (int, error) {
+	resp, err := w.do(ctx, method, u, header, body, ok...)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// Exists returns whether name already exists on the remote with this size
+func (w *WebDAV) Exists(ctx context.Context, name string, size int64) (bool, error) {
+	resp, err := w.do(ctx, http.MethodHead, w.url(name), nil, nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return false, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	// Nextcloud puts the real size in OC-FileSize for HEAD requests
+	length := resp.Header.Get("OC-FileSize")
+	if length == "" {
+		length = resp.Header.Get("Content-Length")
+	}
+	remoteSize, err := strconv.ParseInt(length, 10, 64)
+	if err != nil {
+		return false, nil
+	}
+	return remoteSize == size, nil
+}
+
+// Make the directory dir and its parents if they don't exist
+func (w *WebDAV) mkdirAll(ctx context.Context, dir string) error {
+	if dir == "." || dir == "/" {
+		dir = ""
+	}
+	w.mu.Lock()
+	known := w.dirs[dir]
+	w.mu.Unlock()
+	if known {
+		return nil
+	}
+	err := w.mkdirAll(ctx, path.Dir(dir))
+	if err != nil {
+		return err
+	}
+	// 405 means it exists already
+	_, err = w.call(ctx, "MKCOL", w.url(dir), nil, nil, http.StatusCreated, http.StatusMethodNotAllowed)
+	if err != nil {
+		return fmt.Errorf("failed to make WebDAV directory %q: %w", dir, err)
+	}
+	w.mu.Lock()
+	w.dirs[dir] = true
+	w.mu.Unlock()
+	return nil
+}
+
+// Upload uploads size bytes from in to name on the remote
+//
+// If in is an io.Seeker then failed uploads are retried.
+func (w *WebDAV) Upload(ctx context.Context, name string, in io.Reader, size int64) error {
+	err := w.mkdirAll(ctx, path.Dir(name))
+	if err != nil {
+		return err
+	}
+	seeker, canSeek := in.(io.Seeker)
+	tries := 0
+	body := func() (io.Reader, error) {
+		tries++
+		if tries > 1 {
+			if !canSeek {
+				return nil, errors.New("can't retry upload")
+			}
+			_, err := seeker.Seek(0, io.SeekStart)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return io.LimitReader(in, size), nil
+	}
+	tmp := w.url(name + webDAVTempSuffix)
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	_, err = w.call(ctx, http.MethodPut, tmp, header, body, http.StatusOK, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	header = http.Header{
+		"Destination": {w.url(name)},
+		"Overwrite":   {"T"},
+	}
+	_, err = w.call(ctx, "MOVE", tmp, header, nil, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		return fmt.Errorf("failed to move WebDAV upload into place: %w", err)
+	}
+	return nil
+}
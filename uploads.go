@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ncw/kindledl/upload"
+)
+
+// Flags for uploading
+var (
+	s3Opt     upload.S3Options
+	webDAVOpt = upload.WebDAVOptions{
+		Retries:    5,
+		RetrySleep: 2 * time.Second,
+	}
+)
+
+func init() {
+	flag.StringVar(&s3Opt.Bucket, "s3-bucket", "", "If set, upload each book to this S3 bucket as it completes")
+	flag.StringVar(&s3Opt.Endpoint, "s3-endpoint", "", "S3 endpoint to use, eg https://s3.eu-central-003.backblazeb2.com for B2 (default AWS)")
+	flag.StringVar(&s3Opt.Region, "s3-region", "", "Region of the S3 bucket, if needed")
+	flag.StringVar(&s3Opt.Prefix, "s3-prefix", "", "Prefix for the names of the books in the S3 bucket, eg kindle/")
+	flag.StringVar(&s3Opt.AccessKeyID, "s3-access-key-id", "", "S3 access key ID, if not set read the credentials from the environment")
+	flag.StringVar(&webDAVOpt.URL, "webdav-url", "", "If set, upload each book to this WebDAV directory as it completes")
+	flag.StringVar(&webDAVOpt.User, "webdav-user", "", "User name for WebDAV")
+	flag.IntVar(&webDAVOpt.Retries, "webdav-retries", webDAVOpt.Retries, "Number of times to try each WebDAV request")
+	commands["s3-secret"] = command{
+		help: "store the secret for -s3-access-key-id in the keyring",
+		run:  storeS3Secret,
+	}
+	commands["webdav-password"] = command{
+		help: "store the password for -webdav-user in the keyring",
+		run:  storeWebDAVPassword,
+	}
+}
+
+// Add the uploaders configured by the flags to the options
+func addUploaders() error {
+	if s3Opt.Bucket != "" {
+		s3, err := upload.NewS3(s3Opt)
+		if err != nil {
+			return err
+		}
+		opt.Uploaders = append(opt.Uploaders, s3)
+	}
+	if webDAVOpt.URL != "" {
+		webDAV, err := upload.NewWebDAV(webDAVOpt)
+		if err != nil {
+			return err
+		}
+		opt.Uploaders = append(opt.Uploaders, webDAV)
+	}
+	return nil
+}
+
+// Read a secret from stdin after showing the prompt
+func readSecret(prompt string) (string, error) {
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	secret := strings.TrimSpace(line)
+	if secret == "" {
+		return "", errors.New("empty secret")
+	}
+	return secret, nil
+}
+
+// Read the S3 secret access key from stdin and store it in the keyring
+func storeS3Secret() error {
+	if s3Opt.AccessKeyID == "" {
+		return errors.New("need -s3-access-key-id to store the secret for")
+	}
+	secretAccessKey, err := readSecret("Enter the secret access key for " + s3Opt.AccessKeyID)
+	if err != nil {
+		return err
+	}
+	return upload.SetS3Secret(s3Opt.AccessKeyID, secretAccessKey)
+}
+
+// Read the WebDAV password from stdin and store it in the keyring
+func storeWebDAVPassword() error {
+	if webDAVOpt.User == "" {
+		return errors.New("need -webdav-user to store the password for")
+	}
+	password, err := readSecret("Enter the WebDAV password for " + webDAVOpt.User)
+	if err != nil {
+		return err
+	}
+	return upload.SetWebDAVPassword(webDAVOpt.User, password)
+}